@@ -0,0 +1,275 @@
+package flac
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// AccurateRip ignores the first accurateRipSkip-1 samples of the first track
+// and the last accurateRipSkip samples of the last track, as drives cannot
+// read them reliably.
+const accurateRipSkip = 5 * cdSectorSamples
+
+// AccurateRipDiscID identifies a CD in the AccurateRip database.
+type AccurateRipDiscID struct {
+	Tracks   int
+	ID1, ID2 uint32
+	// FreedbID is the freedb disc ID, the third part of the ID.
+	FreedbID uint32
+}
+
+// NewAccurateRipDiscID returns the AccurateRip disc ID of the table of
+// contents of a CD-DA cue sheet.
+func NewAccurateRipDiscID(cueSheet *CueSheet) (AccurateRipDiscID, error) {
+	toc, err := NewCDTOC(cueSheet)
+	if err != nil {
+		return AccurateRipDiscID{}, err
+	}
+	id := AccurateRipDiscID{Tracks: len(toc.Offsets), FreedbID: toc.FreedbDiscID()}
+	for i, offset := range append(toc.Offsets, toc.LeadOut) {
+		// AccurateRip offsets do not count the pregap of the first track
+		offset -= cdLeadIn
+		id.ID1 += offset
+		id.ID2 += max(offset, 1) * uint32(i+1)
+	}
+	return id, nil
+}
+
+// String returns the ID in the form used in AccurateRip file names, such as
+// "012-0012d1f6-00c26b3b-b10c520c".
+func (id AccurateRipDiscID) String() string {
+	return fmt.Sprintf("%03d-%08x-%08x-%08x", id.Tracks, id.ID1, id.ID2, id.FreedbID)
+}
+
+// Path returns the path of the database file of the disc in the AccurateRip
+// database, such as "6/f/1/dBAR-012-0012d1f6-00c26b3b-b10c520c.bin".
+func (id AccurateRipDiscID) Path() string {
+	return fmt.Sprintf("%x/%x/%x/dBAR-%s.bin", id.ID1&0xf, id.ID1>>4&0xf, id.ID1>>8&0xf, id)
+}
+
+// TrackChecksums holds the checksums of a track of a CD rip.
+type TrackChecksums struct {
+	TrackNumber uint8
+	// Start and Length are the sample number of index point 1 of the track
+	// and its number of samples up to index point 1 of the next track.
+	Start, Length uint64
+	// AccurateRipV1 and AccurateRipV2 are the AccurateRip checksums of the
+	// track.
+	AccurateRipV1, AccurateRipV2 uint32
+	// CopyCRC is the CRC-32 of the track audio as 16 bit little-endian
+	// stereo PCM, the copy CRC reported by EAC.
+	CopyCRC uint32
+}
+
+// RipChecksums holds the results of a RipChecker.
+type RipChecksums struct {
+	DiscID AccurateRipDiscID
+	Tracks []TrackChecksums
+	// CopyCRC is the CRC-32 of all the audio of the stream as 16 bit
+	// little-endian stereo PCM.
+	CopyCRC uint32
+}
+
+// RipChecker computes the AccurateRip checksums and EAC copy CRCs of the
+// tracks of a CD rip. The samples of a stream are passed to Write or
+// WriteFrame in order, and Checksums returns the results.
+type RipChecker struct {
+	id     AccurateRipDiscID
+	tracks []TrackChecksums
+
+	n     uint64 // samples written
+	track int    // index of the track of sample n, or -1 before the first
+	crc   hash.Hash32
+	disc  hash.Hash32
+	buf   []byte // PCM of the track not yet added to the CRCs
+}
+
+// NewRipChecker returns a RipChecker of a stream of 44.1 kHz, 16 bit stereo
+// audio with a CD-DA cue sheet.
+func NewRipChecker(info *StreamInfo, cueSheet *CueSheet) (*RipChecker, error) {
+	if info.SampleRate != 44100 || info.Channels != 2 || info.BitsPerSample != 16 {
+		return nil, fmt.Errorf("%d Hz, %d channels, %d bits per sample: %w", info.SampleRate, info.Channels, info.BitsPerSample, ErrNotCDDA)
+	}
+	id, err := NewAccurateRipDiscID(cueSheet)
+	if err != nil {
+		return nil, err
+	}
+	toc, _ := cdTOC(cueSheet)
+	c := &RipChecker{
+		id:    id,
+		track: -1,
+		crc:   crc32.NewIEEE(),
+		disc:  crc32.NewIEEE(),
+	}
+	for i, t := range cueSheet.Tracks[:len(toc)-1] {
+		c.tracks = append(c.tracks, TrackChecksums{
+			TrackNumber: t.TrackNumber,
+			Start:       uint64(toc[i]) * cdSectorSamples,
+			Length:      uint64(toc[i+1]-toc[i]) * cdSectorSamples,
+		})
+	}
+	if c.tracks[0].Start == 0 {
+		c.track = 0
+	}
+	return c, nil
+}
+
+// WriteFrame adds the samples of a frame to the checksums.
+func (c *RipChecker) WriteFrame(f *Frame) {
+	c.Write(f.Samples)
+}
+
+// Write adds two channels of 16 bit samples to the checksums.
+func (c *RipChecker) Write(samples [][]int32) {
+	left, right := samples[0], samples[1]
+	for i := range left {
+		if c.track < len(c.tracks)-1 && c.n == c.tracks[c.track+1].Start {
+			c.endTrack()
+			c.track++
+		}
+		v := uint32(uint16(left[i])) | uint32(uint16(right[i]))<<16
+		c.buf = binary.LittleEndian.AppendUint32(c.buf, v)
+
+		if c.track >= 0 {
+			t := &c.tracks[c.track]
+			if pos := c.n - t.Start; pos < t.Length {
+				mult := pos + 1
+				first := c.track == 0 && mult <= accurateRipSkip-1
+				last := c.track == len(c.tracks)-1 && mult > t.Length-accurateRipSkip
+				if !first && !last {
+					p := uint64(v) * uint64(uint32(mult))
+					t.AccurateRipV1 += uint32(p)
+					t.AccurateRipV2 += uint32(p) + uint32(p>>32)
+				}
+			}
+		}
+		c.n++
+	}
+	c.flush()
+}
+
+// flush adds the pending PCM to the CRCs of the disc and current track.
+func (c *RipChecker) flush() {
+	c.disc.Write(c.buf)
+	if c.track >= 0 {
+		t := &c.tracks[c.track]
+		// samples past the end of the last track are not part of it
+		past := min((c.n-min(c.n, t.Start+t.Length))*4, uint64(len(c.buf)))
+		c.crc.Write(c.buf[:uint64(len(c.buf))-past])
+	}
+	c.buf = c.buf[:0]
+}
+
+// endTrack ends the copy CRC of the current track.
+func (c *RipChecker) endTrack() {
+	c.flush()
+	if c.track >= 0 {
+		c.tracks[c.track].CopyCRC = c.crc.Sum32()
+	}
+	c.crc.Reset()
+}
+
+// Checksums returns the checksums of the samples written so far.
+func (c *RipChecker) Checksums() *RipChecksums {
+	sums := &RipChecksums{
+		DiscID:  c.id,
+		Tracks:  append([]TrackChecksums(nil), c.tracks...),
+		CopyCRC: c.disc.Sum32(),
+	}
+	if c.track >= 0 {
+		sums.Tracks[c.track].CopyCRC = c.crc.Sum32()
+	}
+	return sums
+}
+
+// AccurateRipEntry is an entry of an AccurateRip database file: the
+// checksums of the tracks of a pressing of a disc.
+type AccurateRipEntry struct {
+	DiscID AccurateRipDiscID
+	Tracks []AccurateRipTrack
+}
+
+// AccurateRipTrack is the AccurateRip checksum of a track of a pressing, and
+// the number of rips that agree with it.
+type AccurateRipTrack struct {
+	Confidence uint8
+	CRC        uint32
+	// FrameCRC is the checksum of sector 450 of the track, used to find the
+	// read offset of a drive.
+	FrameCRC uint32
+}
+
+// ReadAccurateRipDatabase reads the entries of an AccurateRip database file,
+// such as one fetched from the path of an AccurateRipDiscID.
+func ReadAccurateRipDatabase(r io.Reader) ([]AccurateRipEntry, error) {
+	var entries []AccurateRipEntry
+	var header [13]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("AccurateRip entry %d: %w", len(entries), err)
+		}
+		e := AccurateRipEntry{DiscID: AccurateRipDiscID{
+			Tracks:   int(header[0]),
+			ID1:      binary.LittleEndian.Uint32(header[1:]),
+			ID2:      binary.LittleEndian.Uint32(header[5:]),
+			FreedbID: binary.LittleEndian.Uint32(header[9:]),
+		}}
+		buf := make([]byte, 9*e.DiscID.Tracks)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("AccurateRip entry %d: %w", len(entries), err)
+		}
+		for t := buf; len(t) > 0; t = t[9:] {
+			e.Tracks = append(e.Tracks, AccurateRipTrack{
+				Confidence: t[0],
+				CRC:        binary.LittleEndian.Uint32(t[1:]),
+				FrameCRC:   binary.LittleEndian.Uint32(t[5:]),
+			})
+		}
+		entries = append(entries, e)
+	}
+}
+
+// AccurateRipResult is the result of verifying a track against AccurateRip
+// database entries.
+type AccurateRipResult struct {
+	// Confidence is the sum of the confidence of the entries whose checksum
+	// matches the track, or 0 if none does.
+	Confidence int
+	// V1 and V2 report whether the AccurateRip v1 and v2 checksums matched.
+	V1, V2 bool
+	// Entries is the number of entries with a checksum of the track.
+	Entries int
+}
+
+// Verify compares the checksums of each track with the entries of the disc
+// in an AccurateRip database file. Entries of other discs are ignored.
+func (c *RipChecksums) Verify(entries []AccurateRipEntry) []AccurateRipResult {
+	results := make([]AccurateRipResult, len(c.Tracks))
+	for _, e := range entries {
+		if e.DiscID != c.DiscID {
+			continue
+		}
+		for i, t := range c.Tracks {
+			if i >= len(e.Tracks) {
+				break
+			}
+			r := &results[i]
+			r.Entries++
+			switch e.Tracks[i].CRC {
+			case t.AccurateRipV1:
+				r.V1 = true
+			case t.AccurateRipV2:
+				r.V2 = true
+			default:
+				continue
+			}
+			r.Confidence += int(e.Tracks[i].Confidence)
+		}
+	}
+	return results
+}
@@ -0,0 +1,157 @@
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// testCDCueSheet returns a CD-DA cue sheet of tracks starting at the given
+// sector offsets, the last being the lead-out. Track 1 has a pregap of
+// pregap sectors.
+func testCDCueSheet(pregap uint64, offsets ...uint64) *CueSheet {
+	cs := &CueSheet{IsCD: true, NumLeadInSamples: 88200}
+	for i, o := range offsets {
+		t := &CueSheetTrack{TrackNumber: uint8(i + 1), OffsetSamples: o * cdSectorSamples, IsAudio: true}
+		switch {
+		case i == len(offsets)-1:
+			t.TrackNumber = cdLeadOutTrack
+		case i == 0 && pregap > 0:
+			t.OffsetSamples = 0
+			t.Indices = []*CueSheetTrackIndex{{PointNumber: 0}, {PointNumber: 1, OffsetSamples: pregap * cdSectorSamples}}
+		default:
+			t.Indices = []*CueSheetTrackIndex{{PointNumber: 1}}
+		}
+		cs.Tracks = append(cs.Tracks, t)
+	}
+	return cs
+}
+
+func TestAccurateRipDiscID(t *testing.T) {
+	id, err := NewAccurateRipDiscID(testCDCueSheet(0, 0, 10000, 20000, 30000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AccurateRipDiscID{Tracks: 3, ID1: 60000, ID2: 1 + 10000*2 + 20000*3 + 30000*4, FreedbID: 27<<24 | 400<<8 | 3}
+	if id != want {
+		t.Errorf("got %+v, want %+v", id, want)
+	}
+	if got, want := id.Path(), "0/6/a/dBAR-003-0000ea60-00030d41-1b019003.bin"; got != want {
+		t.Errorf("path %q, want %q", got, want)
+	}
+
+	for _, cs := range []*CueSheet{
+		{Tracks: testCDCueSheet(0, 0, 100).Tracks},
+		testCDCueSheet(0, 0),
+		testCDCueSheet(0, 0, 100, 50),
+		{IsCD: true, Tracks: []*CueSheetTrack{{TrackNumber: 1, OffsetSamples: 1}, {TrackNumber: cdLeadOutTrack, OffsetSamples: 588}}},
+	} {
+		if _, err := NewAccurateRipDiscID(cs); !errors.Is(err, ErrNotCDDA) {
+			t.Errorf("%+v: got %v, want ErrNotCDDA", cs, err)
+		}
+	}
+}
+
+func TestRipChecker(t *testing.T) {
+	// tracks of 8, 15 and 15 sectors after a pregap of 2 sectors, and a
+	// sector of audio past the lead-out
+	cs := testCDCueSheet(2, 0, 10, 25, 40)
+	n := 41 * cdSectorSamples
+	rnd := rand.New(rand.NewSource(1))
+	left := testSignal(n, func(int) int32 { return int32(rnd.Intn(1<<16) - 1<<15) })
+	right := testSignal(n, func(int) int32 { return int32(rnd.Intn(1<<16) - 1<<15) })
+
+	pcm := make([]uint32, n)
+	var all []byte
+	for i := range pcm {
+		pcm[i] = uint32(uint16(left[i])) | uint32(uint16(right[i]))<<16
+		all = binary.LittleEndian.AppendUint32(all, pcm[i])
+	}
+	// the checksums of a track, from the description of the algorithm
+	checksum := func(track []uint32, from, to int) (v1, v2 uint32) {
+		for i, v := range track {
+			if mult := i + 1; mult >= from && mult <= to {
+				p := uint64(v) * uint64(mult)
+				v1 += uint32(p)
+				v2 += uint32(p) + uint32(p>>32)
+			}
+		}
+		return v1, v2
+	}
+
+	info := &StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 16, TotalSamples: uint64(n)}
+	c, err := NewRipChecker(info, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i += 1000 {
+		c.Write([][]int32{left[i:min(i+1000, n)], right[i:min(i+1000, n)]})
+	}
+	sums := c.Checksums()
+	if sums.CopyCRC != crc32.ChecksumIEEE(all) {
+		t.Errorf("disc copy CRC %08x, want %08x", sums.CopyCRC, crc32.ChecksumIEEE(all))
+	}
+	bounds := []int{2, 10, 25, 40}
+	for i, tr := range sums.Tracks {
+		start, end := bounds[i]*cdSectorSamples, bounds[i+1]*cdSectorSamples
+		if tr.TrackNumber != uint8(i+1) || tr.Start != uint64(start) || tr.Length != uint64(end-start) {
+			t.Errorf("track %d: %+v", i+1, tr)
+		}
+		from, to := 1, end-start
+		if i == 0 {
+			from = 5 * 588 // after 2939 skipped samples
+		}
+		if i == 2 {
+			to -= 5 * 588
+		}
+		v1, v2 := checksum(pcm[start:end], from, to)
+		if tr.AccurateRipV1 != v1 || tr.AccurateRipV2 != v2 {
+			t.Errorf("track %d: checksums %08x %08x, want %08x %08x", i+1, tr.AccurateRipV1, tr.AccurateRipV2, v1, v2)
+		}
+		if want := crc32.ChecksumIEEE(all[start*4 : end*4]); tr.CopyCRC != want {
+			t.Errorf("track %d: copy CRC %08x, want %08x", i+1, tr.CopyCRC, want)
+		}
+	}
+
+	// verifying against a database file
+	var db bytes.Buffer
+	entry := func(id AccurateRipDiscID, tracks ...AccurateRipTrack) {
+		db.WriteByte(byte(id.Tracks))
+		db.Write(binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, id.ID1), id.ID2), id.FreedbID))
+		for _, t := range tracks {
+			db.WriteByte(t.Confidence)
+			db.Write(binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, t.CRC), t.FrameCRC))
+		}
+	}
+	tr := sums.Tracks
+	entry(sums.DiscID, AccurateRipTrack{5, tr[0].AccurateRipV1, 1}, AccurateRipTrack{3, tr[1].AccurateRipV2, 2}, AccurateRipTrack{9, tr[2].AccurateRipV1 + 1, 3})
+	other := sums.DiscID
+	other.ID1++
+	entry(other, AccurateRipTrack{50, tr[0].AccurateRipV1, 0}, AccurateRipTrack{50, tr[1].AccurateRipV1, 0}, AccurateRipTrack{50, tr[2].AccurateRipV1, 0})
+	entry(sums.DiscID, AccurateRipTrack{2, tr[0].AccurateRipV1, 0}, AccurateRipTrack{4, 0, 0}, AccurateRipTrack{1, tr[2].AccurateRipV2, 0})
+
+	entries, err := ReadAccurateRipDatabase(bytes.NewReader(db.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Tracks[1].FrameCRC != 2 {
+		t.Fatalf("read %+v", entries)
+	}
+	want := []AccurateRipResult{{7, true, false, 2}, {3, false, true, 2}, {1, false, true, 2}}
+	for i, r := range sums.Verify(entries) {
+		if r != want[i] {
+			t.Errorf("track %d: %+v, want %+v", i+1, r, want[i])
+		}
+	}
+	if _, err := ReadAccurateRipDatabase(bytes.NewReader(db.Bytes()[:db.Len()-1])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated database: got %v", err)
+	}
+
+	if _, err := NewRipChecker(&StreamInfo{SampleRate: 48000, Channels: 2, BitsPerSample: 16}, cs); !errors.Is(err, ErrNotCDDA) {
+		t.Errorf("48 kHz stream: got %v, want ErrNotCDDA", err)
+	}
+}
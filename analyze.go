@@ -0,0 +1,72 @@
+package flac
+
+import "math"
+
+// AnalyzeFrame reads and decodes the next audio frame like ReadFrame, and also
+// keeps the residual of each FIXED and LPC subframe in Subframe.Residual.
+func (r *Reader) AnalyzeFrame() (*Frame, error) {
+	r.keepResidual = true
+	defer func() { r.keepResidual = false }()
+	return r.ReadFrame()
+}
+
+// ResidualStats summarizes the residual of a subframe.
+type ResidualStats struct {
+	// Number of residual samples.
+	Count int
+	// Smallest and largest residual sample.
+	Min, Max int64
+	// Mean and standard deviation of the residual samples.
+	Mean, StdDev float64
+	// Bits is the size of the coded residual in bits, including the coding
+	// method, the partition order and the partition parameters.
+	Bits int
+}
+
+// ResidualStats returns statistics of the residual of a subframe read with
+// AnalyzeFrame. It returns the zero value for CONSTANT and VERBATIM
+// subframes.
+func (sf *Subframe) ResidualStats() ResidualStats {
+	var st ResidualStats
+	rc := sf.ResidualCoding
+	if rc == nil || len(sf.Residual) == 0 {
+		return st
+	}
+
+	st.Count = len(sf.Residual)
+	st.Min, st.Max = sf.Residual[0], sf.Residual[0]
+	var sum float64
+	for _, v := range sf.Residual {
+		st.Min = min(st.Min, v)
+		st.Max = max(st.Max, v)
+		sum += float64(v)
+	}
+	st.Mean = sum / float64(st.Count)
+	var sq float64
+	for _, v := range sf.Residual {
+		d := float64(v) - st.Mean
+		sq += d * d
+	}
+	st.StdDev = math.Sqrt(sq / float64(st.Count))
+
+	// <2 bits> method, <4 bits> partition order, then each partition
+	st.Bits = 2 + 4
+	paramBits := 4 + int(rc.Method)
+	n := len(sf.Residual) + sf.Order // block size
+	i := 0
+	for p, part := range rc.Partitions {
+		end := (p+1)*n>>rc.PartitionOrder - sf.Order
+		st.Bits += paramBits
+		if part.Escaped {
+			st.Bits += 5 + (end-i)*int(part.RawBits)
+			i = end
+			continue
+		}
+		for ; i < end; i++ {
+			v := sf.Residual[i]
+			u := uint64(v<<1 ^ v>>63)
+			st.Bits += int(u>>part.Parameter) + 1 + int(part.Parameter)
+		}
+	}
+	return st
+}
@@ -0,0 +1,61 @@
+package flac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAnalyzeFrame(t *testing.T) {
+	const blockSize = 32
+
+	s := testSignal(blockSize, func(i int) int32 { return int32(i*i%50 - 25) })
+	var stream bytes.Buffer
+	w := NewWriter(&stream)
+	w.WriteBlock(&MetadataBlock{
+		MetadataBlockHeader: MetadataBlockHeader{Last: true},
+		Data:                &StreamInfo{MinimumBlockSize: blockSize, MaximumBlockSize: blockSize, SampleRate: 8000, Channels: 1, BitsPerSample: 8},
+	})
+	sf := testSubframe{typ: SubframeTypeFixed, order: 1, riceParam: 3}
+	frame := buildTestFrame(t, 0, 0, 8, widen(s), []testSubframe{sf})
+	stream.Write(frame)
+	stream.Write(frame)
+
+	r := NewReader(bytes.NewReader(stream.Bytes()))
+	f, err := r.AnalyzeFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := f.Subframes[0]
+	if len(got.Warmup) != 1 || got.Warmup[0] != int64(s[0]) {
+		t.Errorf("warm-up = %v, want [%d]", got.Warmup, s[0])
+	}
+	rc := got.ResidualCoding
+	if rc == nil || rc.Method != 0 || rc.PartitionOrder != 0 || len(rc.Partitions) != 1 || rc.Partitions[0] != (RicePartition{Parameter: 3}) {
+		t.Fatalf("residual coding = %+v", rc)
+	}
+	if len(got.Residual) != blockSize-1 {
+		t.Fatalf("residual has %d samples, want %d", len(got.Residual), blockSize-1)
+	}
+
+	wantBits := 2 + 4 + 4
+	lo, hi := got.Residual[0], got.Residual[0]
+	for i, v := range got.Residual {
+		if want := int64(s[i+1] - s[i]); v != want {
+			t.Fatalf("residual %d = %d, want %d", i, v, want)
+		}
+		lo, hi = min(lo, v), max(hi, v)
+		wantBits += int(uint64(v<<1^v>>63)>>3) + 1 + 3
+	}
+	st := got.ResidualStats()
+	if st.Count != blockSize-1 || st.Min != lo || st.Max != hi || st.Bits != wantBits {
+		t.Errorf("stats = %+v, want count %d, min %d, max %d, bits %d", st, blockSize-1, lo, hi, wantBits)
+	}
+
+	f, err = r.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Subframes[0].Residual != nil {
+		t.Error("ReadFrame kept the residual")
+	}
+}
@@ -19,7 +19,14 @@ func (r *Reader) decodeApplication(n uint32) (*Application, error) {
 	i := 0
 	b.ID = string(r.buf[i:4])
 	i += 4
-	b.Data = r.buf[i:n]
+	b.Data = append([]byte(nil), r.buf[i:n]...)
 
 	return b, nil
 }
+
+func (w *Writer) encodeApplication(b *Application) {
+	var id [4]byte
+	copy(id[:], b.ID)
+	w.buf.Write(id[:])
+	w.buf.Write(b.Data)
+}
@@ -0,0 +1,282 @@
+package flac
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// AuthenticityIssue is a sign that audio is not what its format claims, such
+// as a transcoded MP3 delivered as lossless or CD audio delivered as hi-res.
+type AuthenticityIssue uint8
+
+const (
+	// IssueLossySource is a spectrum that ends in the steep lowpass of a
+	// lossy encoder, below 20 kHz or 90% of the Nyquist frequency, and not
+	// at the Nyquist frequency of a lower sample rate.
+	IssueLossySource AuthenticityIssue = iota
+	// IssueUpsampled is a spectrum that ends at the Nyquist frequency of a
+	// lower sample rate of at least 44.1 kHz.
+	IssueUpsampled
+	// IssuePaddedBits is audio whose low bits are zero in every sample, such
+	// as 16 bit audio padded to 24 bits. It is certain if the encoder coded
+	// those bits as wasted bits in every subframe.
+	IssuePaddedBits
+)
+
+func (i AuthenticityIssue) String() string {
+	switch i {
+	case IssueLossySource:
+		return "lossy source"
+	case IssueUpsampled:
+		return "upsampled"
+	case IssuePaddedBits:
+		return "padded bits"
+	}
+	return fmt.Sprintf("AuthenticityIssue(%d)", i)
+}
+
+// AuthenticityFinding is an issue found by an AuthenticityAnalyzer.
+type AuthenticityFinding struct {
+	Issue AuthenticityIssue
+	// Confidence is the confidence in the finding, between 0 and 1.
+	Confidence float64
+}
+
+// AuthenticityReport holds the results of an AuthenticityAnalyzer.
+type AuthenticityReport struct {
+	SampleRate    uint32
+	BitsPerSample uint8
+	// CutoffFrequency is the frequency in Hz at which the spectrum drops
+	// steeply to the noise floor, or the Nyquist frequency if it does not,
+	// and CutoffDrop is the drop in dB.
+	CutoffFrequency, CutoffDrop float64
+	// SourceSampleRate is the estimated sample rate of upsampled audio, or
+	// SampleRate.
+	SourceSampleRate uint32
+	// EffectiveBitsPerSample is BitsPerSample less the low bits that are
+	// zero in every sample, or 0 for digital silence.
+	EffectiveBitsPerSample uint8
+	// SubframeWastedBits is the smallest number of wasted bits of the
+	// non-constant subframes passed to WriteFrame. Encoders mark the zero
+	// low bits of padded audio as wasted bits.
+	SubframeWastedBits uint8
+	// Findings are the issues found.
+	Findings []AuthenticityFinding
+	// Genuine is the confidence, between 0 and 1, that the audio is genuine:
+	// 1 less the largest confidence of the findings.
+	Genuine float64
+}
+
+// Spectral analysis settings of an AuthenticityAnalyzer.
+const (
+	spectrumResolution = 10.0   // Hz per bin, at most
+	spectrumSmoothing  = 200.0  // Hz of the moving average of the spectrum
+	cutoffSpan         = 500.0  // Hz on either side of the cutoff
+	cutoffMinFrequency = 5000.0 // Hz
+	cutoffMinDrop      = 20.0   // dB
+	silentWindow       = 1e-8   // mean square of windows skipped as silent
+	lossyCutoff        = 20000.0
+)
+
+// sourceSampleRates are the sample rates upsampled audio is assumed to come
+// from. Lower rates are not considered, as their Nyquist frequencies are
+// those of the lowpass of lossy encoders.
+var sourceSampleRates = []uint32{44100, 48000, 88200, 96000, 176400}
+
+// AuthenticityAnalyzer detects decoded audio that is not what its format
+// claims: lossy transcodes by the cutoff of their spectrum, upsampled audio by
+// a cutoff at the Nyquist frequency of a lower sample rate, and padded audio
+// by low bits that are zero in every sample. The samples of a stream are
+// passed to Write or WriteFrame in order, and Report returns the verdict.
+type AuthenticityAnalyzer struct {
+	sampleRate uint32
+	bps        uint8
+	scale      float64
+
+	or      int32  // all samples ORed
+	nonzero uint64 // number of nonzero samples
+	wasted  uint8  // smallest wasted bits of the subframes
+	coded   bool   // seen a non-constant subframe
+
+	window  []float64
+	buf     []complex128
+	mix     []float64 // pending samples of the mix of the channels
+	power   []float64 // sum of the power spectra of the windows
+	windows int
+}
+
+// NewAuthenticityAnalyzer returns an AuthenticityAnalyzer of audio of the
+// sample rate, channels and bits per sample of info.
+func NewAuthenticityAnalyzer(info *StreamInfo) (*AuthenticityAnalyzer, error) {
+	if err := checkAudioFormat(info); err != nil {
+		return nil, err
+	}
+	n := nextPowerOfTwo(int(float64(info.SampleRate) / spectrumResolution))
+	return &AuthenticityAnalyzer{
+		sampleRate: info.SampleRate,
+		bps:        info.BitsPerSample,
+		scale:      math.Ldexp(1, 1-int(info.BitsPerSample)) / float64(info.Channels),
+		wasted:     info.BitsPerSample,
+		window:     WindowHann.coefficients(n),
+		buf:        make([]complex128, n),
+		mix:        make([]float64, 0, n),
+		power:      make([]float64, n/2+1),
+	}, nil
+}
+
+// WriteFrame analyzes the samples and subframes of a frame.
+func (a *AuthenticityAnalyzer) WriteFrame(f *Frame) {
+	for _, sf := range f.Subframes {
+		if sf.Type != SubframeTypeConstant {
+			a.wasted = min(a.wasted, sf.WastedBits)
+			a.coded = true
+		}
+	}
+	a.Write(f.Samples)
+}
+
+// Write analyzes channels of samples of the bits per sample of the stream.
+func (a *AuthenticityAnalyzer) Write(samples [][]int32) {
+	for i := range samples[0] {
+		var sum float64
+		for _, ch := range samples {
+			v := ch[i]
+			if v != 0 {
+				a.or |= v
+				a.nonzero++
+			}
+			sum += float64(v)
+		}
+		a.mix = append(a.mix, sum*a.scale)
+		if len(a.mix) == len(a.window) {
+			a.addWindow()
+		}
+	}
+}
+
+// addWindow adds the power spectrum of the pending samples, unless they are
+// silent.
+func (a *AuthenticityAnalyzer) addWindow() {
+	var sq float64
+	for _, v := range a.mix {
+		sq += v * v
+	}
+	if sq/float64(len(a.mix)) > silentWindow {
+		powerSpectrum(a.power, a.mix, a.window, a.buf)
+		a.windows++
+	}
+	a.mix = a.mix[:0]
+}
+
+// Report returns the verdict on the audio analyzed so far.
+func (a *AuthenticityAnalyzer) Report() *AuthenticityReport {
+	nyquist := float64(a.sampleRate) / 2
+	rep := &AuthenticityReport{
+		SampleRate:       a.sampleRate,
+		BitsPerSample:    a.bps,
+		CutoffFrequency:  nyquist,
+		SourceSampleRate: a.sampleRate,
+	}
+	if a.coded {
+		rep.SubframeWastedBits = a.wasted
+	}
+
+	if a.or != 0 {
+		zeros := bits.TrailingZeros32(uint32(a.or))
+		rep.EffectiveBitsPerSample = a.bps - uint8(zeros)
+		if zeros > 0 {
+			// the chance of zeros low bits in every nonzero sample of
+			// genuine audio, unless the encoder, which saw the audio
+			// before any processing of the stream, wasted them as well
+			chance := math.Pow(2, -float64(zeros)*float64(a.nonzero))
+			if a.coded && rep.SubframeWastedBits >= uint8(zeros) {
+				chance = 0
+			}
+			rep.Findings = append(rep.Findings, AuthenticityFinding{Issue: IssuePaddedBits, Confidence: 1 - chance})
+		}
+	}
+
+	if cutoff, drop, ok := a.cutoff(); ok {
+		rep.CutoffFrequency, rep.CutoffDrop = cutoff, drop
+		// 0.5 for the smallest drop detected, 1 for twice that
+		confidence := min(drop/(2*cutoffMinDrop), 1)
+		for _, rate := range sourceSampleRates {
+			if nyq := float64(rate) / 2; rate < a.sampleRate && cutoff >= 0.9*nyq && cutoff <= 1.02*nyq {
+				rep.SourceSampleRate = rate
+				rep.Findings = append(rep.Findings, AuthenticityFinding{Issue: IssueUpsampled, Confidence: confidence})
+				break
+			}
+		}
+		// the lowpass of a resampler, just below the Nyquist frequency of
+		// the source, is no sign of a lossy encoder
+		if rep.SourceSampleRate == a.sampleRate && cutoff < min(lossyCutoff, 0.9*nyquist) {
+			rep.Findings = append(rep.Findings, AuthenticityFinding{Issue: IssueLossySource, Confidence: confidence})
+		}
+	}
+
+	rep.Genuine = 1
+	for _, f := range rep.Findings {
+		rep.Genuine = min(rep.Genuine, 1-f.Confidence)
+	}
+	return rep
+}
+
+// cutoff returns the frequency and size in dB of the steepest drop of the
+// average spectrum to the noise floor, if there is one of at least
+// cutoffMinDrop.
+func (a *AuthenticityAnalyzer) cutoff() (freq, drop float64, ok bool) {
+	if a.windows == 0 {
+		return 0, 0, false
+	}
+	binHz := float64(a.sampleRate) / float64(len(a.window))
+	level := make([]float64, len(a.power))
+	for k, p := range a.power {
+		level[k] = 10 * math.Log10(p/float64(a.windows)+1e-30)
+	}
+	level = movingAverage(level, max(int(spectrumSmoothing/binHz), 1))
+
+	span := max(int(cutoffSpan/binHz), 1)
+	best := -1
+	for k := int(cutoffMinFrequency / binHz); k+span < len(level); k++ {
+		below, above := mean(level[k-span:k]), mean(level[k+1:k+1+span])
+		if d := below - above; d > drop {
+			// the spectrum must stay at the floor up to the Nyquist
+			// frequency
+			if maxOf(level[k+1+span:]) < below-cutoffMinDrop {
+				best, drop = k, d
+			}
+		}
+	}
+	if best < 0 || drop < cutoffMinDrop {
+		return 0, 0, false
+	}
+	return float64(best) * binHz, drop, true
+}
+
+// movingAverage returns the centered moving average of x over n values.
+func movingAverage(x []float64, n int) []float64 {
+	avg := make([]float64, len(x))
+	for i := range x {
+		lo, hi := max(i-n/2, 0), min(i+n/2+1, len(x))
+		avg[i] = mean(x[lo:hi])
+	}
+	return avg
+}
+
+func mean(x []float64) float64 {
+	var sum float64
+	for _, v := range x {
+		sum += v
+	}
+	return sum / float64(len(x))
+}
+
+// maxOf returns the largest value of x, or -Inf if it is empty.
+func maxOf(x []float64) float64 {
+	m := math.Inf(-1)
+	for _, v := range x {
+		m = max(m, v)
+	}
+	return m
+}
@@ -0,0 +1,155 @@
+package flac
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// noise returns n samples of white noise of the given amplitude in LSB.
+func noise(rnd *rand.Rand, n int, amp float64) []int32 {
+	return testSignal(n, func(int) int32 {
+		return int32(math.Round(amp * (2*rnd.Float64() - 1)))
+	})
+}
+
+func TestAuthenticity(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	analyze := func(info *StreamInfo, samples ...[]int32) *AuthenticityReport {
+		t.Helper()
+		a, err := NewAuthenticityAnalyzer(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.Write(samples)
+		return a.Report()
+	}
+	issues := func(rep *AuthenticityReport) []AuthenticityIssue {
+		var is []AuthenticityIssue
+		for _, f := range rep.Findings {
+			is = append(is, f.Issue)
+		}
+		return is
+	}
+	cd := &StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 16}
+
+	// full band noise is genuine
+	rep := analyze(cd, noise(rnd, 3*44100, 8000), noise(rnd, 3*44100, 8000))
+	if len(rep.Findings) != 0 || rep.Genuine != 1 || rep.CutoffFrequency != 22050 || rep.EffectiveBitsPerSample != 16 {
+		t.Errorf("noise: %+v", rep)
+	}
+
+	// the spectrum of a lossy transcode ends at the lowpass of the encoder
+	lossy := make([]float64, 3*44100)
+	for i := 0; i < 150; i++ {
+		freq, phase := 50+rnd.Float64()*15900, 2*math.Pi*rnd.Float64()
+		for j := range lossy {
+			lossy[j] += 800 * math.Sin(2*math.Pi*freq*float64(j)/44100+phase)
+		}
+	}
+	rep = analyze(&StreamInfo{SampleRate: 44100, Channels: 1, BitsPerSample: 16}, testSignal(len(lossy), func(i int) int32 {
+		return int32(math.Round(lossy[i]))
+	}))
+	if is := issues(rep); len(is) != 1 || is[0] != IssueLossySource || rep.Genuine > 0.1 {
+		t.Errorf("lossy: findings %v, report %+v", is, rep)
+	}
+	if math.Abs(rep.CutoffFrequency-16000) > 200 {
+		t.Errorf("lossy: cutoff %.0f Hz, want 16000 Hz", rep.CutoffFrequency)
+	}
+
+	// CD audio upsampled to 96 kHz ends at 22.05 kHz
+	rs, err := NewResampler(ResamplerConfig{InputRate: 44100, OutputRate: 96000, Channels: 1, BitsPerSample: 24, Quality: ResampleQualityHigh})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hires := &StreamInfo{SampleRate: 96000, Channels: 1, BitsPerSample: 24}
+	rep = analyze(hires, resampleAll(rs, noise(rnd, 3*44100, 1<<21), 4096))
+	if is := issues(rep); len(is) != 1 || is[0] != IssueUpsampled || rep.SourceSampleRate != 44100 || rep.Genuine > 0.1 {
+		t.Errorf("upsampled: findings %v, report %+v", is, rep)
+	}
+	// a resampler with its lowpass below 20 kHz is no lossy encoder
+	lowpassed := make([]float64, 3*96000)
+	for i := 0; i < 150; i++ {
+		freq, phase := 50+rnd.Float64()*19750, 2*math.Pi*rnd.Float64()
+		for j := range lowpassed {
+			lowpassed[j] += 1 << 15 * math.Sin(2*math.Pi*freq*float64(j)/96000+phase)
+		}
+	}
+	rep = analyze(hires, testSignal(len(lowpassed), func(i int) int32 {
+		return int32(math.Round(lowpassed[i]))
+	}))
+	if is := issues(rep); len(is) != 1 || is[0] != IssueUpsampled || rep.SourceSampleRate != 44100 || rep.CutoffFrequency >= lossyCutoff {
+		t.Errorf("upsampled with a 19.9 kHz lowpass: findings %v, report %+v", is, rep)
+	}
+	rep = analyze(hires, noise(rnd, 3*96000, 1<<21))
+	if len(rep.Findings) != 0 || rep.SourceSampleRate != 96000 {
+		t.Errorf("hi-res noise: %+v", rep)
+	}
+
+	// 16 bit audio padded to 24 bits, which the encoder codes with wasted
+	// bits
+	padded := noise(rnd, 3*96000, 8000)
+	for i := range padded {
+		padded[i] <<= 8
+	}
+	var stream bytes.Buffer
+	testEncode(t, &stream, hires, CompressionLevel(5), [][]int32{padded})
+	a, err := NewAuthenticityAnalyzer(hires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(bytes.NewReader(stream.Bytes()))
+	for {
+		f, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.WriteFrame(f)
+	}
+	rep = a.Report()
+	if is := issues(rep); len(is) != 1 || is[0] != IssuePaddedBits || rep.Genuine != 0 {
+		t.Errorf("padded: findings %v, report %+v", is, rep)
+	}
+	if rep.EffectiveBitsPerSample != 16 || rep.SubframeWastedBits != 8 {
+		t.Errorf("padded: %d effective bits, %d wasted bits, want 16 and 8", rep.EffectiveBitsPerSample, rep.SubframeWastedBits)
+	}
+
+	// two nonzero samples are weak evidence of padding, unless the encoder
+	// coded the zero bit as a wasted bit
+	sparse := make([]int32, 4096)
+	sparse[10], sparse[20] = 2, -4
+	rep = analyze(cd, sparse, sparse)
+	if len(rep.Findings) != 1 || rep.Findings[0].Confidence != 1-1.0/16 {
+		t.Errorf("sparse: %+v", rep)
+	}
+	stream.Reset()
+	testEncode(t, &stream, &StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 16}, CompressionLevel(5), [][]int32{sparse, sparse})
+	a, err = NewAuthenticityAnalyzer(cd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = NewReader(bytes.NewReader(stream.Bytes()))
+	for {
+		f, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.WriteFrame(f)
+	}
+	rep = a.Report()
+	if len(rep.Findings) != 1 || rep.Findings[0].Confidence != 1 || rep.SubframeWastedBits != 1 {
+		t.Errorf("sparse frames: %+v", rep)
+	}
+
+	if _, err := NewAuthenticityAnalyzer(&StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 2}); err == nil {
+		t.Error("NewAuthenticityAnalyzer accepted 2 bits per sample")
+	}
+}
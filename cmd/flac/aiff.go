@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// readAIFF reads an AIFF or uncompressed AIFF-C file up to its audio data. If
+// keepForeign is set, the other chunks of the file are kept, which requires r
+// to be seekable to read the chunks following the audio data.
+func readAIFF(r io.Reader, keepForeign bool) (*audioInput, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	form := string(header[8:])
+	if string(header[:4]) != "FORM" || (form != "AIFF" && form != "AIFC") {
+		return nil, errors.New("not an AIFF file")
+	}
+
+	in := &audioInput{format: pcmFormat{bigEndian: true}}
+	if keepForeign {
+		in.foreign = &foreignMetadata{id: "aiff", before: [][]byte{header[:]}}
+	}
+
+	var frames uint32
+	gotCommon := false
+	for {
+		var ch [8]byte
+		if _, err := io.ReadFull(r, ch[:]); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("missing SSND chunk")
+			}
+			return nil, unexpectedEOF(err)
+		}
+		id, size := string(ch[:4]), binary.BigEndian.Uint32(ch[4:])
+
+		if id == "SSND" {
+			if !gotCommon {
+				return nil, errors.New("SSND chunk before COMM chunk")
+			}
+			// <4 bytes> offset, <4 bytes> block size
+			var ssnd [8]byte
+			if _, err := io.ReadFull(r, ssnd[:]); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			offset := binary.BigEndian.Uint32(ssnd[:])
+			if _, err := io.CopyN(io.Discard, r, int64(offset)); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+
+			in.size = int64(frames) * int64(in.format.frameSize())
+			if int64(size) < 8+int64(offset)+in.size {
+				return nil, errors.New("SSND chunk is shorter than the audio data")
+			}
+			in.data = io.LimitReader(r, in.size)
+			if in.foreign != nil {
+				if int64(size) != 8+int64(offset)+in.size {
+					return nil, errors.New("cannot keep foreign metadata of an SSND chunk with data after the audio")
+				}
+				hdr := append(append(ch[:], ssnd[:]...), make([]byte, offset)...)
+				in.foreign.before = append(in.foreign.before, hdr)
+				after, err := readTrailingChunks(r, in.size, binary.BigEndian)
+				if err != nil {
+					return nil, err
+				}
+				in.foreign.after = after
+			}
+			return in, nil
+		}
+
+		chunk := make([]byte, 8+int64(size)+int64(size&1))
+		copy(chunk, ch[:])
+		if _, err := io.ReadFull(r, chunk[8:]); err != nil {
+			return nil, fmt.Errorf("%s chunk: %w", id, unexpectedEOF(err))
+		}
+		if id == "COMM" {
+			var err error
+			if frames, err = parseAIFFCommon(&in.format, chunk[8:8+size], form == "AIFC"); err != nil {
+				return nil, err
+			}
+			gotCommon = true
+		}
+		if in.foreign != nil {
+			in.foreign.before = append(in.foreign.before, chunk)
+		}
+	}
+}
+
+// parseAIFFCommon parses a COMM chunk and returns the number of sample frames.
+func parseAIFFCommon(f *pcmFormat, b []byte, aifc bool) (uint32, error) {
+	if len(b) < 18 || aifc && len(b) < 22 {
+		return 0, errors.New("COMM chunk too short")
+	}
+	f.channels = int(binary.BigEndian.Uint16(b))
+	frames := binary.BigEndian.Uint32(b[2:])
+	f.bps = int(binary.BigEndian.Uint16(b[6:]))
+	f.containerBits = (f.bps + 7) / 8 * 8
+	f.sampleRate = uint32(decodeExtended(b[8:18]))
+
+	if aifc {
+		switch compression := string(b[18:22]); compression {
+		case "NONE", "twos":
+		case "sowt":
+			f.bigEndian = false
+		default:
+			return 0, fmt.Errorf("unsupported AIFF-C compression %q", compression)
+		}
+	}
+	return frames, f.check()
+}
+
+// writeAIFFHeader writes the header of an AIFF file with dataSize bytes of
+// audio data.
+func writeAIFFHeader(w io.Writer, f *pcmFormat, dataSize int64) error {
+	formSize := 4 + 8 + 18 + 8 + 8 + dataSize + dataSize&1
+
+	b := make([]byte, 0, 12+8+18+8+8)
+	b = append(b, "FORM"...)
+	b = binary.BigEndian.AppendUint32(b, uint32(formSize))
+	b = append(b, "AIFFCOMM"...)
+	b = binary.BigEndian.AppendUint32(b, 18)
+	b = binary.BigEndian.AppendUint16(b, uint16(f.channels))
+	b = binary.BigEndian.AppendUint32(b, uint32(dataSize/int64(f.frameSize())))
+	b = binary.BigEndian.AppendUint16(b, uint16(f.bps))
+	b = appendExtended(b, f.sampleRate)
+	b = append(b, "SSND"...)
+	b = binary.BigEndian.AppendUint32(b, uint32(8+dataSize))
+	b = binary.BigEndian.AppendUint32(b, 0) // offset
+	b = binary.BigEndian.AppendUint32(b, 0) // block size
+
+	_, err := w.Write(b)
+	return err
+}
+
+// aiffFormat returns the format of the audio data of an AIFF file with
+// samples of bps bits.
+func aiffFormat(sampleRate uint32, channels, bps int) pcmFormat {
+	return pcmFormat{sampleRate: sampleRate, channels: channels, bps: bps, containerBits: (bps + 7) / 8 * 8, bigEndian: true}
+}
+
+// decodeExtended decodes an 80 bit IEEE 754 extended precision number.
+func decodeExtended(b []byte) float64 {
+	exp := int(binary.BigEndian.Uint16(b) & 0x7fff)
+	mantissa := binary.BigEndian.Uint64(b[2:])
+	v := math.Ldexp(float64(mantissa), exp-16383-63)
+	if b[0]&0x80 != 0 {
+		v = -v
+	}
+	return v
+}
+
+// appendExtended appends v as an 80 bit IEEE 754 extended precision number.
+func appendExtended(b []byte, v uint32) []byte {
+	if v == 0 {
+		return append(b, make([]byte, 10)...)
+	}
+	shift := bits.LeadingZeros64(uint64(v))
+	b = binary.BigEndian.AppendUint16(b, uint16(16383+63-shift))
+	return binary.BigEndian.AppendUint64(b, uint64(v)<<shift)
+}
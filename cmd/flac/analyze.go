@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/zachorosz/flac"
+)
+
+// analyzeOptions are the command line options for analyzing.
+type analyzeOptions struct {
+	// residualText prints every residual sample.
+	residualText bool
+	// residualGnuplot writes a gnuplot file of the residual distribution of
+	// every subframe, and of all subframes, next to the analysis.
+	residualGnuplot bool
+}
+
+// analyzeFile writes the frame and subframe parameters of the FLAC file in to
+// out in the format of the reference flac --analyze.
+func analyzeFile(in, out string, opts *analyzeOptions, force bool) (err error) {
+	src, r, _, err := openFLAC(in, flac.ErrorPolicyAbort)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := createOutput(out, force)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := dst.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	w := bufio.NewWriter(dst)
+
+	// the plots are named after the analysis they belong to, so that the
+	// plots of several input files do not overwrite each other
+	plot := out
+	if out == "-" {
+		plot = outputFile(in, "", ".ana", false)
+		if in == "-" {
+			plot = "stdin.ana"
+		}
+	}
+
+	all := make(residualHistogram)
+	for n := 0; ; n++ {
+		frame, err := r.AnalyzeFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.Flush()
+			return err
+		}
+		writeFrameAnalysis(w, n, frame, opts.residualText)
+
+		if opts.residualGnuplot {
+			for ch, sf := range frame.Subframes {
+				h := make(residualHistogram)
+				h.add(sf.Residual)
+				all.merge(h)
+				if err := h.dump(fmt.Sprintf("%s.f%06d.s%d.gp", plot, n, ch)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if opts.residualGnuplot {
+		if err := all.dump(plot + ".all.gp"); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// writeFrameAnalysis writes the parameters of the frame numbered n.
+func writeFrameAnalysis(w io.Writer, n int, frame *flac.Frame, residualText bool) {
+	fmt.Fprintf(w, "frame=%d\toffset=%d\tbits=%d\tblocksize=%d\tsample_rate=%d\tchannels=%d\tchannel_assignment=%s\n",
+		n, frame.Offset, frame.Size*8, frame.BlockSize, frame.SampleRate, len(frame.Subframes), frame.ChannelAssignment)
+
+	for ch, sf := range frame.Subframes {
+		fmt.Fprintf(w, "\tsubframe=%d\twasted_bits=%d\ttype=%s", ch, sf.WastedBits, sf.Type)
+		switch sf.Type {
+		case flac.SubframeTypeConstant:
+			fmt.Fprintf(w, "\tvalue=%d\n", sf.Value)
+			continue
+		case flac.SubframeTypeVerbatim:
+			fmt.Fprintln(w)
+			continue
+		}
+
+		rc := sf.ResidualCoding
+		residualType := "RICE"
+		if rc.Method == 1 {
+			residualType = "RICE2"
+		}
+		if sf.Type == flac.SubframeTypeLPC {
+			fmt.Fprintf(w, "\torder=%d\tqlp_coeff_precision=%d\tquantization_level=%d\tresidual_type=%s\tpartition_order=%d\n",
+				sf.Order, sf.Precision, sf.Shift, residualType, rc.PartitionOrder)
+			for i, c := range sf.Coefficients {
+				fmt.Fprintf(w, "\t\tqlp_coeff[%d]=%d\n", i, c)
+			}
+		} else {
+			fmt.Fprintf(w, "\torder=%d\tresidual_type=%s\tpartition_order=%d\n", sf.Order, residualType, rc.PartitionOrder)
+		}
+		for i, v := range sf.Warmup {
+			fmt.Fprintf(w, "\t\twarmup[%d]=%d\n", i, v)
+		}
+		for i, p := range rc.Partitions {
+			if p.Escaped {
+				fmt.Fprintf(w, "\t\tparameter[%d]=ESCAPE, raw_bits=%d\n", i, p.RawBits)
+			} else {
+				fmt.Fprintf(w, "\t\tparameter[%d]=%d\n", i, p.Parameter)
+			}
+		}
+		if residualText {
+			for i, v := range sf.Residual {
+				fmt.Fprintf(w, "\t\tresidual[%d]=%d\n", i, v)
+			}
+		}
+	}
+}
+
+// residualHistogram counts the occurrences of residual values.
+type residualHistogram map[int64]int
+
+func (h residualHistogram) add(residual []int64) {
+	for _, v := range residual {
+		h[v]++
+	}
+}
+
+func (h residualHistogram) merge(o residualHistogram) {
+	for v, n := range o {
+		h[v] += n
+	}
+}
+
+// dump writes the histogram with its mean and standard deviations as a gnuplot
+// script to the named file.
+func (h residualHistogram) dump(name string) error {
+	values := make([]int64, 0, len(h))
+	var count, peak int
+	var sum float64
+	for v, n := range h {
+		values = append(values, v)
+		count += n
+		peak = max(peak, n)
+		sum += float64(v) * float64(n)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	var mean, stddev float64
+	if count > 0 {
+		mean = sum / float64(count)
+		var sq float64
+		for v, n := range h {
+			d := float64(v) - mean
+			sq += d * d * float64(n)
+		}
+		stddev = math.Sqrt(sq / float64(count))
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprint(w, "plot '-' title 'PDF', '-' title 'mean' with impulses")
+	for i := 1; i <= 6; i++ {
+		fmt.Fprintf(w, ", '-' title '%d-stddev' with histeps, '-' notitle with histeps", i)
+	}
+	fmt.Fprintln(w)
+	for _, v := range values {
+		fmt.Fprintf(w, "%d %d\n", v, h[v])
+	}
+	fmt.Fprint(w, "e\n")
+	fmt.Fprintf(w, "%f %f\ne\n", mean, float64(peak))
+	for i := 1; i <= 6; i++ {
+		y := float64(peak) * (0.9 - 0.1*float64(i))
+		fmt.Fprintf(w, "%f %f\ne\n", mean-float64(i)*stddev, y)
+		fmt.Fprintf(w, "%f %f\ne\n", mean+float64(i)*stddev, y)
+	}
+	fmt.Fprint(w, "pause -1 'waiting...'\n")
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
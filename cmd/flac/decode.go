@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/zachorosz/flac"
+)
+
+// decodeOptions are the command line options for decoding.
+type decodeOptions struct {
+	keepForeign bool
+	forceAIFF   bool
+	forceRaw    bool
+	raw         rawOptions
+	errorPolicy flac.ErrorPolicy
+	// quantize, if set, reduces the bits per sample of the output.
+	quantize *flac.QuantizerConfig
+	// resample, if set, holds the output sample rate and quality of the
+	// conversion of the sample rate.
+	resample *flac.ResamplerConfig
+	// gain, if set, applies the stored ReplayGain to the output.
+	gain *flac.GainConfig
+}
+
+var ErrMD5Mismatch = errors.New("MD5 signature mismatch")
+
+// damagedError is returned after decoding a file with damaged frames that
+// were skipped or concealed. The decoded audio is kept.
+type damagedError struct {
+	frames int
+	policy flac.ErrorPolicy
+}
+
+func (e *damagedError) Error() string {
+	verb := "skipped"
+	if e.policy == flac.ErrorPolicyConceal {
+		verb = "concealed"
+	}
+	return fmt.Sprintf("%s %d damaged frames", verb, e.frames)
+}
+
+// openFLAC opens a FLAC file and reads its metadata blocks. Damaged frames are
+// handled according to policy, and reported unless it is ErrorPolicyAbort.
+func openFLAC(name string, policy flac.ErrorPolicy) (io.Closer, *flac.Reader, []*flac.MetadataBlock, error) {
+	src, err := openInput(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	r := flac.NewReader(src)
+	r.ErrorPolicy = policy
+	if policy != flac.ErrorPolicyAbort {
+		r.OnFrameError = func(err *flac.FrameError) {
+			fmt.Fprintf(os.Stderr, "%s: WARNING: %v\n", name, err)
+		}
+	}
+	var blocks []*flac.MetadataBlock
+	for {
+		b, err := r.ReadBlock()
+		if err != nil {
+			src.Close()
+			return nil, nil, nil, fmt.Errorf("failed to read metadata: %w", err)
+		}
+		blocks = append(blocks, b)
+		if b.Last {
+			break
+		}
+	}
+	if r.StreamInfo() == nil {
+		src.Close()
+		return nil, nil, nil, errors.New("missing STREAMINFO block")
+	}
+	return src, r, blocks, nil
+}
+
+// decodeFile decodes the FLAC file in to the WAVE, AIFF or raw audio file out.
+func decodeFile(in, out string, opts *decodeOptions, force bool) (err error) {
+	src, r, blocks, err := openFLAC(in, opts.errorPolicy)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info := r.StreamInfo()
+	var foreign *foreignMetadata
+	if opts.keepForeign {
+		foreign = findForeignMetadata(blocks)
+	}
+
+	channels, bps, sampleRate := int(info.Channels), int(info.BitsPerSample), info.SampleRate
+	totalSamples := info.TotalSamples
+	stage := new(outputStage)
+	if opts.gain != nil {
+		if foreign != nil {
+			return errors.New("cannot restore foreign metadata with --apply-replaygain")
+		}
+		var vc *flac.VorbisComment
+		for _, b := range blocks {
+			if vc, _ = b.Data.(*flac.VorbisComment); vc != nil {
+				break
+			}
+		}
+		if g, ok := flac.ParseReplayGain(vc); ok {
+			stage.gain = g.Scale(*opts.gain)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: WARNING: no ReplayGain or R128 gain tags, decoding without gain\n", in)
+		}
+	}
+	if opts.resample != nil {
+		if foreign != nil {
+			return errors.New("cannot restore foreign metadata with --output-sample-rate")
+		}
+		config := *opts.resample
+		config.InputRate, config.Channels, config.BitsPerSample = info.SampleRate, info.Channels, info.BitsPerSample
+		if stage.rs, err = flac.NewResampler(config); err != nil {
+			return err
+		}
+		sampleRate, totalSamples = config.OutputRate, stage.rs.OutputLength(info.TotalSamples)
+	}
+	if opts.quantize != nil {
+		if foreign != nil {
+			return errors.New("cannot restore foreign metadata with --output-bps")
+		}
+		stage.q = flac.NewQuantizer(*opts.quantize)
+		bps = int(opts.quantize.BitsPerSample)
+	}
+	var format pcmFormat
+	var writeHeader func(w io.Writer, f *pcmFormat, dataSize int64) error
+	raw := false
+	switch {
+	case foreign != nil:
+		if format, err = foreign.format(); err != nil {
+			return err
+		}
+		if format.sampleRate != sampleRate || format.channels != channels || format.bps != bps {
+			return errors.New("foreign metadata does not match the audio format")
+		}
+	case opts.forceRaw:
+		ro := opts.raw
+		ro.channels, ro.bps, ro.sampleRate = channels, bps, int(sampleRate)
+		if format, err = ro.format(); err != nil {
+			return err
+		}
+		raw = true
+	case opts.forceAIFF || isAIFFName(out):
+		format, writeHeader = aiffFormat(sampleRate, channels, bps), writeAIFFHeader
+	default:
+		format, writeHeader = wavFormat(sampleRate, channels, bps), writeWAVHeader
+	}
+
+	dst, err := createOutput(out, force)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := dst.Close(); err == nil {
+			err = cerr
+		}
+		var damaged *damagedError
+		if err != nil && !errors.As(err, &damaged) && out != "-" {
+			os.Remove(out)
+		}
+	}()
+	w := bufio.NewWriter(dst)
+
+	dataSize := int64(totalSamples) * int64(format.frameSize())
+	switch {
+	case foreign != nil:
+		for _, chunk := range foreign.before {
+			w.Write(chunk)
+		}
+		if size, ok := foreign.audioSize(); !ok || size != dataSize {
+			return errors.New("foreign metadata does not match the audio data")
+		}
+	case !raw:
+		if err := writeHeader(w, &format, dataSize); err != nil {
+			return err
+		}
+	}
+
+	n, decodeErr := decodeAudio(r, w, &format, stage)
+	if clipped := stage.totalClipped(); clipped > 0 {
+		fmt.Fprintf(os.Stderr, "%s: WARNING: %d samples clipped\n", in, clipped)
+	}
+	var damaged *damagedError
+	if decodeErr != nil && !errors.As(decodeErr, &damaged) {
+		return decodeErr
+	}
+	if !raw && n&1 != 0 {
+		w.WriteByte(0) // chunk padding
+	}
+	if foreign != nil {
+		if n != dataSize && damaged == nil {
+			return errors.New("foreign metadata does not match the audio data")
+		}
+		for _, chunk := range foreign.after {
+			w.Write(chunk)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	// rewrite the header of a stream of unknown length
+	if writeHeader != nil && n != dataSize {
+		f, ok := dst.(*os.File)
+		if !ok {
+			return errors.New("cannot rewrite the header for the actual audio size")
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("cannot rewrite the header for the actual audio size: %w", err)
+		}
+		if err := writeHeader(f, &format, n); err != nil {
+			return err
+		}
+	}
+	return decodeErr
+}
+
+// testFile decodes the FLAC file in without writing the audio.
+func testFile(in string, policy flac.ErrorPolicy) error {
+	src, r, _, err := openFLAC(in, policy)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info := r.StreamInfo()
+	format := wavFormat(info.SampleRate, int(info.Channels), int(info.BitsPerSample))
+	_, err = decodeAudio(r, nil, &format, nil)
+	return err
+}
+
+// decodeAudio decodes the audio frames of r into PCM audio of format f
+// written to w, or discarded if w is nil, and returns the number of bytes of
+// audio. If stage is not nil, it converts the audio to the sample rate and
+// bits per sample of f. The decoded audio is checked against the MD5
+// signature of STREAMINFO, unless it is unset or frames were damaged, in which
+// case a *damagedError is returned after decoding the rest.
+func decodeAudio(r *flac.Reader, w io.Writer, f *pcmFormat, stage *outputStage) (int64, error) {
+	info := r.StreamInfo()
+	md5 := flac.NewAudioMD5(info.BitsPerSample)
+
+	damaged := 0
+	report := r.OnFrameError
+	r.OnFrameError = func(err *flac.FrameError) {
+		damaged++
+		if report != nil {
+			report(err)
+		}
+	}
+
+	var n int64
+	var buf []byte
+	write := func(samples [][]int32) error {
+		if w != nil {
+			buf = f.pack(buf[:0], samples)
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+		}
+		n += int64(len(samples[0]) * f.frameSize())
+		return nil
+	}
+
+	var decoded uint64
+	for {
+		frame, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		if len(frame.Samples) != f.channels || frame.BitsPerSample != info.BitsPerSample {
+			return n, fmt.Errorf("frame %d does not match the STREAMINFO format", frame.Number)
+		}
+		md5.Write(frame.Samples)
+		decoded += uint64(frame.BlockSize)
+
+		samples := frame.Samples
+		if stage != nil {
+			samples = stage.convert(samples, info.BitsPerSample)
+		}
+		if err := write(samples); err != nil {
+			return n, err
+		}
+	}
+	if stage != nil && stage.rs != nil {
+		if err := write(stage.flush(info.BitsPerSample)); err != nil {
+			return n, err
+		}
+	}
+
+	if damaged > 0 {
+		return n, &damagedError{frames: damaged, policy: r.ErrorPolicy}
+	}
+	if info.TotalSamples != 0 && decoded != info.TotalSamples {
+		return n, fmt.Errorf("decoded %d samples, STREAMINFO has %d", decoded, info.TotalSamples)
+	}
+	if !bytes.Equal(info.MD5, make([]byte, 16)) && !bytes.Equal(info.MD5, md5.Sum()) {
+		return n, ErrMD5Mismatch
+	}
+	return n, nil
+}
+
+// outputStage converts decoded audio for the output file: it applies a gain,
+// converts the sample rate and reduces the bits per sample, each if set.
+type outputStage struct {
+	gain    float64 // factor of the samples, or 0 for none
+	rs      *flac.Resampler
+	q       *flac.Quantizer
+	clipped uint64 // samples clipped by the gain
+}
+
+// convert converts the channels of samples of bps bits of a frame.
+func (s *outputStage) convert(samples [][]int32, bps uint8) [][]int32 {
+	if s.gain != 0 {
+		s.clipped += uint64(flac.ApplyGain(samples, bps, s.gain))
+	}
+	if s.rs != nil {
+		samples = s.rs.Resample(samples)
+	}
+	if s.q != nil {
+		s.q.Quantize(samples, bps)
+	}
+	return samples
+}
+
+// flush returns the samples held back by the resampler at the end of the
+// stream.
+func (s *outputStage) flush(bps uint8) [][]int32 {
+	samples := s.rs.Flush()
+	if s.q != nil {
+		s.q.Quantize(samples, bps)
+	}
+	return samples
+}
+
+// totalClipped returns the number of samples clipped by all conversions.
+func (s *outputStage) totalClipped() uint64 {
+	n := s.clipped
+	if s.rs != nil {
+		n += s.rs.Clipped()
+	}
+	if s.q != nil {
+		n += s.q.Clipped()
+	}
+	return n
+}
+
+// findForeignMetadata returns the foreign metadata stored in the APPLICATION
+// blocks of a FLAC file, or nil if there is none.
+func findForeignMetadata(blocks []*flac.MetadataBlock) *foreignMetadata {
+	var f *foreignMetadata
+	audio := false // seen the audio data chunk header
+	for _, b := range blocks {
+		app, ok := b.Data.(*flac.Application)
+		if !ok || (app.ID != "riff" && app.ID != "aiff") {
+			continue
+		}
+		if f == nil {
+			f = &foreignMetadata{id: app.ID}
+		}
+		if audio {
+			f.after = append(f.after, app.Data)
+			continue
+		}
+		f.before = append(f.before, app.Data)
+		_, audio = f.audioSize()
+	}
+	if f == nil || !audio || len(f.before[0]) != 12 {
+		return nil
+	}
+	return f
+}
+
+// audioSize returns the size of the audio data from the header of the audio
+// data chunk, which is the last chunk before the audio.
+func (f *foreignMetadata) audioSize() (int64, bool) {
+	if len(f.before) < 2 {
+		return 0, false
+	}
+	hdr := f.before[len(f.before)-1]
+	switch {
+	case f.id == "riff" && len(hdr) == 8 && string(hdr[:4]) == "data":
+		return int64(binary.LittleEndian.Uint32(hdr[4:])), true
+	case f.id == "aiff" && len(hdr) >= 16 && string(hdr[:4]) == "SSND":
+		return int64(binary.BigEndian.Uint32(hdr[4:])) - int64(len(hdr)) + 8, true
+	}
+	return 0, false
+}
+
+// format returns the format of the audio data from the format chunk of the
+// foreign metadata.
+func (f *foreignMetadata) format() (pcmFormat, error) {
+	for _, chunk := range f.before[1:] {
+		if len(chunk) < 8 {
+			continue
+		}
+		body := chunk[8:]
+		switch id := string(chunk[:4]); {
+		case f.id == "riff" && id == "fmt ":
+			var format pcmFormat
+			if size := binary.LittleEndian.Uint32(chunk[4:]); int(size) <= len(body) {
+				body = body[:size]
+			}
+			return format, parseWAVFormat(&format, body)
+		case f.id == "aiff" && id == "COMM":
+			format := pcmFormat{bigEndian: true}
+			if size := binary.BigEndian.Uint32(chunk[4:]); int(size) <= len(body) {
+				body = body[:size]
+			}
+			_, err := parseAIFFCommon(&format, body, string(f.before[0][8:]) == "AIFC")
+			return format, err
+		}
+	}
+	return pcmFormat{}, errors.New("foreign metadata has no format chunk")
+}
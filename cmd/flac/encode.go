@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zachorosz/flac"
+)
+
+// encodeOptions are the command line options for encoding.
+type encodeOptions struct {
+	config      flac.EncoderConfig
+	keepForeign bool
+	forceRaw    bool
+	raw         rawOptions
+	// padding is the size of the PADDING block, or 0 for none.
+	padding int
+	// seekSeconds is the spacing of seek points, or 0 for no SEEKTABLE.
+	seekSeconds int
+	tags        []string
+}
+
+// encodeFile encodes the WAVE, AIFF or raw audio file in to the FLAC file out
+// and returns the size of the audio data read and of the FLAC file written.
+func encodeFile(in, out string, opts *encodeOptions, force bool) (inSize, outSize int64, err error) {
+	src, err := openInput(in)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer src.Close()
+
+	audio, err := readAudioInput(src, in, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	info := &flac.StreamInfo{
+		SampleRate:    audio.format.sampleRate,
+		Channels:      uint8(audio.format.channels),
+		BitsPerSample: uint8(audio.format.bps),
+		TotalSamples:  audio.totalSamples(),
+	}
+	blocks, err := encodeMetadata(audio, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	dst, err := createOutput(out, force)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if cerr := dst.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil && out != "-" {
+			os.Remove(out)
+		}
+	}()
+
+	e, err := flac.NewEncoder(dst, info, opts.config, blocks...)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	const chunkFrames = 4096
+	frameSize := audio.format.frameSize()
+	buf := make([]byte, chunkFrames*frameSize)
+	samples := make([][]int32, audio.format.channels)
+	for ch := range samples {
+		samples[ch] = make([]int32, chunkFrames)
+	}
+	for {
+		n, rerr := io.ReadFull(audio.data, buf)
+		if n%frameSize != 0 {
+			return 0, 0, errors.New("audio data ends with a partial sample")
+		}
+		if n > 0 {
+			block := make([][]int32, len(samples))
+			for ch := range samples {
+				block[ch] = samples[ch][:n/frameSize]
+			}
+			audio.format.unpack(buf[:n], block)
+			if err := e.Write(block); err != nil {
+				return 0, 0, err
+			}
+			inSize += int64(n)
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return 0, 0, rerr
+		}
+	}
+	if audio.size >= 0 && inSize != audio.size {
+		return 0, 0, fmt.Errorf("audio data ends after %d of %d bytes: %w", inSize, audio.size, io.ErrUnexpectedEOF)
+	}
+
+	if err := e.Close(); err != nil {
+		return 0, 0, err
+	}
+	if f, ok := dst.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			outSize = fi.Size()
+		}
+	}
+	return inSize, outSize, nil
+}
+
+// readAudioInput reads the header of the audio input, detecting its format
+// from its name or its first bytes.
+func readAudioInput(src io.Reader, name string, opts *encodeOptions) (*audioInput, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if opts.forceRaw || ext == ".raw" {
+		if opts.keepForeign {
+			return nil, errors.New("raw audio has no foreign metadata to keep")
+		}
+		format, err := opts.raw.format()
+		if err != nil {
+			return nil, err
+		}
+		return &audioInput{format: format, data: src, size: -1}, nil
+	}
+
+	// peek at the magic number, then rewind or put it back in front
+	var magic [4]byte
+	if _, err := io.ReadFull(src, magic[:]); err != nil {
+		return nil, fmt.Errorf("cannot detect input format: %w", unexpectedEOF(err))
+	}
+	if s, ok := src.(io.Seeker); ok && name != "-" {
+		if _, err := s.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	} else {
+		src = io.MultiReader(bytes.NewReader(magic[:]), src)
+	}
+
+	switch string(magic[:]) {
+	case "RIFF":
+		return readWAV(src, opts.keepForeign)
+	case "FORM":
+		return readAIFF(src, opts.keepForeign)
+	case "fLaC":
+		return nil, errors.New("input is already a FLAC file")
+	}
+	return nil, errors.New("unknown input format, use --force-raw-format for raw audio")
+}
+
+// encodeMetadata returns the metadata blocks to write after STREAMINFO.
+func encodeMetadata(audio *audioInput, opts *encodeOptions) ([]*flac.MetadataBlock, error) {
+	vc := &flac.VorbisComment{Vendor: vendorString}
+	for _, tag := range opts.tags {
+		field, value, ok := strings.Cut(tag, "=")
+		if !ok || field == "" {
+			return nil, fmt.Errorf("invalid tag %q, expected FIELD=VALUE", tag)
+		}
+		vc.Add(field, value)
+	}
+	blocks := []*flac.MetadataBlock{{
+		MetadataBlockHeader: flac.MetadataBlockHeader{Type: flac.MetadataBlockTypeVorbisComment},
+		Data:                vc,
+	}}
+
+	if total := audio.totalSamples(); opts.seekSeconds > 0 && total > 0 {
+		table := new(flac.SeekTable)
+		table.AppendSpacedPointsBySamples(uint64(opts.seekSeconds)*uint64(audio.format.sampleRate), total)
+		blocks = append(blocks, &flac.MetadataBlock{
+			MetadataBlockHeader: flac.MetadataBlockHeader{Type: flac.MetadataBlockTypeSeekTable},
+			Data:                table,
+		})
+	}
+
+	if f := audio.foreign; f != nil {
+		for _, chunk := range append(f.before, f.after...) {
+			blocks = append(blocks, &flac.MetadataBlock{
+				MetadataBlockHeader: flac.MetadataBlockHeader{Type: flac.MetadataBlockTypeApplication},
+				Data:                &flac.Application{ID: f.id, Data: chunk},
+			})
+		}
+	}
+
+	if opts.padding > 0 {
+		blocks = append(blocks, &flac.MetadataBlock{
+			MetadataBlockHeader: flac.MetadataBlockHeader{Type: flac.MetadataBlockTypePadding, Length: uint32(opts.padding)},
+		})
+	}
+	return blocks, nil
+}
+
+// openInput opens the input file, or standard input for "-".
+func openInput(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(name)
+}
+
+// createOutput creates the output file, or returns standard output for "-".
+// An existing file is only overwritten if force is set.
+func createOutput(name string, force bool) (io.WriteCloser, error) {
+	if name == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(name, flags, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("output file %s already exists, use -f to overwrite", name)
+	}
+	return f, err
+}
+
+// nopWriteCloser keeps standard output open and seekable as far as the
+// encoder can tell.
+type nopWriteCloser struct {
+	*os.File
+}
+
+func (nopWriteCloser) Close() error { return nil }
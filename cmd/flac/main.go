@@ -0,0 +1,502 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/zachorosz/flac"
+)
+
+func help(w io.Writer) {
+	fmt.Fprintln(w, `Usage:
+    flac [options] [infile.wav | infile.aiff | infile.raw | -]...
+    flac -d [options] [infile.flac | -]...
+    flac -t [options] [infile.flac | -]...
+    flac -a [options] [infile.flac | -]...
+
+Encode WAVE, AIFF or raw audio to FLAC, decode FLAC to WAVE, AIFF or raw
+audio, test FLAC files, or analyze their frames. A "-" reads standard input
+and writes standard output. The exit status is 1 if any file failed.
+
+Options:
+    -d, --decode
+        Decode FLAC files to WAVE, or to AIFF if the output name ends in
+        .aif or .aiff.
+    -t, --test
+        Decode FLAC files without writing the audio and check the MD5
+        signature.
+    -a, --analyze
+        Write the frame and subframe parameters of FLAC files to a .ana
+        file.
+    -F, --decode-through-errors
+        When decoding or testing, replace damaged frames with silence and
+        continue. Same as --error-policy=conceal.
+    --error-policy={abort|skip|conceal}
+        How damaged frames, whose CRCs do not match or which fail to decode,
+        are handled when decoding or testing: stop with an error (the
+        default), drop them, or replace them with silence. With skip and
+        conceal, every damaged frame is reported with its sample number and
+        byte offset, the decoded audio is kept, and the exit status is 1.
+    -c, --stdout
+        Write the output to standard output.
+    -o FILE, --output-name=FILE
+        Name of the output file. Only valid with a single input file.
+    -f, --force
+        Overwrite existing output files.
+    -s, --silent
+        Only print errors.
+    --keep-foreign-metadata
+        When encoding, store the non-audio chunks of WAVE and AIFF files in
+        APPLICATION blocks. When decoding, restore the original file from
+        them.
+    --force-aiff-format
+        Decode to AIFF.
+    --force-raw-format
+        Treat the input as raw audio when encoding, or decode to raw audio.
+        Requires --endian and --sign, and --channels, --bps and --sample-rate
+        when encoding.
+    --endian={big|little}
+    --sign={signed|unsigned}
+    --channels=N
+    --bps=N
+    --sample-rate=N
+        The format of raw audio.
+
+Encoding options:
+    -0 ... -8, --fast, --best
+        Compression level, from fastest (-0, --fast) to smallest (-8,
+        --best). The default is -5.
+    -b N, --blocksize=N
+        Block size in samples.
+    --variable-blocksize
+        End blocks early, in steps of an eighth of the block size, before
+        transients in the audio, and code the frames with the
+        variable-blocksize strategy.
+    -l N, --max-lpc-order=N
+        Largest LPC predictor order, 0 for FIXED predictors only.
+    -m, --mid-side, -M, --adaptive-mid-side
+        Try stereo decorrelation of 2 channel audio.
+    -e, --exhaustive-model-search
+        Encode every LPC order and keep the smallest.
+    -q N, --qlp-coeff-precision=N
+        Precision of the quantized LPC coefficients, 0 to choose from the
+        block size.
+    -r [MIN,]MAX, --rice-partition-order=[MIN,]MAX
+        Largest Rice partition order.
+    -T FIELD=VALUE, --tag=FIELD=VALUE
+        Add a Vorbis comment. May be repeated.
+    -P N, --padding=N
+        Size of the PADDING block in bytes. The default is 8192.
+    --no-padding
+        Do not write a PADDING block.
+    --no-seektable
+        Do not write a SEEKTABLE block. By default there is a seek point
+        every 10 seconds.
+
+Decoding options:
+    --output-bps=N
+        Reduce the audio to N bits per sample, e.g. 24 bit masters to 16
+        bit. Samples are rounded, and clipped samples are reported.
+    --dither
+        With --output-bps, add TPDF dither before rounding.
+    --noise-shaping={none|first-order|wannamaker|lipshitz}
+        With --output-bps, shape the requantization noise with a first order
+        highpass, the 3 tap F-weighted filter of Wannamaker or the 5 tap
+        E-weighted filter of Lipshitz et al. The default is none.
+    --dither-seed=N
+        Seed of the dither, for reproducible output. The default is 0.
+    --output-sample-rate=N
+        Convert the audio to a sample rate of N Hz, e.g. 96 kHz masters to
+        44.1 or 48 kHz.
+    --resample-quality={low|medium|high}
+        With --output-sample-rate, the quality of the resampling filter. Low
+        passes 80% of the bandwidth and attenuates aliases by 60 dB, medium
+        90% and 96 dB, and high 95% and 140 dB. The default is medium.
+    --apply-replaygain={track|album}
+        Apply the track or album gain stored in the REPLAYGAIN_* or R128_*
+        Vorbis comments. The other gain is used if the one asked for is
+        missing. The gain is lowered so that the stored peak does not clip.
+    --replaygain-preamp=DB
+        With --apply-replaygain, add DB decibels to the stored gain.
+    --replaygain-allow-clipping
+        With --apply-replaygain, do not lower the gain for the stored peak.
+
+Analysis options:
+    --residual-text
+        Include every residual sample in the analysis.
+    --residual-gnuplot
+        Write the residual distribution of every subframe to a gnuplot file
+        <output>.fNNNNNN.sN.gp, and of all subframes to <output>.all.gp,
+        where <output> is the name of the .ana file.`)
+}
+
+// vendorString is the vendor of VORBIS_COMMENT blocks created by flac.
+const vendorString = "github.com/zachorosz/flac"
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format, args...)
+	os.Exit(1)
+}
+
+// stringsFlag is a flag that may be repeated to collect a list of values.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+func main() {
+	var (
+		decode, test, analyze, stdout, force, silent bool
+		outputName, errorPolicy                      string
+		decodeThroughErrors                          bool
+		level                                        = 5
+		blockSize, maxLPCOrder                       int
+		midSide, exhaustive, variableBlockSize       bool
+		precision                                    int
+		partitionOrder                               string
+		tags                                         stringsFlag
+		padding                                      = 8192
+		noPadding, noSeekTable                       bool
+		keepForeign, forceAIFF, forceRaw             bool
+		raw                                          rawOptions
+		analyzeOpts                                  analyzeOptions
+		outputBps, ditherSeed, outputSampleRate      int
+		dither                                       bool
+		noiseShaping, resampleQuality                string
+		applyReplayGain, replayGainPreamp            string
+		replayGainAllowClipping                      bool
+	)
+
+	flags := flag.NewFlagSet("flac", flag.ExitOnError)
+	flags.Usage = func() { help(os.Stderr) }
+	boolVar := func(p *bool, names ...string) {
+		for _, name := range names {
+			flags.BoolVar(p, name, false, "")
+		}
+	}
+	intVar := func(p *int, names ...string) {
+		for _, name := range names {
+			flags.IntVar(p, name, *p, "")
+		}
+	}
+	stringVar := func(p *string, names ...string) {
+		for _, name := range names {
+			flags.StringVar(p, name, "", "")
+		}
+	}
+
+	boolVar(&decode, "d", "decode")
+	boolVar(&test, "t", "test")
+	boolVar(&analyze, "a", "analyze")
+	boolVar(&decodeThroughErrors, "F", "decode-through-errors")
+	stringVar(&errorPolicy, "error-policy")
+	boolVar(&stdout, "c", "stdout")
+	boolVar(&force, "f", "force")
+	boolVar(&silent, "s", "silent")
+	stringVar(&outputName, "o", "output-name")
+	for i := 0; i <= 8; i++ {
+		i := i
+		flags.BoolFunc(strconv.Itoa(i), "", func(string) error { level = i; return nil })
+		flags.BoolFunc(fmt.Sprintf("compression-level-%d", i), "", func(string) error { level = i; return nil })
+	}
+	flags.BoolFunc("fast", "", func(string) error { level = 0; return nil })
+	flags.BoolFunc("best", "", func(string) error { level = 8; return nil })
+	intVar(&blockSize, "b", "blocksize")
+	intVar(&maxLPCOrder, "l", "max-lpc-order")
+	boolVar(&midSide, "m", "mid-side", "M", "adaptive-mid-side")
+	boolVar(&exhaustive, "e", "exhaustive-model-search")
+	boolVar(&variableBlockSize, "variable-blocksize")
+	intVar(&precision, "q", "qlp-coeff-precision")
+	stringVar(&partitionOrder, "r", "rice-partition-order")
+	flags.Var(&tags, "T", "")
+	flags.Var(&tags, "tag", "")
+	intVar(&padding, "P", "padding")
+	boolVar(&noPadding, "no-padding")
+	boolVar(&noSeekTable, "no-seektable")
+	boolVar(&keepForeign, "keep-foreign-metadata")
+	boolVar(&forceAIFF, "force-aiff-format")
+	boolVar(&forceRaw, "force-raw-format")
+	stringVar(&raw.endian, "endian")
+	stringVar(&raw.sign, "sign")
+	intVar(&raw.channels, "channels")
+	intVar(&raw.bps, "bps")
+	intVar(&raw.sampleRate, "sample-rate")
+	intVar(&outputBps, "output-bps")
+	boolVar(&dither, "dither")
+	stringVar(&noiseShaping, "noise-shaping")
+	intVar(&ditherSeed, "dither-seed")
+	intVar(&outputSampleRate, "output-sample-rate")
+	stringVar(&resampleQuality, "resample-quality")
+	stringVar(&applyReplayGain, "apply-replaygain")
+	stringVar(&replayGainPreamp, "replaygain-preamp")
+	boolVar(&replayGainAllowClipping, "replaygain-allow-clipping")
+	boolVar(&analyzeOpts.residualText, "residual-text")
+	boolVar(&analyzeOpts.residualGnuplot, "residual-gnuplot")
+
+	// options may follow the input files, as with the reference flac
+	var inputs []string
+	for args := os.Args[1:]; ; {
+		flags.Parse(args)
+		rest := flags.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			inputs = append(inputs, rest...)
+			break
+		}
+		inputs = append(inputs, rest[0])
+		args = rest[1:]
+	}
+	if len(inputs) == 0 {
+		help(os.Stderr)
+		os.Exit(1)
+	}
+	if decode && test || decode && analyze || test && analyze {
+		fatalf("flac: only one of -d, -t and -a may be given\n")
+	}
+	if outputName != "" && len(inputs) > 1 {
+		fatalf("flac: -o may only be used with a single input file\n")
+	}
+
+	// the compression level sets the defaults of the individual options
+	config := flac.CompressionLevel(level)
+	var flagErr error
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "b", "blocksize":
+			if blockSize < 16 || blockSize > 65535 {
+				flagErr = fmt.Errorf("invalid block size %d", blockSize)
+			}
+			config.BlockSize = uint16(blockSize)
+		case "variable-blocksize":
+			config.VariableBlockSize = variableBlockSize
+		case "l", "max-lpc-order":
+			config.MaxLPCOrder = maxLPCOrder
+		case "m", "mid-side", "M", "adaptive-mid-side":
+			config.MidSide = midSide
+		case "e", "exhaustive-model-search":
+			config.ExhaustiveModelSearch = exhaustive
+		case "q", "qlp-coeff-precision":
+			config.LPCPrecision = uint8(precision)
+		case "r", "rice-partition-order":
+			_, max, _ := strings.Cut(partitionOrder, ",")
+			if max == "" {
+				max = partitionOrder
+			}
+			n, err := strconv.Atoi(max)
+			if err != nil {
+				flagErr = fmt.Errorf("invalid rice partition order %q", partitionOrder)
+			}
+			config.MaxPartitionOrder = n
+		}
+	})
+	if flagErr != nil {
+		fatalf("flac: %v\n", flagErr)
+	}
+	if noPadding {
+		padding = 0
+	}
+	policy := flac.ErrorPolicyAbort
+	switch {
+	case decodeThroughErrors:
+		policy = flac.ErrorPolicyConceal
+	case errorPolicy != "":
+		var ok bool
+		if policy, ok = parseErrorPolicy(errorPolicy); !ok {
+			fatalf("flac: invalid error policy %q\n", errorPolicy)
+		}
+	}
+	encodeOpts := &encodeOptions{
+		config:      config,
+		keepForeign: keepForeign,
+		forceRaw:    forceRaw,
+		raw:         raw,
+		padding:     padding,
+		seekSeconds: 10,
+		tags:        tags,
+	}
+	if noSeekTable {
+		encodeOpts.seekSeconds = 0
+	}
+	decodeOpts := &decodeOptions{
+		keepForeign: keepForeign,
+		forceAIFF:   forceAIFF,
+		forceRaw:    forceRaw,
+		raw:         raw,
+		errorPolicy: policy,
+	}
+	switch {
+	case outputBps != 0:
+		if outputBps < 4 || outputBps > 32 {
+			fatalf("flac: invalid output bits per sample %d\n", outputBps)
+		}
+		shaping := flac.NoiseShapingNone
+		if noiseShaping != "" {
+			var ok bool
+			if shaping, ok = parseNoiseShaping(noiseShaping); !ok {
+				fatalf("flac: invalid noise shaping %q\n", noiseShaping)
+			}
+		}
+		decodeOpts.quantize = &flac.QuantizerConfig{
+			BitsPerSample: uint8(outputBps),
+			Dither:        dither,
+			NoiseShaping:  shaping,
+			Seed:          int64(ditherSeed),
+		}
+	case dither || noiseShaping != "":
+		fatalf("flac: --dither and --noise-shaping require --output-bps\n")
+	}
+	switch {
+	case outputSampleRate != 0:
+		if outputSampleRate < 1 || outputSampleRate > 1<<20-1 {
+			fatalf("flac: invalid output sample rate %d\n", outputSampleRate)
+		}
+		quality := flac.ResampleQualityMedium
+		if resampleQuality != "" {
+			var ok bool
+			if quality, ok = parseResampleQuality(resampleQuality); !ok {
+				fatalf("flac: invalid resample quality %q\n", resampleQuality)
+			}
+		}
+		decodeOpts.resample = &flac.ResamplerConfig{OutputRate: uint32(outputSampleRate), Quality: quality}
+	case resampleQuality != "":
+		fatalf("flac: --resample-quality requires --output-sample-rate\n")
+	}
+	switch {
+	case applyReplayGain != "":
+		mode, ok := parseGainMode(applyReplayGain)
+		if !ok {
+			fatalf("flac: invalid ReplayGain mode %q\n", applyReplayGain)
+		}
+		decodeOpts.gain = &flac.GainConfig{Mode: mode, PreventClipping: !replayGainAllowClipping}
+		if replayGainPreamp != "" {
+			preamp, err := strconv.ParseFloat(replayGainPreamp, 64)
+			if err != nil {
+				fatalf("flac: invalid ReplayGain preamp %q\n", replayGainPreamp)
+			}
+			decodeOpts.gain.Preamp = preamp
+		}
+	case replayGainPreamp != "" || replayGainAllowClipping:
+		fatalf("flac: --replaygain-preamp and --replaygain-allow-clipping require --apply-replaygain\n")
+	}
+
+	ok := true
+	for _, in := range inputs {
+		var err error
+		switch {
+		case test:
+			if err = testFile(in, policy); err == nil && !silent {
+				fmt.Fprintf(os.Stderr, "%s: ok\n", in)
+			}
+		case analyze:
+			out := outputFile(in, outputName, ".ana", stdout)
+			if err = analyzeFile(in, out, &analyzeOpts, force); err == nil && !silent && out != "-" {
+				fmt.Fprintf(os.Stderr, "%s: done\n", in)
+			}
+		case decode:
+			ext := ".wav"
+			switch {
+			case forceRaw:
+				ext = ".raw"
+			case forceAIFF:
+				ext = ".aiff"
+			}
+			out := outputFile(in, outputName, ext, stdout)
+			if err = decodeFile(in, out, decodeOpts, force); err == nil && !silent {
+				fmt.Fprintf(os.Stderr, "%s: done\n", in)
+			}
+		default:
+			out := outputFile(in, outputName, ".flac", stdout)
+			var inSize, outSize int64
+			if inSize, outSize, err = encodeFile(in, out, encodeOpts, force); err == nil && !silent {
+				if outSize > 0 && inSize > 0 {
+					fmt.Fprintf(os.Stderr, "%s: wrote %d bytes, ratio=%.3f\n", in, outSize, float64(outSize)/float64(inSize))
+				} else {
+					fmt.Fprintf(os.Stderr, "%s: done\n", in)
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: ERROR: %v\n", in, err)
+			ok = false
+		}
+	}
+
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// outputFile returns the name of the output file for the input file in: the
+// name given with -o, "-" for standard output, or in with its extension
+// replaced by ext.
+func outputFile(in, outputName, ext string, stdout bool) string {
+	switch {
+	case outputName != "":
+		return outputName
+	case stdout || in == "-":
+		return "-"
+	}
+	return strings.TrimSuffix(in, filepath.Ext(in)) + ext
+}
+
+// parseErrorPolicy parses the value of --error-policy.
+func parseErrorPolicy(s string) (flac.ErrorPolicy, bool) {
+	for _, p := range []flac.ErrorPolicy{flac.ErrorPolicyAbort, flac.ErrorPolicySkip, flac.ErrorPolicyConceal} {
+		if s == p.String() {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// parseNoiseShaping parses the value of --noise-shaping.
+func parseNoiseShaping(s string) (flac.NoiseShaping, bool) {
+	for _, ns := range []flac.NoiseShaping{flac.NoiseShapingNone, flac.NoiseShapingFirstOrder, flac.NoiseShapingWannamaker, flac.NoiseShapingLipshitz} {
+		if s == ns.String() {
+			return ns, true
+		}
+	}
+	return 0, false
+}
+
+// parseResampleQuality parses the value of --resample-quality.
+func parseResampleQuality(s string) (flac.ResampleQuality, bool) {
+	for _, q := range []flac.ResampleQuality{flac.ResampleQualityLow, flac.ResampleQualityMedium, flac.ResampleQualityHigh} {
+		if s == q.String() {
+			return q, true
+		}
+	}
+	return 0, false
+}
+
+// parseGainMode parses the value of --apply-replaygain.
+func parseGainMode(s string) (flac.GainMode, bool) {
+	for _, m := range []flac.GainMode{flac.GainModeTrack, flac.GainModeAlbum} {
+		if s == m.String() {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
+// isAIFFName reports whether the file name has an AIFF extension.
+func isAIFFName(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".aif", ".aiff", ".aifc":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// pcmFormat describes interleaved PCM audio data.
+type pcmFormat struct {
+	sampleRate uint32
+	channels   int
+	// bps is the number of significant bits of each sample.
+	bps int
+	// containerBits is the size of a sample in bits, a multiple of 8. Samples
+	// with fewer significant bits are left-justified.
+	containerBits int
+	bigEndian     bool
+	unsigned      bool
+}
+
+func (f *pcmFormat) bytesPerSample() int {
+	return f.containerBits / 8
+}
+
+// frameSize is the size in bytes of one sample of every channel.
+func (f *pcmFormat) frameSize() int {
+	return f.channels * f.bytesPerSample()
+}
+
+func (f *pcmFormat) check() error {
+	switch {
+	case f.sampleRate == 0:
+		return errors.New("invalid sample rate 0")
+	case f.channels < 1 || f.channels > 8:
+		return fmt.Errorf("unsupported number of channels %d", f.channels)
+	case f.bps < 4 || f.bps > 32:
+		return fmt.Errorf("unsupported bits per sample %d", f.bps)
+	case f.containerBits < f.bps || f.containerBits%8 != 0 || f.containerBits > 32:
+		return fmt.Errorf("unsupported sample size of %d bits", f.containerBits)
+	}
+	return nil
+}
+
+// unpack decodes the whole frames of p into samples, which must hold
+// len(p)/f.frameSize() samples per channel.
+func (f *pcmFormat) unpack(p []byte, samples [][]int32) {
+	size := f.bytesPerSample()
+	shift := f.containerBits - f.bps
+	for i := range samples[0] {
+		for ch := range samples {
+			b := p[(i*f.channels+ch)*size:][:size]
+
+			var u uint32
+			for j := 0; j < size; j++ {
+				if f.bigEndian {
+					u = u<<8 | uint32(b[j])
+				} else {
+					u |= uint32(b[j]) << (8 * j)
+				}
+			}
+			if f.unsigned {
+				u ^= 1 << (f.containerBits - 1)
+			}
+			// sign extend and drop the padding bits
+			v := int32(u<<(32-f.containerBits)) >> (32 - f.containerBits)
+			samples[ch][i] = v >> shift
+		}
+	}
+}
+
+// pack appends the samples interleaved to p.
+func (f *pcmFormat) pack(p []byte, samples [][]int32) []byte {
+	size := f.bytesPerSample()
+	shift := f.containerBits - f.bps
+	for i := range samples[0] {
+		for ch := range samples {
+			u := uint32(samples[ch][i] << shift)
+			if f.unsigned {
+				u ^= 1 << (f.containerBits - 1)
+			}
+			for j := 0; j < size; j++ {
+				if f.bigEndian {
+					p = append(p, byte(u>>(8*(size-1-j))))
+				} else {
+					p = append(p, byte(u>>(8*j)))
+				}
+			}
+		}
+	}
+	return p
+}
+
+// audioInput is the PCM audio of an input file.
+type audioInput struct {
+	format pcmFormat
+	// data reads the audio data.
+	data io.Reader
+	// size is the size of the audio data in bytes, or -1 if it is unknown and
+	// the data extends to the end of the input.
+	size int64
+	// foreign holds the chunks of the input container other than the audio
+	// data, if requested.
+	foreign *foreignMetadata
+}
+
+// totalSamples returns the number of samples per channel, or 0 if unknown.
+func (a *audioInput) totalSamples() uint64 {
+	if a.size < 0 {
+		return 0
+	}
+	return uint64(a.size) / uint64(a.format.frameSize())
+}
+
+// rawOptions are the command line options describing raw PCM audio.
+type rawOptions struct {
+	endian     string
+	sign       string
+	channels   int
+	bps        int
+	sampleRate int
+}
+
+// format returns the PCM format described by the options.
+func (o *rawOptions) format() (pcmFormat, error) {
+	f := pcmFormat{
+		sampleRate:    uint32(o.sampleRate),
+		channels:      o.channels,
+		bps:           o.bps,
+		containerBits: (o.bps + 7) / 8 * 8,
+	}
+	switch o.endian {
+	case "big":
+		f.bigEndian = true
+	case "little":
+	default:
+		return f, errors.New("raw audio requires --endian=big or --endian=little")
+	}
+	switch o.sign {
+	case "signed":
+	case "unsigned":
+		f.unsigned = true
+	default:
+		return f, errors.New("raw audio requires --sign=signed or --sign=unsigned")
+	}
+	if o.channels == 0 || o.bps == 0 || o.sampleRate == 0 {
+		return f, errors.New("raw audio requires --channels, --bps and --sample-rate")
+	}
+	return f, f.check()
+}
+
+// foreignMetadata holds the non-audio parts of a WAVE or AIFF file, stored in
+// APPLICATION blocks so the file can be restored exactly.
+type foreignMetadata struct {
+	// id is the APPLICATION id of the blocks: "riff" or "aiff".
+	id string
+	// before holds the container header, the chunks before the audio data and
+	// the header of the audio data chunk; after holds the chunks following the
+	// audio data.
+	before, after [][]byte
+}
+
+// readTrailingChunks reads the chunks following dataSize bytes of audio data
+// in a RIFF or IFF file and seeks back to the audio data.
+func readTrailingChunks(r io.Reader, dataSize int64, order binary.ByteOrder) ([][]byte, error) {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok || dataSize < 0 {
+		return nil, errors.New("keeping foreign metadata requires a seekable input with a known audio data size")
+	}
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rs.Seek(dataSize+dataSize&1, io.SeekCurrent); err != nil {
+		return nil, err
+	}
+
+	var chunks [][]byte
+	for {
+		var ch [8]byte
+		if _, err := io.ReadFull(rs, ch[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("chunk after audio data: %w", unexpectedEOF(err))
+		}
+		size := int64(order.Uint32(ch[4:]))
+		chunk := make([]byte, 8+size+size&1)
+		copy(chunk, ch[:])
+		if _, err := io.ReadFull(rs, chunk[8:]); err != nil {
+			return nil, fmt.Errorf("%s chunk: %w", ch[:4], unexpectedEOF(err))
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	_, err = rs.Seek(start, io.SeekStart)
+	return chunks, err
+}
+
+// unexpectedEOF turns io.EOF into io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	waveFormatPCM        = 0x0001
+	waveFormatExtensible = 0xfffe
+)
+
+// waveChannelMasks are the WAVE_FORMAT_EXTENSIBLE speaker masks of the FLAC
+// channel orders of 1 through 8 channels.
+var waveChannelMasks = [...]uint32{1: 0x4, 2: 0x3, 3: 0x7, 4: 0x33, 5: 0x37, 6: 0x3f, 7: 0x70f, 8: 0x63f}
+
+// readWAV reads a WAVE file up to its audio data. If keepForeign is set, the
+// other chunks of the file are kept, which requires r to be seekable to read
+// the chunks following the audio data.
+func readWAV(r io.Reader, keepForeign bool) (*audioInput, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:]) != "WAVE" {
+		return nil, errors.New("not a WAVE file")
+	}
+
+	in := new(audioInput)
+	if keepForeign {
+		in.foreign = &foreignMetadata{id: "riff", before: [][]byte{header[:]}}
+	}
+
+	gotFormat := false
+	for {
+		var ch [8]byte
+		if _, err := io.ReadFull(r, ch[:]); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("missing data chunk")
+			}
+			return nil, unexpectedEOF(err)
+		}
+		id, size := string(ch[:4]), binary.LittleEndian.Uint32(ch[4:])
+
+		if id == "data" {
+			if !gotFormat {
+				return nil, errors.New("data chunk before fmt chunk")
+			}
+			in.size = int64(size)
+			in.data = io.LimitReader(r, in.size)
+			if size == 0xffffffff { // streamed, size unknown
+				in.size = -1
+				in.data = r
+			}
+			if in.foreign != nil {
+				in.foreign.before = append(in.foreign.before, ch[:])
+				after, err := readTrailingChunks(r, in.size, binary.LittleEndian)
+				if err != nil {
+					return nil, err
+				}
+				in.foreign.after = after
+			}
+			return in, nil
+		}
+
+		chunk := make([]byte, 8+int64(size)+int64(size&1))
+		copy(chunk, ch[:])
+		if _, err := io.ReadFull(r, chunk[8:]); err != nil {
+			return nil, fmt.Errorf("%s chunk: %w", id, unexpectedEOF(err))
+		}
+		if id == "fmt " {
+			if err := parseWAVFormat(&in.format, chunk[8:8+size]); err != nil {
+				return nil, err
+			}
+			gotFormat = true
+		}
+		if in.foreign != nil {
+			in.foreign.before = append(in.foreign.before, chunk)
+		}
+	}
+}
+
+func parseWAVFormat(f *pcmFormat, b []byte) error {
+	if len(b) < 16 {
+		return errors.New("fmt chunk too short")
+	}
+	tag := binary.LittleEndian.Uint16(b)
+	f.channels = int(binary.LittleEndian.Uint16(b[2:]))
+	f.sampleRate = binary.LittleEndian.Uint32(b[4:])
+	blockAlign := int(binary.LittleEndian.Uint16(b[12:]))
+	f.bps = int(binary.LittleEndian.Uint16(b[14:]))
+
+	switch {
+	case tag == waveFormatExtensible && len(b) >= 40:
+		if sub := binary.LittleEndian.Uint16(b[24:]); sub != waveFormatPCM {
+			return fmt.Errorf("unsupported WAVE sub-format %#x", sub)
+		}
+		if valid := int(binary.LittleEndian.Uint16(b[18:])); valid != 0 {
+			f.bps = valid
+		}
+	case tag != waveFormatPCM:
+		return fmt.Errorf("unsupported WAVE format %#x, only PCM is supported", tag)
+	}
+
+	if f.channels == 0 {
+		return errors.New("fmt chunk has 0 channels")
+	}
+	f.containerBits = blockAlign / f.channels * 8
+	f.unsigned = f.containerBits == 8
+	return f.check()
+}
+
+// writeWAVHeader writes the header of a WAVE file with dataSize bytes of audio
+// data.
+func writeWAVHeader(w io.Writer, f *pcmFormat, dataSize int64) error {
+	extensible := f.channels > 2 || (f.bps != 8 && f.bps != 16)
+
+	fmtSize := 16
+	if extensible {
+		fmtSize = 40
+	}
+	riffSize := 4 + 8 + int64(fmtSize) + 8 + dataSize + dataSize&1
+
+	b := make([]byte, 0, 12+8+fmtSize+8)
+	b = append(b, "RIFF"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(riffSize))
+	b = append(b, "WAVEfmt "...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(fmtSize))
+	if extensible {
+		b = binary.LittleEndian.AppendUint16(b, waveFormatExtensible)
+	} else {
+		b = binary.LittleEndian.AppendUint16(b, waveFormatPCM)
+	}
+	b = binary.LittleEndian.AppendUint16(b, uint16(f.channels))
+	b = binary.LittleEndian.AppendUint32(b, f.sampleRate)
+	b = binary.LittleEndian.AppendUint32(b, f.sampleRate*uint32(f.frameSize()))
+	b = binary.LittleEndian.AppendUint16(b, uint16(f.frameSize()))
+	b = binary.LittleEndian.AppendUint16(b, uint16(f.containerBits))
+	if extensible {
+		b = binary.LittleEndian.AppendUint16(b, 22)
+		b = binary.LittleEndian.AppendUint16(b, uint16(f.bps))
+		b = binary.LittleEndian.AppendUint32(b, waveChannelMasks[f.channels])
+		// KSDATAFORMAT_SUBTYPE_PCM
+		b = append(b, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71)
+	}
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(dataSize))
+
+	_, err := w.Write(b)
+	return err
+}
+
+// wavFormat returns the format of the audio data of a WAVE file with samples
+// of bps bits.
+func wavFormat(sampleRate uint32, channels, bps int) pcmFormat {
+	f := pcmFormat{sampleRate: sampleRate, channels: channels, bps: bps, containerBits: (bps + 7) / 8 * 8}
+	f.unsigned = f.containerBits == 8
+	return f
+}
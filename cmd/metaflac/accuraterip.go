@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/zachorosz/flac"
+)
+
+// The --accuraterip --format=json document. Field names are part of the
+// output format and must not change.
+
+type jsonRipChecksums struct {
+	File    string              `json:"file"`
+	DiscID  string              `json:"disc_id"`
+	Path    string              `json:"path"`
+	CopyCRC string              `json:"copy_crc"`
+	Tracks  []jsonTrackChecksum `json:"tracks"`
+}
+
+type jsonTrackChecksum struct {
+	TrackNumber   uint8              `json:"track_number"`
+	Start         uint64             `json:"start"`
+	Length        uint64             `json:"length"`
+	AccurateRipV1 string             `json:"accuraterip_v1"`
+	AccurateRipV2 string             `json:"accuraterip_v2"`
+	CopyCRC       string             `json:"copy_crc"`
+	Verified      *jsonVerifiedTrack `json:"verified,omitempty"`
+}
+
+type jsonVerifiedTrack struct {
+	Confidence int  `json:"confidence"`
+	V1         bool `json:"v1"`
+	V2         bool `json:"v2"`
+	Entries    int  `json:"entries"`
+}
+
+func hexCRC(crc uint32) string {
+	return fmt.Sprintf("%08X", crc)
+}
+
+// readAccurateRipDatabase reads a local AccurateRip database file.
+func readAccurateRipDatabase(path string) ([]flac.AccurateRipEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return flac.ReadAccurateRipDatabase(f)
+}
+
+// accurateRipFile writes the AccurateRip disc ID and the checksums of the tracks
+// of a CD rip as text or JSON. With verify, the tracks are verified against
+// the database entries, and an error is returned for tracks that do not
+// match.
+func accurateRipFile(w io.Writer, path string, entries []flac.AccurateRipEntry, verify, asJSON bool) error {
+	var c *flac.RipChecker
+	err := analyzeFile(path, func(si *flac.StreamInfo, blocks []*flac.MetadataBlock) (frameWriter, error) {
+		for _, b := range blocks {
+			if cs, ok := b.Data.(*flac.CueSheet); ok {
+				var err error
+				c, err = flac.NewRipChecker(si, cs)
+				return c, err
+			}
+		}
+		return nil, errors.New("file has no CUESHEET block")
+	})
+	if err != nil {
+		return err
+	}
+	sums := c.Checksums()
+	var results []flac.AccurateRipResult
+	inaccurate := 0
+	if verify {
+		results = sums.Verify(entries)
+		for _, r := range results {
+			if r.Confidence == 0 {
+				inaccurate++
+			}
+		}
+	}
+	if err := writeRipChecksums(w, path, sums, results, asJSON); err != nil {
+		return err
+	}
+	if inaccurate > 0 {
+		return fmt.Errorf("%d of %d tracks not accurately ripped", inaccurate, len(results))
+	}
+	return nil
+}
+
+// writeRipChecksums writes the checksums and verification results of a CD
+// rip as text or JSON.
+func writeRipChecksums(w io.Writer, path string, sums *flac.RipChecksums, results []flac.AccurateRipResult, asJSON bool) error {
+	if asJSON {
+		j := &jsonRipChecksums{
+			File:    path,
+			DiscID:  sums.DiscID.String(),
+			Path:    sums.DiscID.Path(),
+			CopyCRC: hexCRC(sums.CopyCRC),
+			Tracks:  []jsonTrackChecksum{},
+		}
+		for i, t := range sums.Tracks {
+			jt := jsonTrackChecksum{
+				TrackNumber:   t.TrackNumber,
+				Start:         t.Start,
+				Length:        t.Length,
+				AccurateRipV1: hexCRC(t.AccurateRipV1),
+				AccurateRipV2: hexCRC(t.AccurateRipV2),
+				CopyCRC:       hexCRC(t.CopyCRC),
+			}
+			if results != nil {
+				v := jsonVerifiedTrack(results[i])
+				jt.Verified = &v
+			}
+			j.Tracks = append(j.Tracks, jt)
+		}
+		return json.NewEncoder(w).Encode(j)
+	}
+
+	fmt.Fprintf(w, "%s: AccurateRip disc ID %s, copy CRC %s\n", path, sums.DiscID, hexCRC(sums.CopyCRC))
+	for i, t := range sums.Tracks {
+		fmt.Fprintf(w, "  track %2d: AccurateRip v1 %s, v2 %s, copy CRC %s", t.TrackNumber, hexCRC(t.AccurateRipV1), hexCRC(t.AccurateRipV2), hexCRC(t.CopyCRC))
+		if results != nil {
+			switch r := results[i]; {
+			case r.Entries == 0:
+				fmt.Fprint(w, ", not in database")
+			case r.Confidence == 0:
+				fmt.Fprintf(w, ", not accurate (%d entries)", r.Entries)
+			case r.V2:
+				fmt.Fprintf(w, ", accurate v2 (confidence %d)", r.Confidence)
+			default:
+				fmt.Fprintf(w, ", accurate v1 (confidence %d)", r.Confidence)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
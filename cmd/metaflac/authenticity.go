@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/zachorosz/flac"
+)
+
+// The --detect-fake --format=json document. Field names are part of the
+// output format and must not change.
+
+type jsonAuthenticityReport struct {
+	File                   string                    `json:"file"`
+	SampleRate             uint32                    `json:"sample_rate"`
+	BitsPerSample          uint8                     `json:"bits_per_sample"`
+	CutoffFrequency        float64                   `json:"cutoff_frequency"`
+	CutoffDrop             float64                   `json:"cutoff_drop"`
+	SourceSampleRate       uint32                    `json:"source_sample_rate"`
+	EffectiveBitsPerSample uint8                     `json:"effective_bits_per_sample"`
+	SubframeWastedBits     uint8                     `json:"subframe_wasted_bits"`
+	Findings               []jsonAuthenticityFinding `json:"findings"`
+	Genuine                float64                   `json:"genuine"`
+}
+
+type jsonAuthenticityFinding struct {
+	Issue      string  `json:"issue"`
+	Confidence float64 `json:"confidence"`
+}
+
+func newJSONAuthenticityReport(file string, rep *flac.AuthenticityReport) *jsonAuthenticityReport {
+	j := &jsonAuthenticityReport{
+		File:                   file,
+		SampleRate:             rep.SampleRate,
+		BitsPerSample:          rep.BitsPerSample,
+		CutoffFrequency:        rep.CutoffFrequency,
+		CutoffDrop:             rep.CutoffDrop,
+		SourceSampleRate:       rep.SourceSampleRate,
+		EffectiveBitsPerSample: rep.EffectiveBitsPerSample,
+		SubframeWastedBits:     rep.SubframeWastedBits,
+		Findings:               []jsonAuthenticityFinding{},
+		Genuine:                rep.Genuine,
+	}
+	for _, f := range rep.Findings {
+		j.Findings = append(j.Findings, jsonAuthenticityFinding{Issue: f.Issue.String(), Confidence: f.Confidence})
+	}
+	return j
+}
+
+// detectFake writes the authenticity verdict of a FLAC file as text or JSON.
+func detectFake(w io.Writer, path string, asJSON bool) error {
+	var a *flac.AuthenticityAnalyzer
+	err := analyzeFile(path, func(si *flac.StreamInfo, _ []*flac.MetadataBlock) (frameWriter, error) {
+		var err error
+		a, err = flac.NewAuthenticityAnalyzer(si)
+		return a, err
+	})
+	if err != nil {
+		return err
+	}
+	rep := a.Report()
+	if asJSON {
+		return json.NewEncoder(w).Encode(newJSONAuthenticityReport(path, rep))
+	}
+
+	fmt.Fprintf(w, "%s: %.0f%% genuine\n", path, 100*rep.Genuine)
+	fmt.Fprintf(w, "  cutoff: %.0f Hz", rep.CutoffFrequency)
+	if rep.CutoffDrop > 0 {
+		fmt.Fprintf(w, " (%.1f dB drop)", rep.CutoffDrop)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "  effective bits per sample: %d of %d\n", rep.EffectiveBitsPerSample, rep.BitsPerSample)
+	for _, f := range rep.Findings {
+		fmt.Fprintf(w, "  %s: %.0f%% confidence", f.Issue, 100*f.Confidence)
+		switch f.Issue {
+		case flac.IssueUpsampled:
+			fmt.Fprintf(w, ", from %d Hz", rep.SourceSampleRate)
+		case flac.IssuePaddedBits:
+			fmt.Fprintf(w, ", %d wasted bits in subframes", rep.SubframeWastedBits)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// batch runs an operation over many files concurrently. Output is written in
+// the order of the files and failures are reported per file.
+type batch struct {
+	out             *bufio.Writer
+	stderr          io.Writer
+	jobs            int
+	continueOnError bool
+
+	failed map[string]bool // files that failed
+}
+
+// run calls fn for every file, on up to b.jobs goroutines. The output fn writes
+// to w is copied to b.out in file order, followed by an error report if fn
+// fails. Files are started at most 2*b.jobs files ahead of the output, so a
+// slow file holds back the others instead of their output piling up. Unless
+// b.continueOnError is set, no further files are started once a file fails;
+// the files already started are finished and reported, as they may have been
+// modified. run reports whether all files succeeded.
+func (b *batch) run(files []string, fn func(w io.Writer, i int) error) bool {
+	type result struct {
+		out bytes.Buffer
+		err error
+	}
+	// results[i] receives the result of file i, or is closed if file i is
+	// not started
+	results := make([]chan *result, len(files))
+	for i := range results {
+		results[i] = make(chan *result, 1)
+	}
+
+	jobs := max(b.jobs, 1)
+	slots := make(chan struct{}, 2*jobs) // files started and not yet written out
+	next := make(chan int)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	go func() {
+		defer close(next)
+		for i := range files {
+			select {
+			case slots <- struct{}{}:
+				select {
+				case next <- i:
+					continue
+				case <-stop:
+					<-slots
+				}
+			case <-stop:
+			}
+			for _, c := range results[i:] {
+				close(c)
+			}
+			return
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for n := 0; n < jobs; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				select {
+				case <-stop:
+					<-slots
+					close(results[i])
+					continue
+				default:
+				}
+				r := new(result)
+				r.err = fn(&r.out, i)
+				if r.err != nil && !b.continueOnError {
+					stopOnce.Do(func() { close(stop) })
+				}
+				results[i] <- r
+			}
+		}()
+	}
+
+	ok := true
+	for i, file := range files {
+		r, started := <-results[i]
+		if !started {
+			continue
+		}
+		<-slots
+		b.out.Write(r.out.Bytes())
+		if r.err != nil {
+			ok = false
+			b.fail(file)
+			b.out.Flush()
+			fmt.Fprintf(b.stderr, "%s: %v\n", file, r.err)
+		}
+	}
+	wg.Wait()
+
+	return ok
+}
+
+// fail records that file failed.
+func (b *batch) fail(file string) {
+	if b.failed == nil {
+		b.failed = make(map[string]bool)
+	}
+	b.failed[file] = true
+}
+
+// summary reports the number of failed files out of total, if any failed.
+func (b *batch) summary(total int) {
+	if len(b.failed) > 0 {
+		b.out.Flush()
+		fmt.Fprintf(b.stderr, "metaflac: %d of %d files failed\n", len(b.failed), total)
+	}
+}
+
+// expandFiles returns the files to process for the command line arguments.
+// Directories are walked for .flac files if recursive is set.
+func expandFiles(args []string, recursive bool) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil || !fi.IsDir() {
+			// errors are reported when the file is processed
+			files = append(files, arg)
+			continue
+		}
+		if !recursive {
+			return nil, fmt.Errorf("%s: is a directory (use --recursive)", arg)
+		}
+
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// report unreadable entries as failed files, but keep walking
+				files = append(files, path)
+				return nil
+			}
+			if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".flac") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
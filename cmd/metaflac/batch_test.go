@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBatch returns a batch writing to out and stderr.
+func testBatch(jobs int, continueOnError bool) (b *batch, out, stderr *strings.Builder) {
+	out, stderr = new(strings.Builder), new(strings.Builder)
+	return &batch{out: bufio.NewWriter(out), stderr: stderr, jobs: jobs, continueOnError: continueOnError}, out, stderr
+}
+
+func testFiles(n int) []string {
+	files := make([]string, n)
+	for i := range files {
+		files[i] = fmt.Sprintf("f%d", i)
+	}
+	return files
+}
+
+func TestBatchOrder(t *testing.T) {
+	b, out, stderr := testBatch(4, false)
+	files := testFiles(20)
+	ok := b.run(files, func(w io.Writer, i int) error {
+		// later files finish first
+		time.Sleep(time.Duration(len(files)-i) * time.Millisecond)
+		fmt.Fprintln(w, files[i])
+		return nil
+	})
+	b.out.Flush()
+	if want := strings.Join(files, "\n") + "\n"; !ok || out.String() != want || stderr.Len() != 0 {
+		t.Errorf("ok %v, output %q, errors %q", ok, out, stderr)
+	}
+}
+
+func TestBatchStop(t *testing.T) {
+	// no file is started after a failure
+	b, out, stderr := testBatch(1, false)
+	ok := b.run(testFiles(3), func(w io.Writer, i int) error {
+		fmt.Fprintf(w, "f%d\n", i)
+		return errors.New("boom")
+	})
+	b.out.Flush()
+	if ok || out.String() != "f0\n" || stderr.String() != "f0: boom\n" {
+		t.Errorf("ok %v, output %q, errors %q", ok, out, stderr)
+	}
+
+	// while a file is slow, the others run ahead by a bounded number of
+	// files, and stop at a failure, but every file started is reported
+	b, out, stderr = testBatch(4, false)
+	files := testFiles(100)
+	var mu sync.Mutex
+	var started []int
+	ok = b.run(files, func(w io.Writer, i int) error {
+		mu.Lock()
+		started = append(started, i)
+		mu.Unlock()
+		fmt.Fprintf(w, "f%d\n", i)
+		switch i {
+		case 0:
+			time.Sleep(50 * time.Millisecond)
+		case 3:
+			return errors.New("boom")
+		}
+		return nil
+	})
+	b.out.Flush()
+	if ok || len(started) > 2*b.jobs {
+		t.Errorf("ok %v with files %v started", ok, started)
+	}
+	for _, i := range started {
+		if !strings.Contains(out.String(), fmt.Sprintf("f%d\n", i)) {
+			t.Errorf("file %d started but not reported in %q", i, out)
+		}
+	}
+	if stderr.String() != "f3: boom\n" || !reflect.DeepEqual(b.failed, map[string]bool{"f3": true}) {
+		t.Errorf("errors %q, failed %v", stderr, b.failed)
+	}
+}
+
+func TestBatchContinueOnError(t *testing.T) {
+	b, out, stderr := testBatch(3, true)
+	files := testFiles(10)
+	ok := b.run(files, func(w io.Writer, i int) error {
+		fmt.Fprintf(w, "f%d\n", i)
+		if i%3 == 0 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	b.summary(len(files))
+	if want := strings.Join(files, "\n") + "\n"; ok || out.String() != want {
+		t.Errorf("ok %v, output %q", ok, out)
+	}
+	if want := "f0: boom\nf3: boom\nf6: boom\nf9: boom\nmetaflac: 4 of 10 files failed\n"; stderr.String() != want {
+		t.Errorf("errors %q, want %q", stderr, want)
+	}
+}
+
+func TestExpandFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.flac", "b.FLAC", "c.mp3", "sub/d.flac"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := expandFiles([]string{"x.flac", dir}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"x.flac", filepath.Join(dir, "a.flac"), filepath.Join(dir, "b.FLAC"), filepath.Join(dir, "sub/d.flac")}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("expandFiles = %q, want %q", files, want)
+	}
+	if _, err := expandFiles([]string{dir}, false); err == nil {
+		t.Error("expandFiles accepted a directory without recursive")
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/zachorosz/flac"
+)
+
+const (
+	cdSampleRate    = 44100
+	cdLeadInSamples = 2 * cdSampleRate // the 2 second CD-DA lead-in
+	cdLeadOutTrack  = 170
+	leadOutTrack    = 255
+)
+
+// parseCueSheet parses a cue sheet file for a stream described by streamInfo.
+// The cue sheet must refer to a single file. Index times are given either as
+// mm:ss:ff times or as sample numbers. The lead-out track is added at the end
+// of the stream, and the result must pass CueSheet.Validate.
+func parseCueSheet(rd io.Reader, streamInfo *flac.StreamInfo) (*flac.CueSheet, error) {
+	if streamInfo.TotalSamples == 0 {
+		return nil, errors.New("cannot import a cue sheet because STREAMINFO block does not specify total samples")
+	}
+
+	cueSheet := new(flac.CueSheet)
+	var (
+		track   *flac.CueSheetTrack
+		files   int
+		hasCDDA = streamInfo.SampleRate == cdSampleRate && streamInfo.BitsPerSample == 16 && streamInfo.Channels <= 2
+	)
+
+	sc := bufio.NewScanner(rd)
+	for line := 1; sc.Scan(); line++ {
+		fields := splitCueLine(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		err := func() error {
+			switch cmd := strings.ToUpper(fields[0]); cmd {
+			case "CATALOG":
+				if len(fields) != 2 {
+					return errors.New("CATALOG must be a 13 digit number")
+				}
+				catalog, err := flac.ParseMCN(fields[1])
+				if err != nil {
+					return errors.New("CATALOG must be a 13 digit number")
+				}
+				cueSheet.CatalogNumber = catalog
+			case "FILE":
+				if files++; files > 1 {
+					return errors.New("only cue sheets with a single FILE are supported")
+				}
+			case "TRACK":
+				if len(fields) != 3 {
+					return errors.New("expected TRACK number type")
+				}
+				n, err := strconv.ParseUint(fields[1], 10, 8)
+				if err != nil || n == 0 || n >= cdLeadOutTrack {
+					return fmt.Errorf("invalid track number %q", fields[1])
+				}
+				if track != nil && uint64(track.TrackNumber) >= n {
+					return errors.New("track numbers must be increasing")
+				}
+				if track != nil && len(track.Indices) == 0 {
+					return fmt.Errorf("track %d has no INDEX", track.TrackNumber)
+				}
+				track = &flac.CueSheetTrack{
+					TrackNumber: uint8(n),
+					IsAudio:     strings.EqualFold(fields[2], "AUDIO"),
+				}
+				cueSheet.Tracks = append(cueSheet.Tracks, track)
+			case "FLAGS", "ISRC", "INDEX":
+				if track == nil {
+					return fmt.Errorf("%s before the first TRACK", cmd)
+				}
+				switch cmd {
+				case "FLAGS":
+					for _, flag := range fields[1:] {
+						if strings.EqualFold(flag, "PRE") {
+							track.PreEmphasis = true
+						}
+					}
+				case "ISRC":
+					if len(fields) != 2 {
+						return errors.New("expected ISRC code")
+					}
+					isrc, err := flac.ParseISRC(fields[1])
+					if err != nil {
+						return err
+					}
+					track.ISRC = isrc
+				case "INDEX":
+					return parseCueIndex(track, fields[1:], streamInfo.SampleRate)
+				}
+			case "PREGAP", "POSTGAP":
+				return fmt.Errorf("%s is not supported", cmd)
+			default:
+				// REM, TITLE, PERFORMER and the like are not stored in a CUESHEET
+			}
+			return nil
+		}()
+		if err != nil {
+			return nil, fmt.Errorf("cue sheet line %d: %w", line, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(cueSheet.Tracks) == 0 {
+		return nil, errors.New("cue sheet has no tracks")
+	}
+	if len(track.Indices) == 0 {
+		return nil, fmt.Errorf("track %d has no INDEX", track.TrackNumber)
+	}
+
+	cueSheet.IsCD = cueSheet.CatalogNumber != "" || hasCDDA
+
+	leadOut := &flac.CueSheetTrack{TrackNumber: leadOutTrack, OffsetSamples: streamInfo.TotalSamples}
+	if cueSheet.IsCD {
+		cueSheet.NumLeadInSamples = cdLeadInSamples
+		leadOut.TrackNumber = cdLeadOutTrack
+	}
+	cueSheet.Tracks = append(cueSheet.Tracks, leadOut)
+
+	if vs := cueSheet.Validate(streamInfo); len(vs) > 0 {
+		return nil, vs[0]
+	}
+	return cueSheet, nil
+}
+
+// parseCueIndex parses the arguments of an INDEX command and adds the index
+// point to track. The first index of a track sets the track offset.
+func parseCueIndex(track *flac.CueSheetTrack, args []string, sampleRate uint32) error {
+	if len(args) != 2 {
+		return errors.New("expected INDEX number time")
+	}
+	n, err := strconv.ParseUint(args[0], 10, 8)
+	if err != nil || n > 99 {
+		return fmt.Errorf("invalid index number %q", args[0])
+	}
+
+	var offset uint64
+	if strings.Contains(args[1], ":") {
+		offset, err = parseCueTime(args[1], sampleRate)
+	} else {
+		offset, err = strconv.ParseUint(args[1], 10, 64)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid index time %q: %w", args[1], err)
+	}
+
+	if len(track.Indices) == 0 {
+		if n > 1 {
+			return errors.New("first index number must be 0 or 1")
+		}
+		track.OffsetSamples = offset
+	} else {
+		last := track.Indices[len(track.Indices)-1]
+		if n != uint64(last.PointNumber)+1 {
+			return errors.New("index numbers must be sequential")
+		}
+		if offset <= track.OffsetSamples+last.OffsetSamples {
+			return errors.New("index offsets must be increasing")
+		}
+	}
+	track.Indices = append(track.Indices, &flac.CueSheetTrackIndex{
+		OffsetSamples: offset - track.OffsetSamples,
+		PointNumber:   uint8(n),
+	})
+	return nil
+}
+
+// parseCueTime parses a mm:ss:ff time, where ff are 1/75 second CD-DA frames,
+// and returns it as a sample number.
+func parseCueTime(s string, sampleRate uint32) (uint64, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, errors.New("expected mm:ss:ff")
+	}
+	var v [3]uint64
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return 0, errors.New("expected mm:ss:ff")
+		}
+		v[i] = n
+	}
+	if v[1] >= 60 || v[2] >= 75 {
+		return 0, errors.New("seconds or frames out of range")
+	}
+	return ((v[0]*60+v[1])*75 + v[2]) * uint64(sampleRate) / 75, nil
+}
+
+// splitCueLine splits a cue sheet line into fields. Double quoted fields may
+// contain spaces.
+func splitCueLine(line string) []string {
+	var fields []string
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return fields
+		}
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return append(fields, line[1:])
+			}
+			fields = append(fields, line[1:end+1])
+			line = line[end+2:]
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			return append(fields, line)
+		}
+		fields = append(fields, line[:end])
+		line = line[end:]
+	}
+}
+
+// importCueSheet adds a CUESHEET block parsed from the cue sheet in cuePath to
+// a FLAC file. Unless noSeekPoints is set, a seek point is also added at every
+// track and index.
+func importCueSheet(path, cuePath string, noSeekPoints bool) error {
+	f, err := openFLACFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if f.blockData(flac.MetadataBlockTypeCueSheet) != nil {
+		return errors.New("file already has a CUESHEET block")
+	}
+
+	cue, err := os.Open(cuePath)
+	if err != nil {
+		return err
+	}
+	defer cue.Close()
+	cueSheet, err := parseCueSheet(cue, f.streamInfo())
+	if err != nil {
+		return fmt.Errorf("%s: %w", cuePath, err)
+	}
+	f.insertBlock(flac.MetadataBlockTypeCueSheet, cueSheet)
+
+	if !noSeekPoints {
+		var templates []seekPointTemplate
+		for _, t := range cueSheet.Tracks[:len(cueSheet.Tracks)-1] { // except the lead-out
+			for _, x := range t.Indices {
+				templates = append(templates, seekPointTemplate{sample: t.OffsetSamples + x.OffsetSamples})
+			}
+		}
+		if err := f.addSeekPoints(templates); err != nil {
+			return err
+		}
+	}
+
+	return f.save()
+}
+
+// exportCueSheets exports the CUESHEET blocks of files to the cue sheet file
+// target, or to standard output if target is "-".
+func exportCueSheets(b *batch, files []string, target string) bool {
+	return b.run(files, func(w io.Writer, i int) error {
+		if target == "-" {
+			return exportCueSheet(w, files[i])
+		}
+
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if err := exportCueSheet(out, files[i]); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
+
+// exportCueSheet writes the CUESHEET block of a FLAC file to w as a cue sheet.
+func exportCueSheet(w io.Writer, path string) error {
+	f, err := openFLACFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cueSheet, _ := f.blockData(flac.MetadataBlockTypeCueSheet).(*flac.CueSheet)
+	if cueSheet == nil {
+		return errors.New("file has no CUESHEET block")
+	}
+	writeCueSheet(w, cueSheet, filepath.Base(path))
+	return nil
+}
+
+// writeCueSheet writes cueSheet in cue sheet format, referring to file.
+func writeCueSheet(w io.Writer, cueSheet *flac.CueSheet, file string) {
+	if catalog := cueSheet.CatalogNumber; catalog != "" {
+		fmt.Fprintf(w, "CATALOG %s\n", catalog)
+	}
+	fmt.Fprintf(w, "FILE \"%s\" WAVE\n", file)
+
+	for _, t := range cueSheet.Tracks {
+		if t.TrackNumber == cdLeadOutTrack && cueSheet.IsCD || t.TrackNumber == leadOutTrack {
+			continue
+		}
+		typ := "AUDIO"
+		if !t.IsAudio {
+			typ = "DATA"
+		}
+		fmt.Fprintf(w, "  TRACK %02d %s\n", t.TrackNumber, typ)
+		if t.PreEmphasis {
+			fmt.Fprintln(w, "    FLAGS PRE")
+		}
+		if t.ISRC != "" {
+			fmt.Fprintf(w, "    ISRC %s\n", string(t.ISRC))
+		}
+		for _, x := range t.Indices {
+			offset := t.OffsetSamples + x.OffsetSamples
+			if cueSheet.IsCD {
+				frames := offset * 75 / cdSampleRate
+				fmt.Fprintf(w, "    INDEX %02d %02d:%02d:%02d\n", x.PointNumber, frames/(60*75), frames/75%60, frames%75)
+			} else {
+				fmt.Fprintf(w, "    INDEX %02d %d\n", x.PointNumber, offset)
+			}
+		}
+	}
+}
+
+// The --validate-cuesheet --format=json document. Field names are part of
+// the output format and must not change.
+
+type jsonCueSheetValidation struct {
+	File       string                  `json:"file"`
+	Violations []jsonCueSheetViolation `json:"violations"`
+}
+
+type jsonCueSheetViolation struct {
+	Track   int    `json:"track"`
+	Index   int    `json:"index"`
+	Message string `json:"message"`
+}
+
+// validateCueSheet checks the CUESHEET block of a FLAC file against the rules
+// of the format and writes the violations as text or JSON. Files with
+// violations fail.
+func validateCueSheet(w io.Writer, path string, asJSON bool) error {
+	f, err := openFLACFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cueSheet, _ := f.blockData(flac.MetadataBlockTypeCueSheet).(*flac.CueSheet)
+	if cueSheet == nil {
+		return errors.New("file has no CUESHEET block")
+	}
+	vs := cueSheet.Validate(f.streamInfo())
+	if asJSON {
+		j := &jsonCueSheetValidation{File: path, Violations: []jsonCueSheetViolation{}}
+		for _, v := range vs {
+			j.Violations = append(j.Violations, jsonCueSheetViolation(v))
+		}
+		if err := json.NewEncoder(w).Encode(j); err != nil {
+			return err
+		}
+	} else {
+		for _, v := range vs {
+			fmt.Fprintf(w, "%s: %s\n", path, v.Message)
+		}
+		if len(vs) == 0 {
+			fmt.Fprintf(w, "%s: no violations\n", path)
+		}
+	}
+	if len(vs) > 0 {
+		return fmt.Errorf("%d CUESHEET violations", len(vs))
+	}
+	return nil
+}
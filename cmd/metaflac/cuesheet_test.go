@@ -0,0 +1,126 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zachorosz/flac"
+)
+
+func TestCueSheetRoundTrip(t *testing.T) {
+	cd := &flac.StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 16, TotalSamples: 10 * 44100}
+	hires := &flac.StreamInfo{SampleRate: 96000, Channels: 2, BitsPerSample: 24, TotalSamples: 10 * 96000}
+	for _, tt := range []struct {
+		desc       string
+		streamInfo *flac.StreamInfo
+		in, out    string
+	}{
+		{
+			"CD-DA", cd, `REM GENRE Rock
+CATALOG 0123456789012
+PERFORMER "Someone"
+FILE "rip.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "One Two"
+    FLAGS DCP PRE
+    ISRC USRC17607839
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    INDEX 00 00:02:00
+    INDEX 01 00:04:37
+    INDEX 02 00:06:74
+  TRACK 03 DATA
+    INDEX 01 352800
+`, `CATALOG 0123456789012
+FILE "a.flac" WAVE
+  TRACK 01 AUDIO
+    FLAGS PRE
+    ISRC USRC17607839
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    INDEX 00 00:02:00
+    INDEX 01 00:04:37
+    INDEX 02 00:06:74
+  TRACK 03 DATA
+    INDEX 01 00:08:00
+`,
+		},
+		{
+			"not CD-DA", hires, `FILE "hires.wav" WAVE
+  TRACK 01 AUDIO
+    INDEX 01 0
+  TRACK 05 AUDIO
+    INDEX 00 100
+    INDEX 01 00:01:00
+`, `FILE "a.flac" WAVE
+  TRACK 01 AUDIO
+    INDEX 01 0
+  TRACK 05 AUDIO
+    INDEX 00 100
+    INDEX 01 96000
+`,
+		},
+	} {
+		cs, err := parseCueSheet(strings.NewReader(tt.in), tt.streamInfo)
+		if err != nil {
+			t.Errorf("%s: %v", tt.desc, err)
+			continue
+		}
+		var out strings.Builder
+		writeCueSheet(&out, cs, "a.flac")
+		if out.String() != tt.out {
+			t.Errorf("%s: exported\n%s\nwant\n%s", tt.desc, out.String(), tt.out)
+		}
+		again, err := parseCueSheet(strings.NewReader(out.String()), tt.streamInfo)
+		if err != nil {
+			t.Errorf("%s: parsing the export: %v", tt.desc, err)
+		} else if !reflect.DeepEqual(again, cs) {
+			t.Errorf("%s: export parsed as %+v, want %+v", tt.desc, again, cs)
+		}
+	}
+
+	cs, _ := parseCueSheet(strings.NewReader("FILE x WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00:00\nTRACK 02 AUDIO\nINDEX 01 00:04:37\n"), cd)
+	if !cs.IsCD || cs.NumLeadInSamples != 88200 || len(cs.Tracks) != 3 {
+		t.Fatalf("CD-DA cue sheet %+v", cs)
+	}
+	if leadOut := cs.Tracks[2]; leadOut.TrackNumber != 170 || leadOut.OffsetSamples != cd.TotalSamples {
+		t.Errorf("lead-out track %d at %d, want 170 at %d", leadOut.TrackNumber, leadOut.OffsetSamples, cd.TotalSamples)
+	}
+	if offset := cs.Tracks[1].OffsetSamples; offset != (4*75+37)*588 {
+		t.Errorf("track 2 offset %d, want %d", offset, (4*75+37)*588)
+	}
+}
+
+func TestCueSheetErrors(t *testing.T) {
+	cd := &flac.StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 16, TotalSamples: 10 * 44100}
+	for _, tt := range []struct {
+		desc, in, want string
+		streamInfo     *flac.StreamInfo
+	}{
+		{"no total samples", "TRACK 01 AUDIO\nINDEX 01 0\n", "does not specify total samples", &flac.StreamInfo{SampleRate: 44100}},
+		{"no tracks", "FILE x WAVE\n", "no tracks", nil},
+		{"two files", "FILE x WAVE\nFILE y WAVE\n", "line 2: only cue sheets with a single FILE", nil},
+		{"track order", "TRACK 02 AUDIO\nINDEX 01 0\nTRACK 01 AUDIO\n", "line 3: track numbers must be increasing", nil},
+		{"track without index", "TRACK 01 AUDIO\nTRACK 02 AUDIO\nINDEX 01 0\n", "track 1 has no INDEX", nil},
+		{"first index", "TRACK 01 AUDIO\nINDEX 02 0\n", "first index number must be 0 or 1", nil},
+		{"index sequence", "TRACK 01 AUDIO\nINDEX 00 0\nINDEX 02 00:01:00\n", "index numbers must be sequential", nil},
+		{"index order", "TRACK 01 AUDIO\nINDEX 00 00:00:00\nINDEX 01 00:02:00\nINDEX 02 00:01:00\n", "line 4: index offsets must be increasing", nil},
+		{"same index offset", "TRACK 01 AUDIO\nINDEX 00 00:01:00\nINDEX 01 00:01:00\n", "line 3: index offsets must be increasing", nil},
+		{"track order by offset", "TRACK 01 AUDIO\nINDEX 01 00:02:00\nTRACK 02 AUDIO\nINDEX 01 00:01:00\n", "track 2 offset 44100 does not follow offset 88200 of the previous track", nil},
+		{"time", "TRACK 01 AUDIO\nINDEX 01 00:60:00\n", "seconds or frames out of range", nil},
+		{"alignment", "TRACK 01 AUDIO\nINDEX 01 0\nTRACK 02 AUDIO\nINDEX 01 1000\n", "not a multiple of 588 samples", nil},
+		{"index alignment", "TRACK 01 AUDIO\nINDEX 00 0\nINDEX 01 1000\n", "not a multiple of 588 samples", nil},
+		{"beyond end", "TRACK 01 AUDIO\nINDEX 01 0\nTRACK 02 AUDIO\nINDEX 01 00:10:00\n", "beyond the end of the stream of 441000 samples", nil},
+		{"CD-DA sample rate", "CATALOG 0123456789012\nTRACK 01 AUDIO\nINDEX 01 0\n", "CD-DA cue sheet of a stream of 48000 Hz", &flac.StreamInfo{SampleRate: 48000, TotalSamples: 48000}},
+	} {
+		si := tt.streamInfo
+		if si == nil {
+			si = cd
+		}
+		_, err := parseCueSheet(strings.NewReader(tt.in), si)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.desc, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/zachorosz/flac"
+)
+
+// The --disc-id --format=json document. Field names are part of the output
+// format and must not change.
+
+type jsonDiscID struct {
+	File          string `json:"file"`
+	MusicBrainzID string `json:"musicbrainz_id"`
+	FreedbID      string `json:"freedb_id"`
+	AccurateRipID string `json:"accuraterip_id"`
+	TOC           string `json:"toc"`
+}
+
+// discID writes the disc IDs of the CD-DA CUESHEET block of a FLAC file as
+// text or JSON.
+func discID(w io.Writer, path string, asJSON bool) error {
+	f, err := openFLACFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cueSheet, _ := f.blockData(flac.MetadataBlockTypeCueSheet).(*flac.CueSheet)
+	if cueSheet == nil {
+		return errors.New("file has no CUESHEET block")
+	}
+	toc, err := flac.NewCDTOC(cueSheet)
+	if err != nil {
+		return err
+	}
+	ar, err := flac.NewAccurateRipDiscID(cueSheet)
+	if err != nil {
+		return err
+	}
+	j := &jsonDiscID{
+		File:          path,
+		MusicBrainzID: toc.MusicBrainzDiscID(),
+		FreedbID:      fmt.Sprintf("%08x", toc.FreedbDiscID()),
+		AccurateRipID: ar.String(),
+		TOC:           toc.String(),
+	}
+	if asJSON {
+		return json.NewEncoder(w).Encode(j)
+	}
+	fmt.Fprintf(w, "%s:\n", path)
+	fmt.Fprintf(w, "  MusicBrainz disc ID: %s\n", j.MusicBrainzID)
+	fmt.Fprintf(w, "  freedb disc ID: %s\n", j.FreedbID)
+	fmt.Fprintf(w, "  AccurateRip disc ID: %s\n", j.AccurateRipID)
+	fmt.Fprintf(w, "  TOC: %s\n", j.TOC)
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/zachorosz/flac"
+)
+
+// flacFile is a FLAC file opened to edit its metadata.
+type flacFile struct {
+	path        string
+	f           *os.File
+	r           *flac.Reader // positioned at the first audio frame
+	blocks      []*flac.MetadataBlock
+	audioOffset int64
+}
+
+// openFLACFile opens a FLAC file and reads its metadata blocks.
+func openFLACFile(path string) (*flacFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := flac.NewReader(f)
+	blocks, audioOffset, err := readMetadata(r)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if r.StreamInfo() == nil {
+		f.Close()
+		return nil, errors.New("missing STREAMINFO block")
+	}
+
+	return &flacFile{path: path, f: f, r: r, blocks: blocks, audioOffset: audioOffset}, nil
+}
+
+func (f *flacFile) Close() error {
+	return f.f.Close()
+}
+
+func (f *flacFile) streamInfo() *flac.StreamInfo {
+	return f.r.StreamInfo()
+}
+
+// blockData returns the data of the first block of type t, or nil.
+func (f *flacFile) blockData(t flac.MetadataBlockType) interface{} {
+	for _, b := range f.blocks {
+		if b.Type == t {
+			return b.Data
+		}
+	}
+	return nil
+}
+
+// insertBlock inserts a block with data of type t right after STREAMINFO.
+func (f *flacFile) insertBlock(t flac.MetadataBlockType, data interface{}) {
+	b := &flac.MetadataBlock{MetadataBlockHeader: flac.MetadataBlockHeader{Type: t}, Data: data}
+	f.blocks = append(f.blocks[:1], append([]*flac.MetadataBlock{b}, f.blocks[1:]...)...)
+}
+
+// save writes the edited metadata blocks back to the file and closes it.
+func (f *flacFile) save() error {
+	f.f.Close()
+	return rewriteMetadata(f.path, f.blocks, f.audioOffset)
+}
+
+// readMetadata reads all metadata blocks of a FLAC stream. It returns the
+// blocks and the byte offset of the first audio frame.
+func readMetadata(r *flac.Reader) ([]*flac.MetadataBlock, int64, error) {
+	var blocks []*flac.MetadataBlock
+	offset := int64(4) // fLaC marker
+	for readLast := false; !readLast; {
+		b, err := r.ReadBlock()
+		if err != nil {
+			return nil, 0, err
+		}
+		readLast = b.Last
+		blocks = append(blocks, b)
+		offset += 4 + int64(b.Length)
+	}
+	return blocks, offset, nil
+}
+
+// rewriteMetadata replaces the metadata blocks of a FLAC file with blocks,
+// keeping the audio frames starting at audioOffset. The file is written to a
+// temporary file in the same directory which then replaces the original.
+func rewriteMetadata(path string, blocks []*flac.MetadataBlock, audioOffset int64) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	out := bufio.NewWriter(tmp)
+	w := flac.NewWriter(out)
+	for i, b := range blocks {
+		b.Last = i == len(blocks)-1
+		if err = w.WriteBlock(b); err != nil {
+			return err
+		}
+	}
+
+	if _, err = src.Seek(audioOffset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, src); err != nil {
+		return err
+	}
+	if err = out.Flush(); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(fi.Mode()); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
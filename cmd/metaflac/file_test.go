@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zachorosz/flac"
+)
+
+// testStreamInfo returns the STREAMINFO block of the test files.
+func testStreamInfo() *flac.MetadataBlock {
+	return &flac.MetadataBlock{
+		MetadataBlockHeader: flac.MetadataBlockHeader{Type: flac.MetadataBlockTypeStreamInfo},
+		Data: &flac.StreamInfo{
+			MinimumBlockSize: 4096,
+			MaximumBlockSize: 4096,
+			MinimumFrameSize: 14,
+			MaximumFrameSize: 8192,
+			SampleRate:       44100,
+			Channels:         2,
+			BitsPerSample:    16,
+			TotalSamples:     44100 * 3,
+			MD5:              []byte("0123456789abcdef"),
+		},
+	}
+}
+
+// writeTestFile writes a FLAC file of blocks followed by audio to a temporary
+// directory and returns its path. Tests that only edit metadata do not
+// decode the audio, so it need not be valid frames.
+func writeTestFile(t *testing.T, name string, audio []byte, blocks ...*flac.MetadataBlock) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := flac.NewWriter(&buf)
+	for i, b := range blocks {
+		b.Last = i == len(blocks)-1
+		if err := w.WriteBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf.Write(audio)
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readTestFile returns the metadata blocks and audio of a FLAC file.
+func readTestFile(t *testing.T, path string) ([]*flac.MetadataBlock, []byte) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, audioOffset, err := readMetadata(flac.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blocks, data[audioOffset:]
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/zachorosz/flac"
+)
+
+// The --export-peaks-to document. Field names are part of the output format
+// and must not change.
+
+type jsonWaveform struct {
+	File       string         `json:"file"`
+	SampleRate uint32         `json:"sample_rate"`
+	Channels   uint8          `json:"channels"`
+	Samples    uint64         `json:"samples"`
+	Width      int            `json:"width"`
+	Peaks      [][][2]float64 `json:"peaks"` // [min, max] of each column of each channel
+}
+
+// imageOptions are the images rendered from the audio of a FLAC file.
+type imageOptions struct {
+	spectrogramTo, waveformTo, peaksTo string
+	spectrogram                        flac.SpectrogramConfig
+	waveform                           flac.WaveformConfig
+}
+
+// frameWriters writes frames to each of its analyzers.
+type frameWriters []frameWriter
+
+func (ws frameWriters) WriteFrame(f *flac.Frame) {
+	for _, w := range ws {
+		w.WriteFrame(f)
+	}
+}
+
+// exportImages decodes a FLAC file once and writes its spectrogram and
+// waveform PNGs and waveform peaks. Peaks written to "-" go to w.
+func exportImages(w io.Writer, path string, opts imageOptions) error {
+	var (
+		sg *flac.Spectrogram
+		wf *flac.Waveform
+		si *flac.StreamInfo
+	)
+	err := analyzeFile(path, func(info *flac.StreamInfo, _ []*flac.MetadataBlock) (frameWriter, error) {
+		si = info
+		var ws frameWriters
+		if opts.spectrogramTo != "" {
+			var err error
+			if sg, err = flac.NewSpectrogram(info, opts.spectrogram); err != nil {
+				return nil, err
+			}
+			ws = append(ws, sg)
+		}
+		if opts.waveformTo != "" || opts.peaksTo != "" {
+			var err error
+			if wf, err = flac.NewWaveform(info, opts.waveform); err != nil {
+				return nil, err
+			}
+			ws = append(ws, wf)
+		}
+		return ws, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if sg != nil {
+		if err := writePNG(opts.spectrogramTo, sg.Image()); err != nil {
+			return err
+		}
+	}
+	if opts.waveformTo != "" {
+		if err := writePNG(opts.waveformTo, wf.Image()); err != nil {
+			return err
+		}
+	}
+	if opts.peaksTo == "" {
+		return nil
+	}
+	j := &jsonWaveform{
+		File:       path,
+		SampleRate: si.SampleRate,
+		Channels:   si.Channels,
+		Samples:    si.TotalSamples,
+	}
+	for _, peaks := range wf.Peaks() {
+		ch := make([][2]float64, len(peaks))
+		for x, p := range peaks {
+			ch[x] = [2]float64{p.Min, p.Max}
+		}
+		j.Peaks = append(j.Peaks, ch)
+		j.Width = len(peaks)
+	}
+	if opts.peaksTo == "-" {
+		return json.NewEncoder(w).Encode(j)
+	}
+	out, err := os.Create(opts.peaksTo)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(out).Encode(j); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writePNG writes img to a PNG file.
+func writePNG(path string, img image.Image) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(out, img); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return out.Close()
+}
+
+// parseWindow parses the value of --fft-window.
+func parseWindow(s string) (flac.Window, bool) {
+	for _, w := range []flac.Window{flac.WindowHann, flac.WindowHamming, flac.WindowBlackman, flac.WindowRectangular} {
+		if s == w.String() {
+			return w, true
+		}
+	}
+	return 0, false
+}
+
+// parseFrequencyScale parses the value of --frequency-scale.
+func parseFrequencyScale(s string) (flac.FrequencyScale, bool) {
+	for _, fs := range []flac.FrequencyScale{flac.FrequencyScaleLinear, flac.FrequencyScaleLog} {
+		if s == fs.String() {
+			return fs, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/hex"
+
+	"github.com/zachorosz/flac"
+)
+
+// The --format=json document. Field names are part of the output format and
+// must not change.
+
+type jsonFile struct {
+	File   string       `json:"file"`
+	Blocks []*jsonBlock `json:"blocks"`
+}
+
+type jsonBlock struct {
+	Type          string             `json:"type"`
+	TypeID        uint8              `json:"type_id"`
+	IsLast        bool               `json:"is_last"`
+	Length        uint32             `json:"length"`
+	StreamInfo    *jsonStreamInfo    `json:"streaminfo,omitempty"`
+	Application   *jsonApplication   `json:"application,omitempty"`
+	SeekTable     *jsonSeekTable     `json:"seektable,omitempty"`
+	VorbisComment *jsonVorbisComment `json:"vorbis_comment,omitempty"`
+	CueSheet      *jsonCueSheet      `json:"cuesheet,omitempty"`
+	Picture       *jsonPicture       `json:"picture,omitempty"`
+}
+
+type jsonStreamInfo struct {
+	MinimumBlockSize uint16 `json:"minimum_block_size"`
+	MaximumBlockSize uint16 `json:"maximum_block_size"`
+	MinimumFrameSize uint32 `json:"minimum_frame_size"`
+	MaximumFrameSize uint32 `json:"maximum_frame_size"`
+	SampleRate       uint32 `json:"sample_rate"`
+	Channels         uint8  `json:"channels"`
+	BitsPerSample    uint8  `json:"bits_per_sample"`
+	TotalSamples     uint64 `json:"total_samples"`
+	MD5              string `json:"md5"`
+}
+
+type jsonApplication struct {
+	ID   string `json:"id"`
+	Data []byte `json:"data"`
+}
+
+type jsonSeekTable struct {
+	SeekPoints []jsonSeekPoint `json:"seek_points"`
+}
+
+type jsonSeekPoint struct {
+	SampleNumber  uint64 `json:"sample_number"`
+	StreamOffset  uint64 `json:"stream_offset"`
+	FrameSamples  uint16 `json:"frame_samples"`
+	IsPlaceholder bool   `json:"is_placeholder"`
+}
+
+type jsonVorbisComment struct {
+	Vendor   string   `json:"vendor"`
+	Comments []string `json:"comments"`
+}
+
+type jsonCueSheet struct {
+	MediaCatalogNumber string          `json:"media_catalog_number"`
+	LeadIn             uint64          `json:"lead_in"`
+	IsCD               bool            `json:"is_cd"`
+	Tracks             []*jsonCueTrack `json:"tracks"`
+}
+
+type jsonCueTrack struct {
+	Offset      uint64         `json:"offset"`
+	Number      uint8          `json:"number"`
+	ISRC        string         `json:"isrc"`
+	IsAudio     bool           `json:"is_audio"`
+	PreEmphasis bool           `json:"pre_emphasis"`
+	Indices     []jsonCueIndex `json:"indices"`
+}
+
+type jsonCueIndex struct {
+	Offset uint64 `json:"offset"`
+	Number uint8  `json:"number"`
+}
+
+type jsonPicture struct {
+	Type        uint32 `json:"type"`
+	TypeName    string `json:"type_name"`
+	MimeType    string `json:"mime_type"`
+	Description string `json:"description"`
+	Width       uint32 `json:"width"`
+	Height      uint32 `json:"height"`
+	Depth       uint32 `json:"depth"`
+	Colors      uint32 `json:"colors"`
+	DataLength  int    `json:"data_length"`
+	// Data is only included when requested with --picture-data.
+	Data []byte `json:"data,omitempty"`
+}
+
+func newJSONFile(file string, blocks []*flac.MetadataBlock, pictureData bool) *jsonFile {
+	doc := &jsonFile{File: file, Blocks: make([]*jsonBlock, 0, len(blocks))}
+
+	for _, b := range blocks {
+		jb := &jsonBlock{
+			Type:   b.Type.String(),
+			TypeID: uint8(b.Type),
+			IsLast: b.Last,
+			Length: b.Length,
+		}
+
+		switch data := b.Data.(type) {
+		case *flac.StreamInfo:
+			jb.StreamInfo = &jsonStreamInfo{
+				MinimumBlockSize: data.MinimumBlockSize,
+				MaximumBlockSize: data.MaximumBlockSize,
+				MinimumFrameSize: data.MinimumFrameSize,
+				MaximumFrameSize: data.MaximumFrameSize,
+				SampleRate:       data.SampleRate,
+				Channels:         data.Channels,
+				BitsPerSample:    data.BitsPerSample,
+				TotalSamples:     data.TotalSamples,
+				MD5:              hex.EncodeToString(data.MD5),
+			}
+		case *flac.Application:
+			jb.Application = &jsonApplication{ID: data.ID, Data: data.Data}
+		case *flac.SeekTable:
+			jb.SeekTable = &jsonSeekTable{SeekPoints: make([]jsonSeekPoint, 0, len(data.SeekPoints))}
+			for _, p := range data.SeekPoints {
+				jb.SeekTable.SeekPoints = append(jb.SeekTable.SeekPoints, jsonSeekPoint{
+					SampleNumber:  p.SampleNumber,
+					StreamOffset:  p.Offset,
+					FrameSamples:  p.NumSamples,
+					IsPlaceholder: p.IsPlaceholder(),
+				})
+			}
+		case *flac.VorbisComment:
+			jb.VorbisComment = &jsonVorbisComment{Vendor: data.Vendor, Comments: data.UserComments}
+			if jb.VorbisComment.Comments == nil {
+				jb.VorbisComment.Comments = []string{}
+			}
+		case *flac.CueSheet:
+			jb.CueSheet = &jsonCueSheet{
+				MediaCatalogNumber: string(data.CatalogNumber),
+				LeadIn:             data.NumLeadInSamples,
+				IsCD:               data.IsCD,
+				Tracks:             make([]*jsonCueTrack, 0, len(data.Tracks)),
+			}
+			for _, t := range data.Tracks {
+				jt := &jsonCueTrack{
+					Offset:      t.OffsetSamples,
+					Number:      t.TrackNumber,
+					ISRC:        string(t.ISRC),
+					IsAudio:     t.IsAudio,
+					PreEmphasis: t.PreEmphasis,
+					Indices:     make([]jsonCueIndex, 0, len(t.Indices)),
+				}
+				for _, x := range t.Indices {
+					jt.Indices = append(jt.Indices, jsonCueIndex{Offset: x.OffsetSamples, Number: x.PointNumber})
+				}
+				jb.CueSheet.Tracks = append(jb.CueSheet.Tracks, jt)
+			}
+		case *flac.Picture:
+			jb.Picture = &jsonPicture{
+				Type:        uint32(data.Type),
+				TypeName:    data.Type.String(),
+				MimeType:    data.MimeType,
+				Description: data.Description,
+				Width:       data.Width,
+				Height:      data.Height,
+				Depth:       data.Depth,
+				Colors:      data.Colors,
+				DataLength:  len(data.Data),
+			}
+			if pictureData {
+				jb.Picture.Data = data.Data
+			}
+		}
+
+		doc.Blocks = append(doc.Blocks, jb)
+	}
+
+	return doc
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/template"
+
+	"github.com/zachorosz/flac"
+)
+
+// fileMetadata is the data --format templates are executed with.
+type fileMetadata struct {
+	// File is the path of the FLAC file.
+	File string
+	// Prefix is "File:" when more than one file is listed, or empty.
+	Prefix string
+	// Blocks holds every metadata block of the file in stream order.
+	Blocks []*flac.MetadataBlock
+
+	// The data of the first block of each type, or nil if there is none.
+	StreamInfo    *flac.StreamInfo
+	SeekTable     *flac.SeekTable
+	VorbisComment *flac.VorbisComment
+	CueSheet      *flac.CueSheet
+
+	// The data of every block of the repeatable types.
+	Applications []*flac.Application
+	Pictures     []*flac.Picture
+}
+
+func newFileMetadata(file, prefix string, blocks []*flac.MetadataBlock) *fileMetadata {
+	m := &fileMetadata{File: file, Prefix: prefix, Blocks: blocks}
+	for _, b := range blocks {
+		switch data := b.Data.(type) {
+		case *flac.StreamInfo:
+			if m.StreamInfo == nil {
+				m.StreamInfo = data
+			}
+		case *flac.SeekTable:
+			if m.SeekTable == nil {
+				m.SeekTable = data
+			}
+		case *flac.VorbisComment:
+			if m.VorbisComment == nil {
+				m.VorbisComment = data
+			}
+		case *flac.CueSheet:
+			if m.CueSheet == nil {
+				m.CueSheet = data
+			}
+		case *flac.Application:
+			m.Applications = append(m.Applications, data)
+		case *flac.Picture:
+			m.Pictures = append(m.Pictures, data)
+		}
+	}
+	return m
+}
+
+var templateFuncs = template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+	"hex": hex.EncodeToString,
+}
+
+// listTemplate is the default human readable listing.
+var listTemplate = template.Must(template.New("list").Funcs(templateFuncs).Parse(
+	`{{$p := .Prefix -}}
+{{range $i, $b := .Blocks -}}
+{{$p}}METADATA block #{{inc $i}}
+{{$p}} type: {{printf "%d" $b.Type}} ({{$b.Type}})
+{{$p}} is last: {{$b.Last}}
+{{$p}} length: {{$b.Length}}
+{{with $b.Data -}}
+{{if eq $b.Type.String "STREAMINFO" -}}
+{{$p}} minimum block size: {{.MinimumBlockSize}} samples
+{{$p}} maximum block size: {{.MaximumBlockSize}} samples
+{{$p}} minimum frame size: {{.MinimumFrameSize}} bytes
+{{$p}} maximum frame size: {{.MaximumFrameSize}} bytes
+{{$p}} sample_rate: {{.SampleRate}} Hz
+{{$p}} channels: {{.Channels}}
+{{$p}} bits-per-sample: {{.BitsPerSample}}
+{{$p}} total samples: {{.TotalSamples}}
+{{$p}} MD5 signature: {{hex .MD5}}
+{{else if eq $b.Type.String "APPLICATION" -}}
+{{$p}} application id: {{.ID}}
+{{$p}} application data: {{hex .Data}}
+{{else if eq $b.Type.String "SEEKTABLE" -}}
+{{$p}} seek points: {{len .SeekPoints}}
+{{range $j, $sp := .SeekPoints -}}
+{{$p}}  point {{$j}}: sample_number={{$sp.SampleNumber}}, stream_offset={{$sp.Offset}}, frame_samples={{$sp.NumSamples}}
+{{end -}}
+{{else if eq $b.Type.String "VORBIS_COMMENT" -}}
+{{$p}} vendor string: {{.Vendor}}
+{{$p}} comments: {{len .UserComments}}
+{{range $j, $c := .UserComments -}}
+{{$p}}  comment[{{$j}}]: {{$c}}
+{{end -}}
+{{else if eq $b.Type.String "CUESHEET" -}}
+{{$p}} media catalog number: {{.CatalogNumber}}
+{{$p}} lead-in: {{.NumLeadInSamples}}
+{{$p}} is CD: {{.IsCD}}
+{{$p}} number of tracks: {{len .Tracks}}
+{{range $j, $t := .Tracks -}}
+{{$p}}  track[{{$j}}]
+{{$p}}   offset: {{$t.OffsetSamples}}
+{{$p}}   number: {{$t.TrackNumber}}
+{{$p}}   ISRC: {{$t.ISRC}}
+{{$p}}   type: {{if $t.IsAudio}}AUDIO{{else}}NON-AUDIO{{end}}
+{{$p}}   pre-emphasis: {{$t.PreEmphasis}}
+{{$p}}   number of index points: {{len $t.Indices}}
+{{range $k, $x := $t.Indices -}}
+{{$p}}    index[{{$k}}]
+{{$p}}     offset: {{$x.OffsetSamples}}
+{{$p}}     number: {{$x.PointNumber}}
+{{end -}}
+{{end -}}
+{{else if eq $b.Type.String "PICTURE" -}}
+{{$p}} type: {{printf "%d" .Type}} ({{.Type}})
+{{$p}} MIME type: {{.MimeType}}
+{{$p}} description: {{.Description}}
+{{$p}} width: {{.Width}}
+{{$p}} height: {{.Height}}
+{{$p}} depth: {{.Depth}}
+{{$p}} colors: {{.Colors}}{{if eq .Colors 0}} (unindexed){{end}}
+{{$p}} data length: {{len .Data}}
+{{end -}}
+{{end -}}
+{{end -}}
+`))
+
+// listFormat selects how list prints the metadata of each file.
+type listFormat struct {
+	json        bool
+	pictureData bool               // include picture data in JSON output
+	tmpl        *template.Template // nil for JSON output
+}
+
+// parseListFormat parses the --format flag: "text", "json" or a Go template.
+func parseListFormat(format string, pictureData bool) (*listFormat, error) {
+	switch format {
+	case "", "text":
+		return &listFormat{tmpl: listTemplate}, nil
+	case "json":
+		return &listFormat{json: true, pictureData: pictureData}, nil
+	}
+
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format + "\n")
+	if err != nil {
+		return nil, err
+	}
+	return &listFormat{tmpl: tmpl}, nil
+}
+
+func list(b *batch, files []string, format *listFormat) bool {
+	return b.run(files, func(w io.Writer, i int) error {
+		var prefix string
+		if len(files) > 1 {
+			prefix = fmt.Sprintf("%s:", files[i])
+		}
+		return listMetadata(w, prefix, files[i], format)
+	})
+}
+
+func listMetadata(w io.Writer, prefix, file string, format *listFormat) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open FLAC file: %w", err)
+	}
+	defer f.Close()
+
+	blocks, _, err := readMetadata(flac.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("failed to read block: %w", err)
+	}
+
+	if format.json {
+		return json.NewEncoder(w).Encode(newJSONFile(file, blocks, format.pictureData))
+	}
+	return format.tmpl.Execute(w, newFileMetadata(file, prefix, blocks))
+}
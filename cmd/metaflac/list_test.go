@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/zachorosz/flac"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// testListBlocks returns metadata blocks of every type, with the fields that
+// the listing formats in their own way.
+func testListBlocks() []*flac.MetadataBlock {
+	block := func(typ flac.MetadataBlockType, data interface{}) *flac.MetadataBlock {
+		return &flac.MetadataBlock{MetadataBlockHeader: flac.MetadataBlockHeader{Type: typ}, Data: data}
+	}
+	return []*flac.MetadataBlock{
+		testStreamInfo(),
+		block(flac.MetadataBlockTypeApplication, &flac.Application{ID: "test", Data: []byte{0x01, 0xab, 0xff}}),
+		block(flac.MetadataBlockTypeSeekTable, &flac.SeekTable{SeekPoints: []*flac.SeekPoint{
+			{SampleNumber: 0, Offset: 0, NumSamples: 4096},
+			{SampleNumber: 40960, Offset: 31337, NumSamples: 4096},
+			{SampleNumber: flac.PlaceholderSampleNumber},
+		}}),
+		block(flac.MetadataBlockTypeVorbisComment, &flac.VorbisComment{Vendor: "vendor", UserComments: []string{"TITLE=a", "ARTIST=b=c"}}),
+		block(flac.MetadataBlockTypeCueSheet, &flac.CueSheet{
+			CatalogNumber:    "1234567890123",
+			NumLeadInSamples: 88200,
+			IsCD:             true,
+			Tracks: []*flac.CueSheetTrack{
+				{TrackNumber: 1, ISRC: "USRC17607839", IsAudio: true, PreEmphasis: true, Indices: []*flac.CueSheetTrackIndex{
+					{PointNumber: 0},
+					{OffsetSamples: 588 * 75, PointNumber: 1},
+				}},
+				{OffsetSamples: 588 * 150, TrackNumber: 2, Indices: []*flac.CueSheetTrackIndex{{PointNumber: 1}}},
+				{OffsetSamples: 44100 * 3, TrackNumber: 170, IsAudio: true},
+			},
+		}),
+		block(flac.MetadataBlockTypePicture, &flac.Picture{
+			Type:        flac.PictureTypeCoverFront,
+			MimeType:    "image/png",
+			Description: "front",
+			Width:       1,
+			Height:      2,
+			Depth:       24,
+			Data:        []byte{1, 2, 3},
+		}),
+		block(flac.MetadataBlockTypePicture, &flac.Picture{
+			Type:     flac.PictureTypeBrightColoredFish,
+			MimeType: "image/gif",
+			Width:    16,
+			Height:   16,
+			Depth:    8,
+			Colors:   256,
+		}),
+		{MetadataBlockHeader: flac.MetadataBlockHeader{Type: flac.MetadataBlockTypePadding, Length: 100}},
+	}
+}
+
+// TestListText checks the default listing against the output of metaflac
+// before the listing was rewritten as a template.
+func TestListText(t *testing.T) {
+	path := writeTestFile(t, "list.flac", nil, testListBlocks()...)
+	format, err := parseListFormat("text", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	listMetadata(&buf, "", path, format)
+
+	const golden = "testdata/list.golden"
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Errorf("listing differs from %s:\n%s", golden, got)
+	}
+
+	// the lines of each file are prefixed with its name when listing several
+	buf.Reset()
+	listMetadata(&buf, "list.flac:", path, format)
+	lines := strings.SplitAfter(string(want), "\n")
+	for i, line := range lines[:len(lines)-1] {
+		lines[i] = "list.flac:" + line
+	}
+	if got := buf.String(); got != strings.Join(lines, "") {
+		t.Errorf("prefixed listing:\n%s", got)
+	}
+}
+
+func TestListJSON(t *testing.T) {
+	path := writeTestFile(t, "list.flac", nil, testListBlocks()...)
+	for _, pictureData := range []bool{false, true} {
+		format, err := parseListFormat("json", pictureData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		listMetadata(&buf, "", path, format)
+
+		// decode generically, as the field names are part of the format
+		var doc struct {
+			File   string                   `json:"file"`
+			Blocks []map[string]interface{} `json:"blocks"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if doc.File != path || len(doc.Blocks) != 8 {
+			t.Fatalf("file %q with %d blocks", doc.File, len(doc.Blocks))
+		}
+		field := func(block int, path ...string) interface{} {
+			var v interface{} = doc.Blocks[block]
+			for _, p := range path {
+				v = v.(map[string]interface{})[p]
+			}
+			return v
+		}
+		for _, tt := range []struct {
+			block int
+			path  []string
+			want  interface{}
+		}{
+			{0, []string{"type"}, "STREAMINFO"},
+			{0, []string{"streaminfo", "sample_rate"}, 44100.0},
+			{0, []string{"streaminfo", "md5"}, "30313233343536373839616263646566"},
+			{1, []string{"application", "data"}, "Aav/"},
+			{4, []string{"cuesheet", "lead_in"}, 88200.0},
+			{5, []string{"picture", "type_name"}, "Cover (front)"},
+			{5, []string{"picture", "data_length"}, 3.0},
+			{7, []string{"is_last"}, true},
+			{7, []string{"length"}, 100.0},
+		} {
+			if got := field(tt.block, tt.path...); got != tt.want {
+				t.Errorf("block %d %v = %v, want %v", tt.block, tt.path, got, tt.want)
+			}
+		}
+		points := field(2, "seektable", "seek_points").([]interface{})
+		if p := points[2].(map[string]interface{}); len(points) != 3 || p["is_placeholder"] != true {
+			t.Errorf("seek points %v", points)
+		}
+		if data, ok := field(5, "picture").(map[string]interface{})["data"]; ok != pictureData || ok && data != "AQID" {
+			t.Errorf("picture data %v with --picture-data %v", data, pictureData)
+		}
+	}
+}
+
+func TestListTemplate(t *testing.T) {
+	path := writeTestFile(t, "list.flac", nil, testListBlocks()...)
+	format, err := parseListFormat(`{{.StreamInfo.SampleRate}} {{len .Pictures}} {{(index .Applications 0).ID}} {{.VorbisComment.Vendor}}`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	listMetadata(&buf, "", path, format)
+	if got, want := buf.String(), "44100 2 test vendor\n"; got != want {
+		t.Errorf("template output %q, want %q", got, want)
+	}
+	if _, err := parseListFormat("{{.StreamInfo", false); err == nil {
+		t.Error("parseListFormat accepted an invalid template")
+	}
+}
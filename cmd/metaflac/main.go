@@ -2,135 +2,350 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"strings"
 
 	"github.com/zachorosz/flac"
 )
 
 func help(w io.Writer) {
 	fmt.Fprintln(w, `Usage:
-    metaflac FLACfile [FLACfile ...]
+    metaflac [options] FLACfile [FLACfile ...]
 
-List metadata in one or more FLAC files.`)
+List metadata in one or more FLAC files, or modify it when options are given.
+
+Options:
+    --format=FORMAT
+        Format of the metadata listing: "text" (the default), "json" for one
+        JSON document per file, or a Go text/template executed for each file,
+        e.g. '{{.StreamInfo.SampleRate}}'. Templates have the fields File,
+        Blocks, StreamInfo, SeekTable, VorbisComment, CueSheet, Applications
+        and Pictures.
+    --picture-data
+        Include the base64 encoded picture data in JSON output.
+    --recursive
+        Process the .flac files found in directories given as arguments.
+    --jobs=N
+        Number of files to process concurrently. Defaults to the number of
+        CPUs. Output is always written in the order of the files.
+    --continue-on-error
+        Keep processing the remaining files after a file fails. Each failure
+        is reported and the exit status is 1 if any file failed.
+    --trim-truncated
+        Cut a truncated FLAC file after its last complete frame, turn the seek
+        points past the end into placeholders, and rewrite STREAMINFO for the
+        remaining audio, including its MD5 signature. Done before any other
+        change.
+    --repair-streaminfo
+        Recompute the minimum and maximum block and frame sizes and the total
+        number of samples in the STREAMINFO block by scanning the audio
+        frames, and write the block back in place. Done before any other
+        change.
+    --repair-md5
+        With --repair-streaminfo, also recompute the MD5 signature from the
+        decoded audio.
+    --add-seekpoint={#|X|#x|#s}
+        Add seek points to a SEEKTABLE block, creating the block if needed.
+        The audio frames are scanned to resolve the points. May be repeated.
+          #   a seek point at sample number #
+          X   a placeholder point
+          #x  # points evenly spaced throughout the stream
+          #s  a point every # seconds (# may be fractional, e.g. 9.5s)
+    --import-cuesheet-from=FILE
+        Import a cue sheet from FILE into a new CUESHEET block. Only one FLAC
+        file may be given. Index times are mm:ss:ff or sample numbers. Seek
+        points are added at every track and index unless --no-cued-seekpoints
+        is given. CD-DA cue sheets must be aligned to 588 sample frames.
+    --export-cuesheet-to=FILE
+        Export the CUESHEET block to a cue sheet in FILE, or to standard
+        output if FILE is "-".
+    --validate-cuesheet
+        Check the CUESHEET block of the files against the rules of the
+        format, with the stricter rules of CD-DA cue sheets, and report each
+        violation. Files with violations fail. With --format=json, one JSON
+        document is written per file.
+    --no-cued-seekpoints
+        Do not add seek points for the tracks and indices of an imported cue
+        sheet.
+    --add-replay-gain
+        Calculate the ReplayGain track and album gain and peak of the given
+        files and store them as REPLAYGAIN_* Vorbis comments. The album gain
+        is calculated over all files, which must have the same sample rate.
+    --scan-replay-gain
+        Like --add-replay-gain, but print the values instead of storing them.
+    --qc-report
+        Decode the files and report clipped sample runs, the DC offset, peak,
+        RMS, crest factor and dynamic range of each channel, the DR meter
+        value, and leading, trailing and internal silence. With
+        --format=json, one JSON document is written per file.
+    --silence-threshold=DBFS
+        With --qc-report, the level below which audio is silent. Defaults to
+        -60.
+    --min-silence=SECONDS
+        With --qc-report, the shortest silence within the audio to report.
+        Defaults to 2.
+    --detect-fake
+        Decode the files and report signs that the audio is not what its
+        format claims: a spectral cutoff left by a lossy encoder, a cutoff at
+        the Nyquist frequency of a lower sample rate, and low bits that are
+        zero in every sample. Each sign has a confidence between 0 and 100%.
+        With --format=json, one JSON document is written per file.
+    --export-spectrogram-to=FILE
+        Decode the audio and write its spectrogram to a PNG file, with time
+        from left to right, frequency from bottom to top and the channels
+        stacked from top to bottom.
+    --export-waveform-to=FILE
+        Decode the audio and write a waveform overview to a PNG file, with
+        the channels stacked from top to bottom.
+    --export-peaks-to=FILE
+        Decode the audio and write the minimum and maximum sample value of
+        each column of the waveform of each channel, relative to full scale,
+        to a JSON file, or to standard output if FILE is "-".
+    --image-width=PIXELS
+        The width of the images and the number of peaks. Defaults to 800.
+    --image-height=PIXELS
+        The height of the images of each channel. Defaults to 256.
+    --fft-size=N
+        The number of samples of the FFTs of the spectrogram, a power of two
+        from 16 to 65536. Defaults to 2048.
+    --fft-window=WINDOW
+        The window function of the FFTs of the spectrogram: hann (the
+        default), hamming, blackman or rectangular.
+    --frequency-scale=SCALE
+        The frequency axis of the spectrogram: linear (the default) or log.
+    --accuraterip
+        Decode CD rips with a CD-DA CUESHEET block and report their
+        AccurateRip disc ID, the AccurateRip v1 and v2 checksums and EAC copy
+        CRC of each track, and the copy CRC of the whole disc. With
+        --format=json, one JSON document is written per file.
+    --accuraterip-db=FILE
+        Like --accuraterip, but also verify the tracks against the entries
+        of an AccurateRip database file (dBAR-*.bin). Files with tracks that
+        match no entry fail.
+    --disc-id
+        Report the MusicBrainz, freedb and AccurateRip disc IDs and the
+        MusicBrainz TOC string of the CD-DA CUESHEET block of the files. With
+        --format=json, one JSON document is written per file.`)
 }
 
+// vendorString is the vendor of VORBIS_COMMENT blocks created by metaflac.
+const vendorString = "github.com/zachorosz/flac"
+
 func fatalf(format string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, format, args...)
 	os.Exit(1)
 }
 
+// stringsFlag is a flag that may be repeated to collect a list of values.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
 func main() {
 	out := bufio.NewWriter(os.Stdout)
 	defer out.Flush()
 
-	if len(os.Args) < 2 {
-		help(out)
-		os.Exit(1)
-	}
-	flacFiles := os.Args[1:]
+	var (
+		seekPoints         stringsFlag
+		addReplayGain      bool
+		scanReplayGain     bool
+		format             string
+		pictureData        bool
+		recursive          bool
+		continueOnError    bool
+		jobs               int
+		importCueSheetFrom string
+		exportCueSheetTo   string
+		noCuedSeekPoints   bool
+		repairInfo         bool
+		repairMD5          bool
+		trim               bool
+		qc                 bool
+		detectFakes        bool
+		images             imageOptions
+		imageWidth         int
+		imageHeight        int
+		fftWindow          string
+		frequencyScale     string
+		accurateRip        bool
+		accurateRipDB      string
+		discIDs            bool
+		validateCue        bool
+		inspectConfig      flac.InspectConfig
+	)
 
-	list(out, flacFiles)
-}
+	flags := flag.NewFlagSet("metaflac", flag.ExitOnError)
+	flags.Usage = func() { help(os.Stderr) }
+	flags.StringVar(&format, "format", "text", "")
+	flags.BoolVar(&pictureData, "picture-data", false, "")
+	flags.BoolVar(&trim, "trim-truncated", false, "")
+	flags.BoolVar(&repairInfo, "repair-streaminfo", false, "")
+	flags.BoolVar(&repairMD5, "repair-md5", false, "")
+	flags.Var(&seekPoints, "add-seekpoint", "")
+	flags.StringVar(&importCueSheetFrom, "import-cuesheet-from", "", "")
+	flags.StringVar(&exportCueSheetTo, "export-cuesheet-to", "", "")
+	flags.BoolVar(&validateCue, "validate-cuesheet", false, "")
+	flags.BoolVar(&noCuedSeekPoints, "no-cued-seekpoints", false, "")
+	flags.BoolVar(&addReplayGain, "add-replay-gain", false, "")
+	flags.BoolVar(&scanReplayGain, "scan-replay-gain", false, "")
+	flags.BoolVar(&qc, "qc-report", false, "")
+	flags.Float64Var(&inspectConfig.SilenceThreshold, "silence-threshold", 0, "")
+	flags.Float64Var(&inspectConfig.MinSilence, "min-silence", 0, "")
+	flags.BoolVar(&detectFakes, "detect-fake", false, "")
+	flags.StringVar(&images.spectrogramTo, "export-spectrogram-to", "", "")
+	flags.StringVar(&images.waveformTo, "export-waveform-to", "", "")
+	flags.StringVar(&images.peaksTo, "export-peaks-to", "", "")
+	flags.IntVar(&imageWidth, "image-width", 0, "")
+	flags.IntVar(&imageHeight, "image-height", 0, "")
+	flags.IntVar(&images.spectrogram.FFTSize, "fft-size", 0, "")
+	flags.StringVar(&fftWindow, "fft-window", "hann", "")
+	flags.StringVar(&frequencyScale, "frequency-scale", "linear", "")
+	flags.BoolVar(&accurateRip, "accuraterip", false, "")
+	flags.StringVar(&accurateRipDB, "accuraterip-db", "", "")
+	flags.BoolVar(&discIDs, "disc-id", false, "")
+	flags.BoolVar(&recursive, "recursive", false, "")
+	flags.BoolVar(&continueOnError, "continue-on-error", false, "")
+	flags.IntVar(&jobs, "jobs", runtime.NumCPU(), "")
+	flags.Parse(os.Args[1:])
 
-func list(w io.Writer, files []string) {
-	for _, f := range files {
-		var prefix string
-		if len(files) > 1 {
-			prefix = fmt.Sprintf("%s:", f)
-		}
-		listMetadata(w, prefix, f)
+	if flags.NArg() < 1 {
+		help(out)
+		out.Flush()
+		os.Exit(1)
 	}
-}
-
-func listMetadata(w io.Writer, prefix, file string) {
-	f, err := os.Open(file)
+	flacFiles, err := expandFiles(flags.Args(), recursive)
 	if err != nil {
-		fatalf("%s: failed to open FLAC file", file)
-		os.Exit(1)
+		fatalf("%v\n", err)
+	}
+	if len(flacFiles) == 0 {
+		fatalf("no FLAC files found\n")
 	}
-	defer f.Close()
 
-	r := flac.NewReader(f)
+	b := &batch{
+		out:             out,
+		stderr:          os.Stderr,
+		jobs:            jobs,
+		continueOnError: continueOnError,
+	}
 
-	i := 0
-	for readLast := false; !readLast; {
-		b, err := r.ReadBlock()
-		if err != nil {
-			fatalf("%s: failed to read block: %v", file, err)
-		}
-		readLast = b.Last
-
-		fmt.Fprintf(w, "%sMETADATA block #%d\n", prefix, i+1)
-		fmt.Fprintf(w, "%s type: %d (%s)\n", prefix, b.Type, b.Type)
-		fmt.Fprintf(w, "%s is last: %t\n", prefix, b.Last)
-		fmt.Fprintf(w, "%s length: %d\n", prefix, b.Length)
-
-		switch b := b.Data.(type) {
-		case *flac.StreamInfo:
-			fmt.Fprintf(w, "%s minimum block size: %d samples\n", prefix, b.MinimumBlockSize)
-			fmt.Fprintf(w, "%s maximum block size: %d samples\n", prefix, b.MaximumBlockSize)
-			fmt.Fprintf(w, "%s minimum frame size: %d bytes\n", prefix, b.MinimumFrameSize)
-			fmt.Fprintf(w, "%s maximum frame size: %d bytes\n", prefix, b.MaximumFrameSize)
-			fmt.Fprintf(w, "%s sample_rate: %d Hz\n", prefix, b.SampleRate)
-			fmt.Fprintf(w, "%s channels: %d\n", prefix, b.Channels)
-			fmt.Fprintf(w, "%s bits-per-sample: %d\n", prefix, b.BitsPerSample)
-			fmt.Fprintf(w, "%s total samples: %d\n", prefix, b.TotalSamples)
-			fmt.Fprintf(w, "%s MD5 signature: %x\n", prefix, b.MD5)
-		case *flac.Application:
-			fmt.Fprintf(w, "%s application id: %s\n", prefix, b.ID)
-			fmt.Fprintf(w, "%s application data: %x\n", prefix, b.Data)
-		case *flac.SeekTable:
-			fmt.Fprintf(w, "%s seek points: %d\n", prefix, len(b.SeekPoints))
-			for i, p := range b.SeekPoints {
-				fmt.Fprintf(w, "%s  point %d: sample_number=%d, stream_offset=%d, frame_samples=%d\n", prefix, i, p.SampleNumber, p.Offset, p.NumSamples)
-			}
-		case *flac.VorbisComment:
-			fmt.Fprintf(w, "%s vendor string: %s\n", prefix, b.Vendor)
-			fmt.Fprintf(w, "%s comments: %d\n", prefix, len(b.UserComments))
-			for i, c := range b.UserComments {
-				fmt.Fprintf(w, "%s  comment[%d]: %s\n", prefix, i, c)
-			}
-		case *flac.CueSheet:
-			fmt.Fprintf(w, "%s media catalog number: %s\n", prefix, b.CatalogNumber)
-			fmt.Fprintf(w, "%s lead-in: %d\n", prefix, b.NumLeadInSamples)
-			fmt.Fprintf(w, "%s is CD: %t\n", prefix, b.IsCD)
-			fmt.Fprintf(w, "%s number of tracks: %d\n", prefix, len(b.Tracks))
-			for i, t := range b.Tracks {
-				fmt.Fprintf(w, "%s  track[%d]\n", prefix, i)
-				fmt.Fprintf(w, "%s   offset: %d\n", prefix, t.OffsetSamples)
-				fmt.Fprintf(w, "%s   number: %d\n", prefix, t.TrackNumber)
-				fmt.Fprintf(w, "%s   ISRC: %s\n", prefix, t.ISRC)
-				if t.IsAudio {
-					fmt.Fprintf(w, "%s   type: AUDIO\n", prefix)
-				} else {
-					fmt.Fprintf(w, "%s   type: NON-AUDIO\n", prefix)
-				}
-				fmt.Fprintf(w, "%s   pre-emphasis: %t\n", prefix, t.PreEmphasis)
-				fmt.Fprintf(w, "%s   number of index points: %d\n", prefix, len(t.Indices))
-
-				for j, p := range t.Indices {
-					fmt.Fprintf(w, "%s    index[%d]\n", prefix, j)
-					fmt.Fprintf(w, "%s     offset: %d\n", prefix, p.OffsetSamples)
-					fmt.Fprintf(w, "%s     number: %d\n", prefix, p.PointNumber)
-				}
+	ok := true
+	switch {
+	case qc:
+		if format != "text" && format != "json" {
+			fatalf("--qc-report supports only the text and json formats\n")
+		}
+		ok = b.run(flacFiles, func(w io.Writer, i int) error {
+			return qcReport(w, flacFiles[i], inspectConfig, format == "json")
+		})
+	case detectFakes:
+		if format != "text" && format != "json" {
+			fatalf("--detect-fake supports only the text and json formats\n")
+		}
+		ok = b.run(flacFiles, func(w io.Writer, i int) error {
+			return detectFake(w, flacFiles[i], format == "json")
+		})
+	case validateCue:
+		if format != "text" && format != "json" {
+			fatalf("--validate-cuesheet supports only the text and json formats\n")
+		}
+		ok = b.run(flacFiles, func(w io.Writer, i int) error {
+			return validateCueSheet(w, flacFiles[i], format == "json")
+		})
+	case discIDs:
+		if format != "text" && format != "json" {
+			fatalf("--disc-id supports only the text and json formats\n")
+		}
+		ok = b.run(flacFiles, func(w io.Writer, i int) error {
+			return discID(w, flacFiles[i], format == "json")
+		})
+	case accurateRip || accurateRipDB != "":
+		if format != "text" && format != "json" {
+			fatalf("--accuraterip supports only the text and json formats\n")
+		}
+		var entries []flac.AccurateRipEntry
+		if accurateRipDB != "" {
+			if entries, err = readAccurateRipDatabase(accurateRipDB); err != nil {
+				fatalf("%s: %v\n", accurateRipDB, err)
 			}
-		case *flac.Picture:
-			fmt.Fprintf(w, "%s type: %d (%s)\n", prefix, b.Type, b.Type)
-			fmt.Fprintf(w, "%s MIME type: %s\n", prefix, b.MimeType)
-			fmt.Fprintf(w, "%s description: %s\n", prefix, b.Description)
-			fmt.Fprintf(w, "%s width: %d\n", prefix, b.Width)
-			fmt.Fprintf(w, "%s height: %d\n", prefix, b.Height)
-			fmt.Fprintf(w, "%s depth: %d\n", prefix, b.Depth)
-			if b.Colors == 0 {
-				fmt.Fprintf(w, "%s colors: 0 (unindexed)\n", prefix)
-			} else {
-				fmt.Fprintf(w, "%s colors: %d\n", prefix, b.Colors)
+		}
+		ok = b.run(flacFiles, func(w io.Writer, i int) error {
+			return accurateRipFile(w, flacFiles[i], entries, accurateRipDB != "", format == "json")
+		})
+	case images.spectrogramTo != "" || images.waveformTo != "" || images.peaksTo != "":
+		if (images.spectrogramTo != "" || images.waveformTo != "" || images.peaksTo != "-") && len(flacFiles) > 1 {
+			fatalf("--export-spectrogram-to, --export-waveform-to and --export-peaks-to require a single FLAC file\n")
+		}
+		var valid bool
+		if images.spectrogram.Window, valid = parseWindow(fftWindow); !valid {
+			fatalf("invalid FFT window %q\n", fftWindow)
+		}
+		if images.spectrogram.Scale, valid = parseFrequencyScale(frequencyScale); !valid {
+			fatalf("invalid frequency scale %q\n", frequencyScale)
+		}
+		images.spectrogram.Width, images.spectrogram.Height = imageWidth, imageHeight
+		images.waveform.Width, images.waveform.Height = imageWidth, imageHeight
+		ok = b.run(flacFiles, func(w io.Writer, i int) error {
+			return exportImages(w, flacFiles[i], images)
+		})
+	case !trim && !repairInfo && len(seekPoints) == 0 && !addReplayGain && !scanReplayGain && importCueSheetFrom == "" && exportCueSheetTo == "":
+		listFmt, err := parseListFormat(format, pictureData)
+		if err != nil {
+			fatalf("invalid format: %v\n", err)
+		}
+		ok = list(b, flacFiles, listFmt)
+	default:
+		if (importCueSheetFrom != "" || exportCueSheetTo != "" && exportCueSheetTo != "-") && len(flacFiles) > 1 {
+			fatalf("--import-cuesheet-from and --export-cuesheet-to require a single FLAC file\n")
+		}
+		var templates []seekPointTemplate
+		if len(seekPoints) > 0 {
+			if templates, err = parseSeekPoints(seekPoints); err != nil {
+				fatalf("%v\n", err)
 			}
-			fmt.Fprintf(w, "%s data length: %d\n", prefix, len(b.Data))
 		}
 
-		i++
+		if trim {
+			ok = b.run(flacFiles, func(w io.Writer, i int) error {
+				return trimTruncated(w, flacFiles[i])
+			})
+		}
+		if repairInfo && (ok || continueOnError) {
+			ok = b.run(flacFiles, func(w io.Writer, i int) error {
+				return repairStreamInfo(w, flacFiles[i], repairMD5)
+			}) && ok
+		}
+		if importCueSheetFrom != "" && (ok || continueOnError) {
+			ok = b.run(flacFiles, func(w io.Writer, i int) error {
+				return importCueSheet(flacFiles[i], importCueSheetFrom, noCuedSeekPoints)
+			}) && ok
+		}
+		if len(templates) > 0 && (ok || continueOnError) {
+			ok = b.run(flacFiles, func(w io.Writer, i int) error {
+				return addSeekPoints(flacFiles[i], templates)
+			}) && ok
+		}
+		if (addReplayGain || scanReplayGain) && (ok || continueOnError) {
+			ok = replayGainFiles(b, flacFiles, addReplayGain) && ok
+		}
+		if exportCueSheetTo != "" && (ok || continueOnError) {
+			ok = exportCueSheets(b, flacFiles, exportCueSheetTo) && ok
+		}
+	}
+
+	b.summary(len(flacFiles))
+	if !ok {
+		out.Flush()
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/zachorosz/flac"
+)
+
+// The --qc-report --format=json document. Field names are part of the output
+// format and must not change.
+
+type jsonQualityReport struct {
+	File            string               `json:"file"`
+	SampleRate      uint32               `json:"sample_rate"`
+	Samples         uint64               `json:"samples"`
+	DynamicRange    int                  `json:"dynamic_range"`
+	Channels        []jsonChannelQuality `json:"channels"`
+	ClippedSamples  uint64               `json:"clipped_samples"`
+	ClipRuns        []jsonClipRun        `json:"clip_runs"`
+	LeadingSilence  uint64               `json:"leading_silence"`
+	TrailingSilence uint64               `json:"trailing_silence"`
+	Silences        []jsonSampleSpan     `json:"silences"`
+}
+
+type jsonChannelQuality struct {
+	DCOffset     float64 `json:"dc_offset"`
+	Peak         float64 `json:"peak"`
+	RMS          float64 `json:"rms"`
+	CrestFactor  float64 `json:"crest_factor"`
+	DynamicRange float64 `json:"dynamic_range"`
+}
+
+type jsonClipRun struct {
+	Channel int    `json:"channel"`
+	Start   uint64 `json:"start"`
+	Length  uint64 `json:"length"`
+}
+
+type jsonSampleSpan struct {
+	Start  uint64 `json:"start"`
+	Length uint64 `json:"length"`
+}
+
+func newJSONQualityReport(file string, rep *flac.QualityReport) *jsonQualityReport {
+	j := &jsonQualityReport{
+		File:            file,
+		SampleRate:      rep.SampleRate,
+		Samples:         rep.Samples,
+		DynamicRange:    rep.DynamicRange,
+		Channels:        []jsonChannelQuality{},
+		ClippedSamples:  rep.ClippedSamples,
+		ClipRuns:        []jsonClipRun{},
+		LeadingSilence:  rep.LeadingSilence,
+		TrailingSilence: rep.TrailingSilence,
+		Silences:        []jsonSampleSpan{},
+	}
+	for _, c := range rep.Channels {
+		j.Channels = append(j.Channels, jsonChannelQuality(c))
+	}
+	for _, r := range rep.ClipRuns {
+		j.ClipRuns = append(j.ClipRuns, jsonClipRun(r))
+	}
+	for _, s := range rep.Silences {
+		j.Silences = append(j.Silences, jsonSampleSpan(s))
+	}
+	return j
+}
+
+// frameWriter is an analyzer of decoded frames.
+type frameWriter interface {
+	WriteFrame(f *flac.Frame)
+}
+
+// analyzeFile decodes a FLAC file into the analyzer returned by newAnalyzer
+// for its STREAMINFO and metadata blocks.
+func analyzeFile(path string, newAnalyzer func(si *flac.StreamInfo, blocks []*flac.MetadataBlock) (frameWriter, error)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := flac.NewReader(f)
+	blocks, _, err := readMetadata(r)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+	si := r.StreamInfo()
+	if si == nil {
+		return errors.New("missing STREAMINFO block")
+	}
+	a, err := newAnalyzer(si, blocks)
+	if err != nil {
+		return err
+	}
+	for {
+		frame, err := r.ReadFrame()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read frame: %w", err)
+		}
+		a.WriteFrame(frame)
+	}
+}
+
+// inspectFile decodes a FLAC file and returns its quality report.
+func inspectFile(path string, config flac.InspectConfig) (*flac.QualityReport, error) {
+	var in *flac.Inspector
+	err := analyzeFile(path, func(si *flac.StreamInfo, _ []*flac.MetadataBlock) (frameWriter, error) {
+		var err error
+		in, err = flac.NewInspector(si, config)
+		return in, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return in.Report(), nil
+}
+
+// qcReport writes the quality report of a FLAC file as text or JSON.
+func qcReport(w io.Writer, path string, config flac.InspectConfig, asJSON bool) error {
+	rep, err := inspectFile(path, config)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return json.NewEncoder(w).Encode(newJSONQualityReport(path, rep))
+	}
+
+	seconds := func(n uint64) float64 {
+		return float64(n) / float64(rep.SampleRate)
+	}
+	dB := func(v float64) float64 {
+		return 20 * math.Log10(math.Abs(v))
+	}
+	fmt.Fprintf(w, "%s: %d samples (%.3f s), DR%d\n", path, rep.Samples, seconds(rep.Samples), rep.DynamicRange)
+	for c, q := range rep.Channels {
+		fmt.Fprintf(w, "  channel %d: DC offset %+.6f (%.1f dBFS), peak %.2f dBFS, RMS %.2f dBFS, crest factor %.2f dB, dynamic range %.2f dB\n",
+			c, q.DCOffset, dB(q.DCOffset), dB(q.Peak), dB(q.RMS), q.CrestFactor, q.DynamicRange)
+	}
+	fmt.Fprintf(w, "  leading silence: %.3f s\n", seconds(rep.LeadingSilence))
+	fmt.Fprintf(w, "  trailing silence: %.3f s\n", seconds(rep.TrailingSilence))
+	for _, s := range rep.Silences {
+		fmt.Fprintf(w, "  silence: %.3f s to %.3f s\n", seconds(s.Start), seconds(s.Start+s.Length))
+	}
+	fmt.Fprintf(w, "  clipped samples: %d\n", rep.ClippedSamples)
+	for _, r := range rep.ClipRuns {
+		fmt.Fprintf(w, "  clipping: channel %d at %.3f s, %d samples\n", r.Channel, seconds(r.Start), r.Length)
+	}
+	return nil
+}
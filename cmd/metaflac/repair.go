@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/zachorosz/flac"
+)
+
+// repairStreamInfo recomputes the block sizes, frame sizes, total samples and,
+// if computeMD5 is set, the MD5 signature in the STREAMINFO block of a FLAC
+// file from its audio frames, and writes the block back in place.
+func repairStreamInfo(w io.Writer, path string, computeMD5 bool) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	si, err := flac.RepairStreamInfo(f, computeMD5)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s: block size %d-%d, frame size %d-%d, total samples %d, MD5 %x\n",
+		path, si.MinimumBlockSize, si.MaximumBlockSize, si.MinimumFrameSize, si.MaximumFrameSize, si.TotalSamples, si.MD5)
+	return err
+}
+
+// trimTruncated cuts a truncated FLAC file after its last complete frame and
+// rewrites STREAMINFO for the frames that remain.
+func trimTruncated(w io.Writer, path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	terr, err := flac.TrimTruncated(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if terr == nil {
+		_, err = fmt.Fprintf(w, "%s: complete, not trimmed\n", path)
+	} else {
+		_, err = fmt.Fprintf(w, "%s: trimmed to %d bytes and %d samples, %d samples lost\n", path, terr.Offset, terr.Samples, terr.Missing)
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/zachorosz/flac"
+)
+
+// replayGain holds the ReplayGain values of a track.
+type replayGain struct {
+	gain, peak float64
+}
+
+// analyzeReplayGain decodes a FLAC file and returns its loudness analysis.
+func analyzeReplayGain(path string, sampleRate uint32) (*flac.LoudnessAnalyzer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := flac.NewReader(f)
+	if _, _, err := readMetadata(r); err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	si := r.StreamInfo()
+	if si == nil {
+		return nil, errors.New("missing STREAMINFO block")
+	}
+	if si.SampleRate != sampleRate {
+		return nil, fmt.Errorf("sample rate of %d Hz does not match previous files' sample rate of %d Hz", si.SampleRate, sampleRate)
+	}
+
+	a, err := flac.NewLoudnessAnalyzer(si)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		frame, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read frame: %w", err)
+		}
+		a.WriteFrame(frame)
+	}
+
+	if math.IsNaN(a.Loudness().ReplayGain1) {
+		return nil, fmt.Errorf("cannot compute ReplayGain of %d Hz audio of %d samples", si.SampleRate, si.TotalSamples)
+	}
+	return a, nil
+}
+
+// ReplayGain Vorbis comment field names.
+const (
+	tagReferenceLoudness = "REPLAYGAIN_REFERENCE_LOUDNESS"
+	tagTrackGain         = "REPLAYGAIN_TRACK_GAIN"
+	tagTrackPeak         = "REPLAYGAIN_TRACK_PEAK"
+	tagAlbumGain         = "REPLAYGAIN_ALBUM_GAIN"
+	tagAlbumPeak         = "REPLAYGAIN_ALBUM_PEAK"
+)
+
+// replayGainFiles computes the track gains of files and the album gain over
+// all of them. If write is set the gains are stored as REPLAYGAIN_* Vorbis
+// comments, otherwise they are printed. Nothing is stored unless every file
+// could be analyzed, since the album gain depends on all of them.
+func replayGainFiles(b *batch, files []string, write bool) bool {
+	sampleRate, err := firstSampleRate(files[0])
+	if err != nil {
+		b.fail(files[0])
+		fmt.Fprintf(b.stderr, "%s: %v\n", files[0], err)
+		return false
+	}
+
+	analyzers := make([]*flac.LoudnessAnalyzer, len(files))
+	ok := b.run(files, func(w io.Writer, i int) (err error) {
+		analyzers[i], err = analyzeReplayGain(files[i], sampleRate)
+		return err
+	})
+	if !ok {
+		fmt.Fprintln(b.stderr, "metaflac: cannot compute the album gain because not every file could be analyzed")
+		return false
+	}
+
+	tracks := make([]replayGain, len(files))
+	for i, a := range analyzers {
+		l := a.Loudness()
+		tracks[i] = replayGain{gain: l.ReplayGain1, peak: l.SamplePeak}
+	}
+	l := flac.AlbumLoudness(analyzers...)
+	album := replayGain{gain: l.ReplayGain1, peak: l.SamplePeak}
+
+	return b.run(files, func(w io.Writer, i int) error {
+		if !write {
+			_, err := fmt.Fprintf(w, "%s: track gain %+.2f dB, track peak %1.8f, album gain %+.2f dB, album peak %1.8f\n",
+				files[i], tracks[i].gain, tracks[i].peak, album.gain, album.peak)
+			return err
+		}
+		return storeReplayGain(files[i], tracks[i], album)
+	})
+}
+
+// firstSampleRate returns the sample rate of a FLAC file.
+func firstSampleRate(path string) (uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	b, err := flac.NewReader(f).ReadBlock()
+	if err != nil {
+		return 0, err
+	}
+	si, ok := b.Data.(*flac.StreamInfo)
+	if !ok {
+		return 0, errors.New("missing STREAMINFO block")
+	}
+	return si.SampleRate, nil
+}
+
+// storeReplayGain replaces the REPLAYGAIN_* Vorbis comments of a FLAC file,
+// creating a VORBIS_COMMENT block if the file does not have one.
+func storeReplayGain(path string, track, album replayGain) error {
+	f, err := openFLACFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	vc, _ := f.blockData(flac.MetadataBlockTypeVorbisComment).(*flac.VorbisComment)
+	if vc == nil {
+		vc = &flac.VorbisComment{Vendor: vendorString}
+		f.insertBlock(flac.MetadataBlockTypeVorbisComment, vc)
+	}
+
+	for _, field := range []string{tagReferenceLoudness, tagTrackGain, tagTrackPeak, tagAlbumGain, tagAlbumPeak} {
+		vc.Remove(field)
+	}
+	vc.Add(tagReferenceLoudness, fmt.Sprintf("%2.1f dB", flac.ReplayGainReferenceLoudness))
+	vc.Add(tagTrackGain, fmt.Sprintf("%+2.2f dB", track.gain))
+	vc.Add(tagTrackPeak, fmt.Sprintf("%1.8f", track.peak))
+	vc.Add(tagAlbumGain, fmt.Sprintf("%+2.2f dB", album.gain))
+	vc.Add(tagAlbumPeak, fmt.Sprintf("%1.8f", album.peak))
+
+	return f.save()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zachorosz/flac"
+)
+
+func TestStoreReplayGain(t *testing.T) {
+	audio := []byte("audio frames")
+	vc := &flac.VorbisComment{Vendor: "vendor", UserComments: []string{
+		"TITLE=x",
+		"REPLAYGAIN_TRACK_GAIN=+1.00 dB",
+		"replaygain_album_peak=1.0",
+	}}
+	path := writeTestFile(t, "a.flac", audio, testStreamInfo(), &flac.MetadataBlock{
+		MetadataBlockHeader: flac.MetadataBlockHeader{Type: flac.MetadataBlockTypeVorbisComment},
+		Data:                vc,
+	})
+	if err := storeReplayGain(path, replayGain{gain: -6.5, peak: 0.5}, replayGain{gain: 1.234, peak: 0.987654321}); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, got := readTestFile(t, path)
+	if string(got) != string(audio) {
+		t.Errorf("audio %q, want %q", got, audio)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("%d blocks, want 2", len(blocks))
+	}
+	vc = blocks[1].Data.(*flac.VorbisComment)
+	want := []string{
+		"TITLE=x",
+		"REPLAYGAIN_REFERENCE_LOUDNESS=89.0 dB",
+		"REPLAYGAIN_TRACK_GAIN=-6.50 dB",
+		"REPLAYGAIN_TRACK_PEAK=0.50000000",
+		"REPLAYGAIN_ALBUM_GAIN=+1.23 dB",
+		"REPLAYGAIN_ALBUM_PEAK=0.98765432",
+	}
+	if vc.Vendor != "vendor" || !reflect.DeepEqual(vc.UserComments, want) {
+		t.Errorf("vendor %q, comments %q, want %q", vc.Vendor, vc.UserComments, want)
+	}
+
+	// a VORBIS_COMMENT block is added after STREAMINFO if there is none
+	path = writeTestFile(t, "b.flac", audio, testStreamInfo(), &flac.MetadataBlock{
+		MetadataBlockHeader: flac.MetadataBlockHeader{Type: flac.MetadataBlockTypePadding, Length: 10},
+	})
+	if err := storeReplayGain(path, replayGain{gain: 0, peak: 1}, replayGain{gain: -12.3, peak: 1}); err != nil {
+		t.Fatal(err)
+	}
+	blocks, _ = readTestFile(t, path)
+	if len(blocks) != 3 || blocks[1].Type != flac.MetadataBlockTypeVorbisComment || blocks[2].Type != flac.MetadataBlockTypePadding {
+		t.Fatalf("blocks %v, want STREAMINFO, VORBIS_COMMENT and PADDING", blocks)
+	}
+	vc = blocks[1].Data.(*flac.VorbisComment)
+	want = []string{
+		"REPLAYGAIN_REFERENCE_LOUDNESS=89.0 dB",
+		"REPLAYGAIN_TRACK_GAIN=+0.00 dB",
+		"REPLAYGAIN_TRACK_PEAK=1.00000000",
+		"REPLAYGAIN_ALBUM_GAIN=-12.30 dB",
+		"REPLAYGAIN_ALBUM_PEAK=1.00000000",
+	}
+	if vc.Vendor != vendorString || !reflect.DeepEqual(vc.UserComments, want) {
+		t.Errorf("vendor %q, comments %q, want %q", vc.Vendor, vc.UserComments, want)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/zachorosz/flac"
+)
+
+// seekPointTemplate is a parsed --add-seekpoint specification.
+type seekPointTemplate struct {
+	kind    byte    // 0 for a sample number, 'X', 'x' or 's'
+	sample  uint64  // sample number of a single point
+	count   int     // number of evenly spaced points ('x')
+	seconds float64 // seconds between spaced points ('s')
+}
+
+func parseSeekPoints(specs []string) ([]seekPointTemplate, error) {
+	templates := make([]seekPointTemplate, 0, len(specs))
+	for _, spec := range specs {
+		t, err := parseSeekPoint(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid seekpoint %q: %w", spec, err)
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+func parseSeekPoint(spec string) (seekPointTemplate, error) {
+	switch {
+	case spec == "X":
+		return seekPointTemplate{kind: 'X'}, nil
+	case strings.HasSuffix(spec, "x"):
+		n, err := strconv.Atoi(strings.TrimSuffix(spec, "x"))
+		if err != nil || n <= 0 {
+			return seekPointTemplate{}, errors.New("number of points must be a positive integer")
+		}
+		return seekPointTemplate{kind: 'x', count: n}, nil
+	case strings.HasSuffix(spec, "s"):
+		secs, err := strconv.ParseFloat(strings.TrimSuffix(spec, "s"), 64)
+		if err != nil || secs <= 0 {
+			return seekPointTemplate{}, errors.New("spacing must be a positive number of seconds")
+		}
+		return seekPointTemplate{kind: 's', seconds: secs}, nil
+	}
+
+	sample, err := strconv.ParseUint(spec, 10, 64)
+	if err != nil || sample == flac.PlaceholderSampleNumber {
+		return seekPointTemplate{}, errors.New("expected a sample number, X, #x or #s")
+	}
+	return seekPointTemplate{sample: sample}, nil
+}
+
+// addSeekPoints adds the seek points of templates to the SEEKTABLE of a FLAC
+// file, creating the block if the file does not have one, and resolves them by
+// scanning the audio frames.
+func addSeekPoints(path string, templates []seekPointTemplate) error {
+	f, err := openFLACFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := f.addSeekPoints(templates); err != nil {
+		return err
+	}
+	return f.save()
+}
+
+// addSeekPoints adds seek points to the SEEKTABLE block, creating it if
+// needed, and resolves them by scanning the audio frames. The reader must be
+// positioned at the first frame.
+func (f *flacFile) addSeekPoints(templates []seekPointTemplate) error {
+	streamInfo := f.streamInfo()
+
+	table, _ := f.blockData(flac.MetadataBlockTypeSeekTable).(*flac.SeekTable)
+	if table == nil {
+		table = new(flac.SeekTable)
+		f.insertBlock(flac.MetadataBlockTypeSeekTable, table)
+	}
+
+	for _, t := range templates {
+		switch t.kind {
+		case 'X':
+			table.AppendPlaceholders(1)
+		case 'x', 's':
+			if streamInfo.TotalSamples == 0 {
+				return errors.New("cannot add seekpoints because STREAMINFO block does not specify total samples")
+			}
+			if t.kind == 'x' {
+				table.AppendSpacedPoints(t.count, streamInfo.TotalSamples)
+				break
+			}
+			samples := uint64(t.seconds * float64(streamInfo.SampleRate))
+			if samples == 0 {
+				samples = 1
+			}
+			table.AppendSpacedPointsBySamples(samples, streamInfo.TotalSamples)
+		default:
+			table.AppendPoint(t.sample)
+		}
+	}
+	table.Sort()
+
+	for {
+		frame, err := f.r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read frame: %w", err)
+		}
+		table.Resolve(frame.SampleNumber, uint64(frame.Offset-f.audioOffset), frame.BlockSize)
+	}
+
+	// points past the end of the stream could not be resolved
+	for _, p := range table.SeekPoints {
+		if !p.IsPlaceholder() && p.NumSamples == 0 {
+			*p = flac.SeekPoint{SampleNumber: flac.PlaceholderSampleNumber}
+		}
+	}
+	table.Sort()
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package flac
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// SampleFormat is the format of a sample of PCM audio converted from decoded
+// frames.
+type SampleFormat uint8
+
+// Sample formats. Integer samples are rescaled from the bits per sample of
+// the stream by shifting, so reducing the bits per sample truncates the
+// samples. Float samples are normalized to [-1,1).
+const (
+	// SampleFormatUint8 is unsigned 8 bit, as in WAVE files.
+	SampleFormatUint8 SampleFormat = iota
+	SampleFormatInt16
+	// SampleFormatInt24 is signed 24 bit, packed in 3 bytes.
+	SampleFormatInt24
+	SampleFormatInt32
+	// SampleFormatFloat32 is IEEE 754 single precision.
+	SampleFormatFloat32
+	// SampleFormatFloat64 is IEEE 754 double precision.
+	SampleFormatFloat64
+)
+
+func (f SampleFormat) String() string {
+	switch f {
+	case SampleFormatUint8:
+		return "u8"
+	case SampleFormatInt16:
+		return "s16"
+	case SampleFormatInt24:
+		return "s24"
+	case SampleFormatInt32:
+		return "s32"
+	case SampleFormatFloat32:
+		return "f32"
+	case SampleFormatFloat64:
+		return "f64"
+	}
+	return fmt.Sprintf("SampleFormat(%d)", f)
+}
+
+// Size returns the size of a sample in bytes.
+func (f SampleFormat) Size() int {
+	switch f {
+	case SampleFormatUint8:
+		return 1
+	case SampleFormatInt16:
+		return 2
+	case SampleFormatInt24:
+		return 3
+	case SampleFormatInt32, SampleFormatFloat32:
+		return 4
+	case SampleFormatFloat64:
+		return 8
+	}
+	return 0
+}
+
+// rescale returns v of bps bits as a sample of n bits.
+func rescale(v int32, bps, n uint8) int32 {
+	if bps > n {
+		return v >> (bps - n)
+	}
+	return v << (n - bps)
+}
+
+// Int16 returns the samples of the frame interleaved as 16 bit samples.
+func (f *Frame) Int16() []int16 {
+	s := make([]int16, 0, len(f.Samples)*int(f.BlockSize))
+	for i := 0; i < int(f.BlockSize); i++ {
+		for _, ch := range f.Samples {
+			s = append(s, int16(rescale(ch[i], f.BitsPerSample, 16)))
+		}
+	}
+	return s
+}
+
+// Float32 returns the samples of the frame interleaved as float samples
+// normalized to [-1,1).
+func (f *Frame) Float32() []float32 {
+	s := make([]float32, 0, len(f.Samples)*int(f.BlockSize))
+	scale := math.Ldexp(1, 1-int(f.BitsPerSample))
+	for i := 0; i < int(f.BlockSize); i++ {
+		for _, ch := range f.Samples {
+			s = append(s, float32(float64(ch[i])*scale))
+		}
+	}
+	return s
+}
+
+// Float64 returns the samples of the frame interleaved as float samples
+// normalized to [-1,1).
+func (f *Frame) Float64() []float64 {
+	s := make([]float64, 0, len(f.Samples)*int(f.BlockSize))
+	scale := math.Ldexp(1, 1-int(f.BitsPerSample))
+	for i := 0; i < int(f.BlockSize); i++ {
+		for _, ch := range f.Samples {
+			s = append(s, float64(ch[i])*scale)
+		}
+	}
+	return s
+}
+
+// AppendPCM appends the samples of the frame to p as interleaved PCM bytes of
+// the given sample format and byte order.
+func (f *Frame) AppendPCM(p []byte, format SampleFormat, order binary.ByteOrder) []byte {
+	return appendPCM(p, f.Samples, f.BitsPerSample, format, order)
+}
+
+// appendPCM appends samples of bps bits to p as interleaved PCM bytes.
+func appendPCM(p []byte, samples [][]int32, bps uint8, format SampleFormat, order binary.ByteOrder) []byte {
+	var b [8]byte
+	scale := math.Ldexp(1, 1-int(bps))
+	// packed 24 bit samples have no PutUint24, so their bytes are laid out
+	// by hand in the order of the most significant byte of a uint16, which
+	// also covers binary.NativeEndian and other implementations
+	order.PutUint16(b[:2], 1)
+	bigEndian := b[1] == 1
+	for i := range samples[0] {
+		for _, ch := range samples {
+			v := ch[i]
+			switch format {
+			case SampleFormatUint8:
+				p = append(p, byte(rescale(v, bps, 8))^0x80)
+			case SampleFormatInt16:
+				order.PutUint16(b[:2], uint16(rescale(v, bps, 16)))
+				p = append(p, b[:2]...)
+			case SampleFormatInt24:
+				x := rescale(v, bps, 24)
+				if bigEndian {
+					p = append(p, byte(x>>16), byte(x>>8), byte(x))
+				} else {
+					p = append(p, byte(x), byte(x>>8), byte(x>>16))
+				}
+			case SampleFormatInt32:
+				order.PutUint32(b[:4], uint32(rescale(v, bps, 32)))
+				p = append(p, b[:4]...)
+			case SampleFormatFloat32:
+				order.PutUint32(b[:4], math.Float32bits(float32(float64(v)*scale)))
+				p = append(p, b[:4]...)
+			case SampleFormatFloat64:
+				order.PutUint64(b[:8], math.Float64bits(float64(v)*scale))
+				p = append(p, b[:8]...)
+			}
+		}
+	}
+	return p
+}
+
+// PCMReader reads the decoded audio of a stream as interleaved PCM bytes.
+type PCMReader struct {
+	r      *Reader
+	format SampleFormat
+	order  binary.ByteOrder
+	buf    []byte // PCM bytes of the last frame read
+	pos    int    // bytes of buf already read
+	size   int    // bytes of a sample of every channel
+	err    error
+}
+
+// NewPCMReader returns a PCMReader of the audio frames read from r, with
+// samples of the given format and byte order.
+func NewPCMReader(r *Reader, format SampleFormat, order binary.ByteOrder) *PCMReader {
+	return &PCMReader{r: r, format: format, order: order}
+}
+
+// Read reads PCM bytes. It reads whole samples of every channel if p is large
+// enough to hold one, and returns io.EOF at the end of the stream.
+func (p *PCMReader) Read(b []byte) (int, error) {
+	for p.pos == len(p.buf) {
+		if p.err != nil {
+			return 0, p.err
+		}
+		f, err := p.r.ReadFrame()
+		if err != nil {
+			p.err = err
+			continue
+		}
+		p.buf = f.AppendPCM(p.buf[:0], p.format, p.order)
+		p.pos = 0
+		p.size = len(f.Samples) * p.format.Size()
+	}
+
+	n := len(b)
+	if n >= p.size {
+		n -= n % p.size
+	}
+	n = copy(b[:n], p.buf[p.pos:])
+	p.pos += n
+	return n, nil
+}
@@ -0,0 +1,81 @@
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestPCMReader(t *testing.T) {
+	const n = 3000
+
+	audio := testAudio(2, n, 24)
+	audio[0][0], audio[1][0] = -1<<23, 1<<23-1
+	var stream bytes.Buffer
+	testEncode(t, &stream, &StreamInfo{SampleRate: 48000, Channels: 2, BitsPerSample: 24}, CompressionLevel(5), audio)
+
+	tests := []struct {
+		format SampleFormat
+		order  binary.ByteOrder
+		sample func(v int32) []byte
+	}{
+		{SampleFormatUint8, binary.LittleEndian, func(v int32) []byte { return []byte{byte(v>>16) ^ 0x80} }},
+		{SampleFormatInt16, binary.BigEndian, func(v int32) []byte { return binary.BigEndian.AppendUint16(nil, uint16(v>>8)) }},
+		{SampleFormatInt24, binary.LittleEndian, func(v int32) []byte { return []byte{byte(v), byte(v >> 8), byte(v >> 16)} }},
+		{SampleFormatInt24, binary.BigEndian, func(v int32) []byte { return []byte{byte(v >> 16), byte(v >> 8), byte(v)} }},
+		// a byte order other than the binary package's values
+		{SampleFormatInt24, struct{ binary.ByteOrder }{binary.BigEndian}, func(v int32) []byte { return []byte{byte(v >> 16), byte(v >> 8), byte(v)} }},
+		{SampleFormatInt32, binary.LittleEndian, func(v int32) []byte { return binary.LittleEndian.AppendUint32(nil, uint32(v<<8)) }},
+		{SampleFormatFloat32, binary.LittleEndian, func(v int32) []byte {
+			return binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(v)/(1<<23)))
+		}},
+		{SampleFormatFloat64, binary.LittleEndian, func(v int32) []byte {
+			return binary.LittleEndian.AppendUint64(nil, math.Float64bits(float64(v)/(1<<23)))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format.String()+" "+tt.order.String(), func(t *testing.T) {
+			var want []byte
+			for i := 0; i < n; i++ {
+				for ch := range audio {
+					want = append(want, tt.sample(audio[ch][i])...)
+				}
+			}
+
+			p := NewPCMReader(NewReader(bytes.NewReader(stream.Bytes())), tt.format, tt.order)
+			var got []byte
+			buf := make([]byte, 1000)
+			for {
+				n, err := p.Read(buf)
+				if n%(2*tt.format.Size()) != 0 {
+					t.Fatalf("read %d bytes, not whole samples", n)
+				}
+				got = append(got, buf[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("read %d bytes that differ from the %d expected", len(got), len(want))
+			}
+		})
+	}
+
+	r := NewReader(bytes.NewReader(stream.Bytes()))
+	f, err := r.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s16, f32, f64 := f.Int16(), f.Float32(), f.Float64()
+	if len(s16) != 2*int(f.BlockSize) || s16[0] != math.MinInt16 || s16[1] != math.MaxInt16 || s16[3] != int16(audio[1][1]>>8) {
+		t.Errorf("Int16 = %v...", s16[:4])
+	}
+	if f32[0] != -1 || f64[0] != -1 || f64[1] >= 1 || f64[3] != float64(audio[1][1])/(1<<23) {
+		t.Errorf("Float32 = %v..., Float64 = %v...", f32[:4], f64[:4])
+	}
+}
@@ -0,0 +1,55 @@
+package flac
+
+// crc8Table is the lookup table for the CRC-8 (polynomial x^8 + x^2 + x^1 +
+// x^0) protecting frame headers.
+var crc8Table = makeCRC8Table(0x07)
+
+// crc16Table is the lookup table for the CRC-16 (polynomial x^16 + x^15 + x^2
+// + x^0) protecting entire frames.
+var crc16Table = makeCRC16Table(0x8005)
+
+func makeCRC8Table(poly uint8) (t [256]uint8) {
+	for i := range t {
+		crc := uint8(i)
+		for j := 0; j < 8; j++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}
+
+func makeCRC16Table(poly uint16) (t [256]uint16) {
+	for i := range t {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}
+
+// updateCRC8 returns the result of adding the bytes in p to crc.
+func updateCRC8(crc uint8, p []byte) uint8 {
+	for _, b := range p {
+		crc = crc8Table[crc^b]
+	}
+	return crc
+}
+
+// updateCRC16 returns the result of adding the bytes in p to crc.
+func updateCRC16(crc uint16, p []byte) uint16 {
+	for _, b := range p {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^b]
+	}
+	return crc
+}
@@ -1,6 +1,16 @@
 package flac
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidMCN  = errors.New("invalid media catalog number")
+	ErrInvalidISRC = errors.New("invalid ISRC")
+)
 
 // CueSheet represents a cue sheet metadata block data. This block is for
 // storing information that can be used in a cue sheet like track and index
@@ -8,7 +18,7 @@ import "encoding/binary"
 //
 // https://xiph.org/flac/format.html#metadata_block_cuesheet
 type CueSheet struct {
-	CatalogNumber    string
+	CatalogNumber    MCN
 	NumLeadInSamples uint64
 	IsCD             bool
 	Tracks           []*CueSheetTrack
@@ -20,7 +30,7 @@ type CueSheet struct {
 type CueSheetTrack struct {
 	OffsetSamples uint64 // track offset in samples, relative to the beginning of the FLAC audio stream.
 	TrackNumber   uint8
-	ISRC          string
+	ISRC          ISRC
 	IsAudio       bool
 	PreEmphasis   bool
 	Indices       []*CueSheetTrackIndex // track index points, except the lead-out track
@@ -34,13 +44,98 @@ type CueSheetTrackIndex struct {
 	PointNumber   uint8
 }
 
+// MCN is the media catalog number of a cue sheet, such as the 13 digit
+// UPC/EAN of a CD, without the NUL padding of the CUESHEET block.
+type MCN string
+
+// ParseMCN parses a 13 digit media catalog number.
+func ParseMCN(s string) (MCN, error) {
+	m := MCN(s)
+	if !m.Valid() {
+		return "", fmt.Errorf("%q: %w", s, ErrInvalidMCN)
+	}
+	return m, nil
+}
+
+// Valid reports whether m is a media catalog number of 13 digits.
+func (m MCN) Valid() bool {
+	return len(m) == 13 && isDigits(string(m))
+}
+
+// ISRC is the International Standard Recording Code of a track, 12
+// characters without hyphens: a 2 letter country code, a 3 character
+// registrant code, 2 digits of the year and 5 digits of the designation.
+type ISRC string
+
+// ParseISRC parses an ISRC with or without hyphens, such as
+// "US-RC1-76-07839". Letters are converted to upper case.
+func ParseISRC(s string) (ISRC, error) {
+	i := ISRC(strings.ToUpper(strings.ReplaceAll(s, "-", "")))
+	if !i.Valid() {
+		return "", fmt.Errorf("%q: %w", s, ErrInvalidISRC)
+	}
+	return i, nil
+}
+
+// Valid reports whether i is a well-formed ISRC.
+func (i ISRC) Valid() bool {
+	if len(i) != 12 {
+		return false
+	}
+	for n, c := range []byte(i) {
+		letter, digit := 'A' <= c && c <= 'Z', '0' <= c && c <= '9'
+		switch {
+		case n < 2 && !letter, n >= 2 && n < 5 && !letter && !digit, n >= 5 && !digit:
+			return false
+		}
+	}
+	return true
+}
+
+// Country returns the country code of i, or "" if i is not valid.
+func (i ISRC) Country() string {
+	return i.field(0, 2)
+}
+
+// Registrant returns the registrant code of i, or "" if i is not valid.
+func (i ISRC) Registrant() string {
+	return i.field(2, 5)
+}
+
+// Year returns the last 2 digits of the year of reference of i, or "" if i
+// is not valid.
+func (i ISRC) Year() string {
+	return i.field(5, 7)
+}
+
+// Designation returns the designation code of i, or "" if i is not valid.
+func (i ISRC) Designation() string {
+	return i.field(7, 12)
+}
+
+func (i ISRC) field(start, end int) string {
+	if !i.Valid() {
+		return ""
+	}
+	return string(i[start:end])
+}
+
+// String returns i with hyphens between its fields, such as
+// "US-RC1-76-07839", or unchanged if it is not valid.
+func (i ISRC) String() string {
+	if !i.Valid() {
+		return string(i)
+	}
+	return i.Country() + "-" + i.Registrant() + "-" + i.Year() + "-" + i.Designation()
+}
+
 func (r *Reader) decodeCueSheet() (*CueSheet, error) {
 	cueSheet := new(CueSheet)
 
 	if !r.readFull(r.buf[:128]) {
 		return nil, r.err
 	}
-	cueSheet.CatalogNumber = string(r.buf[:128])
+	cueSheet.CatalogNumber = MCN(strings.TrimRight(string(r.buf[:128]), "\x00"))
 
 	if err := binary.Read(r.r, binary.BigEndian, &cueSheet.NumLeadInSamples); err != nil {
 		return nil, err
@@ -88,14 +183,14 @@ func (r *Reader) decodeCueSheetTrack() (*CueSheetTrack, error) {
 	if !r.readFull(r.buf[:12]) {
 		return nil, r.err
 	}
-	track.ISRC = string(r.buf[:12])
+	track.ISRC = ISRC(strings.TrimRight(string(r.buf[:12]), "\x00"))
 
 	flags, ok := r.nextByte()
 	if !ok {
 		return nil, r.err
 	}
 
-	track.IsAudio = (flags & 0x80) != 0
+	track.IsAudio = (flags & 0x80) == 0 // 0 for audio, 1 for non-audio
 
 	track.PreEmphasis = (flags & 0x40) != 0
 
@@ -137,3 +232,207 @@ func (r *Reader) decodeCueSheetTrackIndex() (*CueSheetTrackIndex, error) {
 
 	return index, nil
 }
+
+// encodeCueSheet encodes a cue sheet, which must have a media catalog number
+// of 13 digits if it is of a CD, or else of at most 128 printable ASCII
+// characters, and well-formed ISRCs. Empty identifiers are allowed.
+func (w *Writer) encodeCueSheet(cueSheet *CueSheet) error {
+	if mcn := cueSheet.CatalogNumber; mcn != "" {
+		if cueSheet.IsCD && !mcn.Valid() || len(mcn) > 128 || !isPrintable(string(mcn)) {
+			return fmt.Errorf("%q: %w", string(mcn), ErrInvalidMCN)
+		}
+	}
+	for _, track := range cueSheet.Tracks {
+		if track.ISRC != "" && !track.ISRC.Valid() {
+			return fmt.Errorf("track %d %q: %w", track.TrackNumber, string(track.ISRC), ErrInvalidISRC)
+		}
+	}
+
+	var catalog [128]byte
+	copy(catalog[:], cueSheet.CatalogNumber)
+	w.buf.Write(catalog[:])
+
+	binary.Write(&w.buf, binary.BigEndian, cueSheet.NumLeadInSamples)
+
+	var flags [259]byte // flags and 258 reserved bytes
+	if cueSheet.IsCD {
+		flags[0] |= 0x80
+	}
+	w.buf.Write(flags[:])
+
+	w.buf.WriteByte(uint8(len(cueSheet.Tracks)))
+	for _, track := range cueSheet.Tracks {
+		w.encodeCueSheetTrack(track)
+	}
+	return nil
+}
+
+func (w *Writer) encodeCueSheetTrack(track *CueSheetTrack) {
+	binary.Write(&w.buf, binary.BigEndian, track.OffsetSamples)
+	w.buf.WriteByte(track.TrackNumber)
+
+	var isrc [12]byte
+	copy(isrc[:], track.ISRC)
+	w.buf.Write(isrc[:])
+
+	var flags [14]byte // flags and 13 reserved bytes
+	if !track.IsAudio {
+		flags[0] |= 0x80
+	}
+	if track.PreEmphasis {
+		flags[0] |= 0x40
+	}
+	w.buf.Write(flags[:])
+
+	w.buf.WriteByte(uint8(len(track.Indices)))
+	for _, index := range track.Indices {
+		binary.Write(&w.buf, binary.BigEndian, index.OffsetSamples)
+		w.buf.WriteByte(index.PointNumber)
+		w.buf.Write([]byte{0, 0, 0}) // 3 reserved bytes
+	}
+}
+
+// leadOutTrack is the number of the lead-out track of a cue sheet that is not
+// CD-DA.
+const leadOutTrack = 255
+
+// CueSheetViolation is a violation of the rules of the CUESHEET block.
+type CueSheetViolation struct {
+	// Track and Index are the positions in Tracks and Indices of the track
+	// and index point that violate the rule, or -1 for rules of the cue
+	// sheet or track.
+	Track, Index int
+	// Message describes the violation.
+	Message string
+}
+
+func (v CueSheetViolation) Error() string {
+	return v.Message
+}
+
+// Validate checks a cue sheet against the rules of the CUESHEET block for a
+// stream described by streamInfo, and returns the violations found. Offsets
+// are checked against TotalSamples if it is known, and streamInfo may be nil
+// if nothing is known about the stream. CD-DA cue sheets must
+// also have a lead-in of at least 2 seconds, tracks 1 to 99, sector aligned
+// offsets, 13 digit media catalog numbers and well-formed ISRCs.
+func (c *CueSheet) Validate(streamInfo *StreamInfo) []CueSheetViolation {
+	var vs []CueSheetViolation
+	report := func(track, index int, format string, args ...interface{}) {
+		vs = append(vs, CueSheetViolation{Track: track, Index: index, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch catalog := c.CatalogNumber; {
+	case c.IsCD && catalog != "" && !catalog.Valid():
+		report(-1, -1, "media catalog number %q is not 13 digits", catalog)
+	case !isPrintable(string(catalog)):
+		report(-1, -1, "media catalog number %q is not printable ASCII", catalog)
+	}
+	switch {
+	case c.IsCD && c.NumLeadInSamples < cdLeadIn*cdSectorSamples:
+		report(-1, -1, "lead-in of %d samples is shorter than 2 seconds", c.NumLeadInSamples)
+	case !c.IsCD && c.NumLeadInSamples != 0:
+		report(-1, -1, "lead-in of %d samples is not 0 for a cue sheet that is not CD-DA", c.NumLeadInSamples)
+	}
+	var totalSamples uint64
+	if streamInfo != nil {
+		totalSamples = streamInfo.TotalSamples
+	}
+	if c.IsCD && streamInfo != nil && streamInfo.SampleRate != 44100 {
+		report(-1, -1, "CD-DA cue sheet of a stream of %d Hz", streamInfo.SampleRate)
+	}
+
+	leadOut := uint8(leadOutTrack)
+	if c.IsCD {
+		leadOut = cdLeadOutTrack
+	}
+	switch {
+	case len(c.Tracks) == 0:
+		report(-1, -1, "no lead-out track")
+		return vs
+	case c.Tracks[len(c.Tracks)-1].TrackNumber != leadOut:
+		report(len(c.Tracks)-1, -1, "last track %d is not lead-out track %d", c.Tracks[len(c.Tracks)-1].TrackNumber, leadOut)
+	case c.IsCD && len(c.Tracks) > 100:
+		report(-1, -1, "%d tracks and the lead-out exceed 99 tracks", len(c.Tracks)-1)
+	}
+
+	seen := make(map[uint8]bool)
+	var prev uint64 // offset of the previous track or index point
+	for i, t := range c.Tracks {
+		n := t.TrackNumber
+		last := i == len(c.Tracks)-1
+		switch {
+		case seen[n]:
+			report(i, -1, "track number %d is not unique", n)
+		case n == 0:
+			report(i, -1, "track number 0 is not allowed")
+		case !last && n == leadOut:
+			report(i, -1, "lead-out track %d is not the last track", n)
+		case !last && c.IsCD && n > 99:
+			report(i, -1, "track number %d is out of the CD-DA range 1-99", n)
+		}
+		seen[n] = true
+
+		if t.ISRC != "" && !t.ISRC.Valid() {
+			report(i, -1, "track %d ISRC %q is not 2 letters, 3 letters or digits and 7 digits", n, string(t.ISRC))
+		}
+		if c.IsCD && t.OffsetSamples%cdSectorSamples != 0 {
+			report(i, -1, "track %d offset %d is not a multiple of %d samples", n, t.OffsetSamples, cdSectorSamples)
+		}
+		if i > 0 && t.OffsetSamples <= prev {
+			report(i, -1, "track %d offset %d does not follow offset %d of the previous track", n, t.OffsetSamples, prev)
+		}
+		if si := totalSamples; si > 0 && (t.OffsetSamples > si || !last && t.OffsetSamples == si) {
+			report(i, -1, "track %d offset %d is beyond the end of the stream of %d samples", n, t.OffsetSamples, si)
+		}
+		prev = max(prev, t.OffsetSamples)
+
+		switch {
+		case last && len(t.Indices) > 0:
+			report(i, -1, "lead-out track %d has index points", n)
+			continue
+		case !last && len(t.Indices) == 0:
+			report(i, -1, "track %d has no index points", n)
+		}
+		for j, x := range t.Indices {
+			offset := t.OffsetSamples + x.OffsetSamples
+			switch {
+			case j == 0 && x.PointNumber > 1:
+				report(i, j, "track %d first index point %d is not 0 or 1", n, x.PointNumber)
+			case j > 0 && x.PointNumber != t.Indices[j-1].PointNumber+1:
+				report(i, j, "track %d index point %d does not follow index point %d", n, x.PointNumber, t.Indices[j-1].PointNumber)
+			}
+			if c.IsCD && x.OffsetSamples%cdSectorSamples != 0 {
+				report(i, j, "track %d index point %d offset %d is not a multiple of %d samples", n, x.PointNumber, x.OffsetSamples, cdSectorSamples)
+			}
+			if j > 0 && offset <= prev {
+				report(i, j, "track %d index point %d offset %d does not follow offset %d", n, x.PointNumber, offset, prev)
+			}
+			if si := totalSamples; si > 0 && offset >= si {
+				report(i, j, "track %d index point %d offset %d is beyond the end of the stream of %d samples", n, x.PointNumber, offset, si)
+			}
+			prev = max(prev, offset)
+		}
+	}
+	return vs
+}
+
+// isDigits reports whether s consists of decimal digits.
+func isDigits(s string) bool {
+	for _, c := range []byte(s) {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isPrintable reports whether s consists of printable ASCII characters.
+func isPrintable(s string) bool {
+	for _, c := range []byte(s) {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCueSheetValidate(t *testing.T) {
+	cd := &StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 16, TotalSamples: 40 * cdSectorSamples}
+	valid := func() *CueSheet {
+		cs := testCDCueSheet(2, 0, 10, 25, 40)
+		cs.CatalogNumber = "0123456789012"
+		cs.Tracks[1].ISRC = "USRC17607839"
+		cs.Tracks[2].Indices = append(cs.Tracks[2].Indices, &CueSheetTrackIndex{PointNumber: 2, OffsetSamples: 5 * cdSectorSamples})
+		return cs
+	}
+	if vs := valid().Validate(cd); len(vs) != 0 {
+		t.Errorf("valid cue sheet: %v", vs)
+	}
+	nonCD := &CueSheet{Tracks: []*CueSheetTrack{
+		{TrackNumber: 1, Indices: []*CueSheetTrackIndex{{PointNumber: 1}}},
+		{TrackNumber: 2, OffsetSamples: 1000, Indices: []*CueSheetTrackIndex{{PointNumber: 1}}},
+		{TrackNumber: leadOutTrack, OffsetSamples: 3000},
+	}}
+	if vs := nonCD.Validate(&StreamInfo{SampleRate: 48000, TotalSamples: 3000}); len(vs) != 0 {
+		t.Errorf("valid cue sheet that is not CD-DA: %v", vs)
+	}
+
+	for _, tt := range []struct {
+		desc         string
+		edit         func(cs *CueSheet)
+		track, index int
+		want         []string
+	}{
+		{"catalog", func(cs *CueSheet) { cs.CatalogNumber = "12345" }, -1, -1, []string{"not 13 digits"}},
+		{"lead-in", func(cs *CueSheet) { cs.NumLeadInSamples = 0 }, -1, -1, []string{"shorter than 2 seconds"}},
+		{"no lead-out", func(cs *CueSheet) { cs.Tracks[3].TrackNumber = 4 }, 3, -1, []string{"last track 4 is not lead-out track 170"}},
+		{"track number", func(cs *CueSheet) { cs.Tracks[1].TrackNumber = 100 }, 1, -1, []string{"out of the CD-DA range"}},
+		{"duplicate track", func(cs *CueSheet) { cs.Tracks[2].TrackNumber = 2 }, 2, -1, []string{"not unique"}},
+		{"ISRC", func(cs *CueSheet) { cs.Tracks[0].ISRC = "US-RC1760783" }, 0, -1, []string{"ISRC"}},
+		{"track alignment", func(cs *CueSheet) { cs.Tracks[1].OffsetSamples++ }, 1, -1, []string{"not a multiple of 588"}},
+		{"track order", func(cs *CueSheet) { cs.Tracks[2].OffsetSamples = 10 * cdSectorSamples }, 2, -1, []string{"does not follow offset"}},
+		{"first index", func(cs *CueSheet) { cs.Tracks[1].Indices[0].PointNumber = 2 }, 1, 0, []string{"is not 0 or 1"}},
+		{"index sequence", func(cs *CueSheet) { cs.Tracks[2].Indices[1].PointNumber = 3 }, 2, 1, []string{"does not follow index point 1"}},
+		{"index alignment", func(cs *CueSheet) { cs.Tracks[2].Indices[1].OffsetSamples = 1000 }, 2, 1, []string{"not a multiple of 588"}},
+		{"index order", func(cs *CueSheet) { cs.Tracks[2].Indices[1].OffsetSamples = 0 }, 2, 1, []string{"does not follow offset"}},
+		{"missing index", func(cs *CueSheet) { cs.Tracks[1].Indices = nil }, 1, -1, []string{"no index points"}},
+		{"lead-out index", func(cs *CueSheet) { cs.Tracks[3].Indices = []*CueSheetTrackIndex{{PointNumber: 1}} }, 3, -1, []string{"lead-out track 170 has index points"}},
+		{"beyond end", func(cs *CueSheet) { cs.Tracks[3].OffsetSamples = 41 * cdSectorSamples }, 3, -1, []string{"beyond the end of the stream"}},
+	} {
+		cs := valid()
+		tt.edit(cs)
+		vs := cs.Validate(cd)
+		if len(vs) != 1 {
+			t.Errorf("%s: got %d violations %v, want 1", tt.desc, len(vs), vs)
+			continue
+		}
+		if vs[0].Track != tt.track || vs[0].Index != tt.index {
+			t.Errorf("%s: violation of track %d index %d, want %d and %d", tt.desc, vs[0].Track, vs[0].Index, tt.track, tt.index)
+		}
+		for _, w := range tt.want {
+			if !strings.Contains(vs[0].Error(), w) {
+				t.Errorf("%s: %q does not contain %q", tt.desc, vs[0].Error(), w)
+			}
+		}
+	}
+
+	// violations are reported together
+	cs := valid()
+	cs.IsCD = false
+	if vs := cs.Validate(cd); len(vs) != 2 {
+		t.Errorf("CD-DA cue sheet without IsCD: got %v, want lead-in and lead-out violations", vs)
+	}
+	if vs := (&CueSheet{}).Validate(cd); len(vs) != 1 || vs[0].Message != "no lead-out track" {
+		t.Errorf("empty cue sheet: %v", vs)
+	}
+
+	// without a stream, only the cue sheet itself is checked
+	if vs := valid().Validate(nil); len(vs) != 0 {
+		t.Errorf("valid cue sheet without a stream: %v", vs)
+	}
+	cs = valid()
+	cs.Tracks[1].OffsetSamples = 0
+	if vs := cs.Validate(nil); len(vs) != 1 {
+		t.Errorf("unordered cue sheet without a stream: %v", vs)
+	}
+}
+
+func TestCueSheetIdentifiers(t *testing.T) {
+	isrc, err := ParseISRC("us-rc1-76-07839")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isrc != "USRC17607839" || isrc.String() != "US-RC1-76-07839" {
+		t.Errorf("ParseISRC = %q, String = %q", string(isrc), isrc)
+	}
+	if got := []string{isrc.Country(), isrc.Registrant(), isrc.Year(), isrc.Designation()}; strings.Join(got, " ") != "US RC1 76 07839" {
+		t.Errorf("fields %q", got)
+	}
+	for _, s := range []string{"", "USRC1760783", "U1RC17607839", "US-RC!-76-07839", "USRC1760783X", "USRC176078390"} {
+		if _, err := ParseISRC(s); !errors.Is(err, ErrInvalidISRC) {
+			t.Errorf("ParseISRC(%q) error %v, want ErrInvalidISRC", s, err)
+		}
+	}
+	if bad := ISRC("usrc17607839"); bad.String() != "usrc17607839" || bad.Country() != "" {
+		t.Errorf("invalid ISRC formatted as %q, country %q", bad, bad.Country())
+	}
+
+	if _, err := ParseMCN("0123456789012"); err != nil {
+		t.Error(err)
+	}
+	for _, s := range []string{"", "123456789012", "012345678901X"} {
+		if _, err := ParseMCN(s); !errors.Is(err, ErrInvalidMCN) {
+			t.Errorf("ParseMCN(%q) error %v, want ErrInvalidMCN", s, err)
+		}
+	}
+
+	// identifiers are padded with NULs in the block and trimmed when read
+	cs := testCDCueSheet(2, 0, 10)
+	cs.CatalogNumber = "0123456789012"
+	cs.Tracks[0].ISRC = isrc
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.WriteBlock(&MetadataBlock{MetadataBlockHeader: MetadataBlockHeader{Type: MetadataBlockTypeCueSheet}, Data: cs}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("0123456789012\x00\x00")) {
+		t.Error("media catalog number is not padded with NULs")
+	}
+
+	// invalid identifiers are not written cut short
+	write := func(cs *CueSheet) error {
+		return NewWriter(io.Discard).WriteBlock(&MetadataBlock{MetadataBlockHeader: MetadataBlockHeader{Type: MetadataBlockTypeCueSheet}, Data: cs})
+	}
+	cs.Tracks[0].ISRC = ISRC(isrc.String())
+	if err := write(cs); !errors.Is(err, ErrInvalidISRC) {
+		t.Errorf("hyphenated ISRC written with error %v, want ErrInvalidISRC", err)
+	}
+	cs.Tracks[0].ISRC = ""
+	cs.CatalogNumber = "12345"
+	if err := write(cs); !errors.Is(err, ErrInvalidMCN) {
+		t.Errorf("CD media catalog number of 5 digits written with error %v, want ErrInvalidMCN", err)
+	}
+	cs.IsCD = false
+	if err := write(cs); err != nil {
+		t.Errorf("catalog number of a cue sheet that is not CD-DA: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package flac
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
@@ -11,34 +12,196 @@ import (
 
 var (
 	ErrMissingStreamMarker = errors.New("missing fLaC marker at beginning of stream")
+	ErrInvalidFrameSync    = errors.New("invalid frame sync code")
+	ErrReservedValue       = errors.New("reserved value in frame")
+	ErrCRCMismatch         = errors.New("frame CRC mismatch")
 )
 
 type bitReader interface {
 	io.Reader
 	ReadBits(n uint8) (uint64, error)
+	ReadBool() (bool, error)
+	Align() uint8
+}
+
+// countingReader keeps track of the number of bytes read from the underlying
+// stream and the running frame CRCs over those bytes.
+type countingReader struct {
+	r     *bufio.Reader
+	n     int64
+	crc8  uint8
+	crc16 uint16
+}
+
+func newCountingReader(r io.Reader) *countingReader {
+	return &countingReader{r: bufio.NewReader(r)}
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.crc8 = updateCRC8(c.crc8, p[:n])
+	c.crc16 = updateCRC16(c.crc16, p[:n])
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	c.n++
+	c.crc8 = crc8Table[c.crc8^b]
+	c.crc16 = c.crc16<<8 ^ crc16Table[byte(c.crc16>>8)^b]
+	return b, nil
+}
+
+// resetCRC restarts the running CRCs at the current position.
+func (c *countingReader) resetCRC() {
+	c.crc8 = 0
+	c.crc16 = 0
 }
 
 type Reader struct {
 	r             bitReader
+	cr            *countingReader
 	err           error
 	buf           []byte
 	readMarker    bool
 	readLastBlock bool
+
+	// streamInfo is the STREAMINFO block of the stream, if read.
+	streamInfo *StreamInfo
+	// blockSize is the block size of a fixed-blocksize stream, used to turn
+	// frame numbers into sample numbers.
+	blockSize uint16
+	// keepResidual is set while AnalyzeFrame decodes a frame.
+	keepResidual bool
+	// scan is set for a Reader of bare frames from NewFrameReader.
+	scan bool
+
+	// ErrorPolicy determines how ReadFrame handles damaged frames.
+	ErrorPolicy ErrorPolicy
+	// OnFrameError, if set, is called with every damaged frame, whatever the
+	// error policy.
+	OnFrameError func(*FrameError)
+	// IgnoreTotalSamples disregards the number of samples given in
+	// STREAMINFO, so that a stream ending before it is not reported as
+	// truncated. It is meant for streams whose STREAMINFO is being
+	// recomputed.
+	IgnoreTotalSamples bool
+	// Gain, if set, makes ReadFrame apply the gain stored in the first
+	// VORBIS_COMMENT block of the stream to the decoded audio. Streams
+	// without a stored gain are left unchanged. The audio then no longer
+	// matches the MD5 signature of STREAMINFO. The gain is computed when
+	// the first frame is read, so Gain must be set before then.
+	Gain *GainConfig
+
+	// nextSample is the number of the sample following the last frame read.
+	nextSample uint64
+	// damaged describes the damaged stretch since the last valid frame, if
+	// any.
+	damaged *damage
+	// pending holds frames to return before reading further.
+	pending []*Frame
+
+	// src is the underlying reader, and start its position at the start of
+	// the stream if it is an io.Seeker.
+	src   io.Reader
+	start int64
+	// framesOffset is the offset of the first frame from the start of the
+	// stream, once the metadata blocks have been read.
+	framesOffset int64
+	// seekTable is the first SEEKTABLE block of the stream, if any.
+	seekTable *SeekTable
+	// vorbisComment is the first VORBIS_COMMENT block of the stream, if any.
+	vorbisComment *VorbisComment
+	// gainScale is the factor of the gain selected by Gain, or 0 until the
+	// first frame is read.
+	gainScale float64
+	// gainClipped is the number of samples clipped by Gain.
+	gainClipped uint64
 }
 
 func NewReader(r io.Reader) *Reader {
-	return &Reader{
-		r:   bitio.NewReader(r),
+	cr := newCountingReader(r)
+	fr := &Reader{
+		r:   bitio.NewReader(cr),
+		cr:  cr,
 		buf: make([]byte, 1024),
 	}
+	fr.setSource(r)
+	return fr
+}
+
+// setSource records the underlying reader and, if it is seekable, its
+// position.
+func (r *Reader) setSource(src io.Reader) {
+	r.src, r.start = src, 0
+	if s, ok := src.(io.Seeker); ok {
+		r.start, _ = s.Seek(0, io.SeekCurrent)
+	}
+}
+
+// NewFrameReader returns a Reader for a stream of bare audio frames without
+// the fLaC marker and metadata blocks, such as a capture that starts in the
+// middle of a stream or a dump of frames. The first frame is found by scanning
+// for a frame sync code followed by a frame header with a valid CRC-8, and
+// the audio format is inferred from its header: StreamInfo returns a
+// STREAMINFO block with the sample rate, channels and bits per sample of the
+// first frame, and with the sizes, total number of samples and MD5 signature
+// unknown.
+func NewFrameReader(r io.Reader) *Reader {
+	fr := NewReader(r)
+	fr.scan = true
+	fr.readMarker = true
+	fr.readLastBlock = true
+	return fr
 }
 
 func (r *Reader) Reset(reader io.Reader) {
-	r.r = bitio.NewReader(reader)
+	r.cr = newCountingReader(reader)
+	r.r = bitio.NewReader(r.cr)
 	r.err = nil
 	r.buf = make([]byte, 1024)
 	r.readMarker = false
 	r.readLastBlock = false
+	r.streamInfo = nil
+	r.blockSize = 0
+	r.nextSample = 0
+	r.damaged = nil
+	r.pending = nil
+	r.framesOffset = 0
+	r.seekTable = nil
+	r.vorbisComment = nil
+	r.gainScale = 0
+	r.gainClipped = 0
+	r.setSource(reader)
+	if r.scan {
+		r.readMarker = true
+		r.readLastBlock = true
+	}
+}
+
+// StreamInfo returns the STREAMINFO block of the stream, or nil if it has not
+// been read yet.
+func (r *Reader) StreamInfo() *StreamInfo {
+	return r.streamInfo
+}
+
+// totalSamples returns the number of samples given in STREAMINFO, or 0 if it
+// is unknown or ignored.
+func (r *Reader) totalSamples() uint64 {
+	if r.streamInfo == nil || r.IgnoreTotalSamples {
+		return 0
+	}
+	return r.streamInfo.TotalSamples
+}
+
+// GainClipped returns the number of samples clipped so far by applying
+// r.Gain.
+func (r *Reader) GainClipped() uint64 {
+	return r.gainClipped
 }
 
 // fill reads n bytes into r.buf.
@@ -102,13 +265,22 @@ func (r *Reader) readBlock() (*MetadataBlock, bool) {
 
 	switch b.Type {
 	case MetadataBlockTypeStreamInfo:
-		b.Data, r.err = r.decodeStreamInfo()
+		r.streamInfo, r.err = r.decodeStreamInfo()
+		b.Data = r.streamInfo
 	case MetadataBlockTypeApplication:
 		b.Data, r.err = r.decodeApplication(b.Length)
 	case MetadataBlockTypeSeekTable:
-		b.Data, r.err = r.decodeSeekTable(b.Length)
+		var t *SeekTable
+		if t, r.err = r.decodeSeekTable(b.Length); r.seekTable == nil {
+			r.seekTable = t
+		}
+		b.Data = t
 	case MetadataBlockTypeVorbisComment:
-		b.Data, r.err = r.decodeVorbisComment()
+		var vc *VorbisComment
+		if vc, r.err = r.decodeVorbisComment(); r.vorbisComment == nil {
+			r.vorbisComment = vc
+		}
+		b.Data = vc
 	case MetadataBlockTypeCueSheet:
 		b.Data, r.err = r.decodeCueSheet()
 	case MetadataBlockTypePicture:
@@ -142,6 +314,9 @@ func (r *Reader) ReadBlock() (*MetadataBlock, error) {
 	}
 
 	r.readLastBlock = block.Last
+	if block.Last {
+		r.framesOffset = r.cr.n
+	}
 
 	return block, nil
 }
@@ -0,0 +1,127 @@
+package flac
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotCDDA is returned for a cue sheet or stream that is not CD-DA: a
+// CueSheet with IsCD set and sector aligned tracks ending in a lead-out
+// track, of 44.1 kHz, 16 bit stereo audio.
+var ErrNotCDDA = errors.New("not CD-DA")
+
+const (
+	cdSectorSamples = 588 // samples of each channel of a CD sector
+	cdLeadIn        = 150 // sectors of the pregap of the first track
+	cdLeadOutTrack  = 170
+)
+
+// cdTOC returns the table of contents of a CD-DA cue sheet: the offset in
+// sectors of index point 1 of each track, and of the lead-out track last.
+func cdTOC(cueSheet *CueSheet) ([]uint32, error) {
+	if !cueSheet.IsCD {
+		return nil, fmt.Errorf("cue sheet is not of a CD: %w", ErrNotCDDA)
+	}
+	n := len(cueSheet.Tracks)
+	if n < 2 || cueSheet.Tracks[n-1].TrackNumber != cdLeadOutTrack {
+		return nil, fmt.Errorf("cue sheet has no tracks or lead-out: %w", ErrNotCDDA)
+	}
+	toc := make([]uint32, n)
+	for i, t := range cueSheet.Tracks {
+		offset := t.OffsetSamples
+		for _, idx := range t.Indices {
+			if idx.PointNumber == 1 {
+				offset += idx.OffsetSamples
+				break
+			}
+		}
+		if offset%cdSectorSamples != 0 {
+			return nil, fmt.Errorf("track %d is not sector aligned: %w", t.TrackNumber, ErrNotCDDA)
+		}
+		if i > 0 && offset/cdSectorSamples <= uint64(toc[i-1]) {
+			return nil, fmt.Errorf("track %d does not follow track %d: %w", t.TrackNumber, cueSheet.Tracks[i-1].TrackNumber, ErrNotCDDA)
+		}
+		toc[i] = uint32(offset / cdSectorSamples)
+	}
+	return toc, nil
+}
+
+// CDTOC is the table of contents of a CD, the key to look it up in online
+// databases.
+type CDTOC struct {
+	// FirstTrack and LastTrack are the numbers of the first and last track.
+	FirstTrack, LastTrack uint8
+	// Offsets are the offsets in sectors of index point 1 of each track, and
+	// LeadOut that of the lead-out track. As on the disc, offsets count the
+	// 150 sectors of the pregap of the first track.
+	Offsets []uint32
+	LeadOut uint32
+}
+
+// NewCDTOC returns the table of contents of a CD-DA cue sheet.
+func NewCDTOC(cueSheet *CueSheet) (*CDTOC, error) {
+	toc, err := cdTOC(cueSheet)
+	if err != nil {
+		return nil, err
+	}
+	tracks := len(toc) - 1
+	t := &CDTOC{
+		FirstTrack: cueSheet.Tracks[0].TrackNumber,
+		LastTrack:  cueSheet.Tracks[tracks-1].TrackNumber,
+		LeadOut:    toc[tracks] + cdLeadIn,
+	}
+	for _, offset := range toc[:tracks] {
+		t.Offsets = append(t.Offsets, offset+cdLeadIn)
+	}
+	return t, nil
+}
+
+// String returns the table of contents in the form of the toc parameter of
+// the MusicBrainz web service: the first and last track number, the lead-out
+// offset and the track offsets, separated by spaces, such as
+// "1 3 30150 150 10150 20150".
+func (t *CDTOC) String() string {
+	fields := []string{fmt.Sprint(t.FirstTrack), fmt.Sprint(t.LastTrack), fmt.Sprint(t.LeadOut)}
+	for _, offset := range t.Offsets {
+		fields = append(fields, fmt.Sprint(offset))
+	}
+	return strings.Join(fields, " ")
+}
+
+// musicBrainzEncoding is the base64 encoding of MusicBrainz disc IDs, which
+// are used in URLs.
+var musicBrainzEncoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789._").WithPadding('-')
+
+// MusicBrainzDiscID returns the MusicBrainz disc ID: the SHA-1 of the track
+// numbers and 100 offsets in hexadecimal, in a URL safe base64 encoding.
+// The offsets of tracks 1 to 99 are in the slots of their track numbers, with
+// 0 for tracks not on the disc.
+func (t *CDTOC) MusicBrainzDiscID() string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%02X%02X%08X", t.FirstTrack, t.LastTrack, t.LeadOut)
+	for n := 1; n <= 99; n++ {
+		var offset uint32
+		if i := n - int(t.FirstTrack); i >= 0 && i < len(t.Offsets) {
+			offset = t.Offsets[i]
+		}
+		fmt.Fprintf(h, "%08X", offset)
+	}
+	return musicBrainzEncoding.EncodeToString(h.Sum(nil))
+}
+
+// FreedbDiscID returns the freedb (CDDB) disc ID: the sum of the digits of
+// the track offsets in seconds modulo 255, the length of the disc in seconds
+// and the number of tracks.
+func (t *CDTOC) FreedbDiscID() uint32 {
+	var sum uint32
+	for _, offset := range t.Offsets {
+		for s := offset / 75; s > 0; s /= 10 {
+			sum += s % 10
+		}
+	}
+	length := t.LeadOut/75 - t.Offsets[0]/75
+	return sum%255<<24 | length<<8 | uint32(len(t.Offsets))
+}
@@ -0,0 +1,50 @@
+package flac
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCDTOC(t *testing.T) {
+	// a disc of 12 tracks
+	offsets := []uint64{150, 22767, 41887, 58317, 72102, 91375, 104652, 115380, 132165, 143932, 159870, 174597, 267257}
+	for i := range offsets {
+		offsets[i] -= cdLeadIn
+	}
+	toc, err := NewCDTOC(testCDCueSheet(0, offsets...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := toc.String(), "1 12 267257 150 22767 41887 58317 72102 91375 104652 115380 132165 143932 159870 174597"; got != want {
+		t.Errorf("TOC %q, want %q", got, want)
+	}
+	if got, want := toc.MusicBrainzDiscID(), "I5l9cCSFccLKFEKS.7wqSZAorPU-"; got != want {
+		t.Errorf("MusicBrainz disc ID %q, want %q", got, want)
+	}
+	// the digits of the offsets of 2, 303, 558, 777, 961, 1218, 1395, 1538,
+	// 1762, 1919, 2131 and 2327 seconds sum to 167, and the disc is 3561
+	// seconds long
+	if got, want := toc.FreedbDiscID(), uint32(167<<24|3561<<8|12); got != want {
+		t.Errorf("freedb disc ID %08x, want %08x", got, want)
+	}
+
+	// a disc starting at track 3, with a pregap before index point 1
+	cs := testCDCueSheet(2, 0, 1000, 2000)
+	for i, tr := range cs.Tracks[:2] {
+		tr.TrackNumber = uint8(i + 3)
+	}
+	toc, err = NewCDTOC(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := toc.String(), "3 4 2150 152 1150"; got != want {
+		t.Errorf("TOC %q, want %q", got, want)
+	}
+	if got, want := toc.MusicBrainzDiscID(), "hDIDXO69CzYDLMFctEcNGP3dskk-"; got != want {
+		t.Errorf("MusicBrainz disc ID %q, want %q", got, want)
+	}
+
+	if _, err := NewCDTOC(&CueSheet{Tracks: cs.Tracks}); !errors.Is(err, ErrNotCDDA) {
+		t.Errorf("cue sheet not of a CD: got %v, want ErrNotCDDA", err)
+	}
+}
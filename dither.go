@@ -0,0 +1,141 @@
+package flac
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// NoiseShaping is an error feedback filter of a Quantizer, which moves the
+// requantization noise to the high frequencies where it is less audible.
+type NoiseShaping uint8
+
+const (
+	NoiseShapingNone NoiseShaping = iota
+	// NoiseShapingFirstOrder is a first order highpass.
+	NoiseShapingFirstOrder
+	// NoiseShapingWannamaker is the 3 tap F-weighted filter of Wannamaker.
+	NoiseShapingWannamaker
+	// NoiseShapingLipshitz is the 5 tap improved E-weighted filter of
+	// Lipshitz, Vanderkooy and Wannamaker, designed for 44.1 kHz.
+	NoiseShapingLipshitz
+)
+
+// noiseShapingFilters are the coefficients of the noise shaping filters, by
+// which the errors of the previous samples, most recent first, are fed back.
+var noiseShapingFilters = [...][]float64{
+	NoiseShapingNone:       nil,
+	NoiseShapingFirstOrder: {1},
+	NoiseShapingWannamaker: {1.623, -0.982, 0.109},
+	NoiseShapingLipshitz:   {2.033, -2.165, 1.959, -1.590, 0.6149},
+}
+
+func (s NoiseShaping) String() string {
+	switch s {
+	case NoiseShapingNone:
+		return "none"
+	case NoiseShapingFirstOrder:
+		return "first-order"
+	case NoiseShapingWannamaker:
+		return "wannamaker"
+	case NoiseShapingLipshitz:
+		return "lipshitz"
+	}
+	return fmt.Sprintf("NoiseShaping(%d)", s)
+}
+
+// QuantizerConfig holds the settings of a Quantizer.
+type QuantizerConfig struct {
+	// BitsPerSample is the bits per sample of the output.
+	BitsPerSample uint8
+	// Dither adds triangular probability density (TPDF) dither of up to 1
+	// LSB of the output to the samples before rounding, which turns the
+	// distortion of the requantization into a constant noise floor.
+	Dither bool
+	// NoiseShaping filters the requantization noise.
+	NoiseShaping NoiseShaping
+	// Seed seeds the pseudo-random numbers of the dither, so that the same
+	// seed gives the same output.
+	Seed int64
+}
+
+// Quantizer reduces the bits per sample of decoded audio, such as 24 bit
+// masters delivered as 16 bit. It keeps the state of the noise shaping filter
+// of each channel from one block of samples to the next, so the blocks of a
+// stream must be passed in order.
+type Quantizer struct {
+	config  QuantizerConfig
+	filter  []float64
+	rnd     *rand.Rand
+	errs    [][]float64 // errors of the previous samples of each channel, most recent first
+	clipped uint64
+}
+
+// NewQuantizer returns a Quantizer with the given settings.
+func NewQuantizer(config QuantizerConfig) *Quantizer {
+	q := &Quantizer{
+		config: config,
+		rnd:    rand.New(rand.NewSource(config.Seed)),
+	}
+	if int(config.NoiseShaping) < len(noiseShapingFilters) {
+		q.filter = noiseShapingFilters[config.NoiseShaping]
+	}
+	return q
+}
+
+// Clipped returns the number of samples clipped so far, which the dither and
+// noise shaping can push past full scale.
+func (q *Quantizer) Clipped() uint64 {
+	return q.clipped
+}
+
+// QuantizeFrame reduces the samples of the frame to the bits per sample of
+// the Quantizer in place.
+func (q *Quantizer) QuantizeFrame(f *Frame) {
+	q.Quantize(f.Samples, f.BitsPerSample)
+	f.BitsPerSample = q.config.BitsPerSample
+}
+
+// Quantize reduces the channels of samples of bps bits to the bits per sample
+// of the Quantizer in place. Samples of no more bits are shifted without loss.
+func (q *Quantizer) Quantize(samples [][]int32, bps uint8) {
+	n := q.config.BitsPerSample
+	if bps <= n {
+		for _, ch := range samples {
+			for i, v := range ch {
+				ch[i] = v << (n - bps)
+			}
+		}
+		return
+	}
+
+	for len(q.errs) < len(samples) {
+		q.errs = append(q.errs, make([]float64, len(q.filter)))
+	}
+	scale := math.Ldexp(1, -int(bps-n))
+	lo, hi := -math.Ldexp(1, int(n)-1), math.Ldexp(1, int(n)-1)-1
+	for c, ch := range samples {
+		errs := q.errs[c]
+		for i, v := range ch {
+			u := float64(v) * scale
+			for k, h := range q.filter {
+				u -= h * errs[k]
+			}
+			y := u
+			if q.config.Dither {
+				y += q.rnd.Float64() - q.rnd.Float64()
+			}
+			y = math.Round(y)
+			if len(errs) > 0 {
+				copy(errs[1:], errs)
+				errs[0] = y - u
+			}
+
+			if y < lo || y > hi {
+				y = max(lo, min(y, hi))
+				q.clipped++
+			}
+			ch[i] = int32(y)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package flac
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// quietSine returns a 1 kHz sine of 24 bit samples at -40 dBFS.
+func quietSine(n int) []int32 {
+	return testSignal(n, func(i int) int32 {
+		return int32(math.Round(0.01 * (1 << 23) * math.Sin(2*math.Pi*float64(i)*1000/44100)))
+	})
+}
+
+func TestQuantizer(t *testing.T) {
+	const n = 8192
+
+	quantize := func(config QuantizerConfig, s []int32) (*Quantizer, []int32) {
+		q := NewQuantizer(config)
+		s = slices.Clone(s)
+		// in two blocks, as frames
+		q.Quantize([][]int32{s[:len(s)/2]}, 24)
+		q.Quantize([][]int32{s[len(s)/2:]}, 24)
+		return q, s
+	}
+	sine := quietSine(n)
+
+	// plain rounding
+	_, got := quantize(QuantizerConfig{BitsPerSample: 16}, sine)
+	for i, v := range got {
+		if want := int32(math.Round(float64(sine[i]) / 256)); v != want {
+			t.Fatalf("sample %d rounded to %d, want %d", i, v, want)
+		}
+	}
+
+	// the error of TPDF dither has a variance of 1/4 LSB², 1/12 of rounding
+	// and 1/6 of the dither
+	_, a := quantize(QuantizerConfig{BitsPerSample: 16, Dither: true, Seed: 1}, sine)
+	_, b := quantize(QuantizerConfig{BitsPerSample: 16, Dither: true, Seed: 1}, sine)
+	_, c := quantize(QuantizerConfig{BitsPerSample: 16, Dither: true, Seed: 2}, sine)
+	if !slices.Equal(a, b) || slices.Equal(a, c) {
+		t.Error("dither is not reproducible from its seed")
+	}
+	var sq float64
+	for i, v := range a {
+		d := float64(v) - float64(sine[i])/256
+		sq += d * d
+	}
+	if v := sq / n; v < 0.2 || v > 0.3 {
+		t.Errorf("dithered error variance = %.3f LSB², want 0.25", v)
+	}
+
+	// noise shaping moves the error to high frequencies, so that the error of
+	// neighboring samples is anticorrelated
+	for _, s := range []NoiseShaping{NoiseShapingNone, NoiseShapingFirstOrder, NoiseShapingWannamaker, NoiseShapingLipshitz} {
+		_, got := quantize(QuantizerConfig{BitsPerSample: 16, Dither: true, NoiseShaping: s}, sine)
+		var low, total float64
+		for i := 1; i < n; i++ {
+			e0 := float64(got[i-1]) - float64(sine[i-1])/256
+			e1 := float64(got[i]) - float64(sine[i])/256
+			low += (e0 + e1) * (e0 + e1)
+			total += e1 * e1
+		}
+		if ratio := low / total; s == NoiseShapingNone && (ratio < 1.5 || ratio > 2.5) || s != NoiseShapingNone && ratio > 1 {
+			t.Errorf("%s: low frequency error ratio %.2f", s, ratio)
+		}
+	}
+
+	// full scale clips with dither
+	full := testSignal(100, func(i int) int32 { return 1<<23 - 1 })
+	q, got := quantize(QuantizerConfig{BitsPerSample: 16, Dither: true}, full)
+	if q.Clipped() == 0 || slices.Max(got) != math.MaxInt16 {
+		t.Errorf("clipped %d samples, largest %d", q.Clipped(), slices.Max(got))
+	}
+
+	// fewer bits are shifted without loss
+	f := &Frame{FrameHeader: FrameHeader{BitsPerSample: 12}, Samples: [][]int32{{-2048, 2047}}}
+	NewQuantizer(QuantizerConfig{BitsPerSample: 16, Dither: true}).QuantizeFrame(f)
+	if f.BitsPerSample != 16 || !slices.Equal(f.Samples[0], []int32{-32768, 32752}) {
+		t.Errorf("12 bit frame to 16 bits = %d bits %v", f.BitsPerSample, f.Samples[0])
+	}
+}
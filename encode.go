@@ -0,0 +1,103 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxBlockLength is the largest metadata block length the 24 bit length
+// field of a metadata block header can hold.
+const maxBlockLength = 1<<24 - 1
+
+var (
+	ErrBlockTooLarge = errors.New("metadata block data exceeds 16 MiB")
+)
+
+// Writer writes a FLAC stream.
+type Writer struct {
+	w           io.Writer
+	err         error
+	buf         bytes.Buffer
+	wroteMarker bool
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (w *Writer) Reset(writer io.Writer) {
+	w.w = writer
+	w.err = nil
+	w.buf.Reset()
+	w.wroteMarker = false
+}
+
+func (w *Writer) write(p []byte) (ok bool) {
+	_, w.err = w.w.Write(p)
+	return w.err == nil
+}
+
+// WriteBlock writes a metadata block, preceded by the fLaC marker if it is the
+// first block of the stream. The Length of the block is set to the length of
+// its encoded data; only padding blocks, which have no data, are written with
+// the Length they already have.
+func (w *Writer) WriteBlock(b *MetadataBlock) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if !w.wroteMarker {
+		if !w.write([]byte("fLaC")) {
+			return w.err
+		}
+		w.wroteMarker = true
+	}
+
+	w.buf.Reset()
+	switch data := b.Data.(type) {
+	case *StreamInfo:
+		w.encodeStreamInfo(data)
+	case *Application:
+		w.encodeApplication(data)
+	case *SeekTable:
+		w.encodeSeekTable(data)
+	case *VorbisComment:
+		w.encodeVorbisComment(data)
+	case *CueSheet:
+		if err := w.encodeCueSheet(data); err != nil {
+			return fmt.Errorf("%s block: %w", b.Type, err)
+		}
+	case *Picture:
+		w.encodePicture(data)
+	case nil:
+		if b.Type != MetadataBlockTypePadding {
+			return fmt.Errorf("cannot encode %s block without data", b.Type)
+		}
+		w.buf.Write(make([]byte, b.Length))
+	default:
+		return fmt.Errorf("cannot encode block data of type %T", data)
+	}
+
+	if w.buf.Len() > maxBlockLength {
+		return fmt.Errorf("%s block: %w", b.Type, ErrBlockTooLarge)
+	}
+	b.Length = uint32(w.buf.Len())
+
+	// <1 bit> Last-metadata-block flag, <7 bits> Block type
+	header := [4]byte{byte(b.Type) & 0b1111111}
+	if b.Last {
+		header[0] |= 0b10000000
+	}
+	// <24 bits> Block length in bytes (big endian encoded)
+	header[1] = byte(b.Length >> 16)
+	header[2] = byte(b.Length >> 8)
+	header[3] = byte(b.Length)
+
+	if !w.write(header[:]) || !w.write(w.buf.Bytes()) {
+		return w.err
+	}
+
+	return nil
+}
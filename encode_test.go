@@ -0,0 +1,101 @@
+package flac
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWriteBlock(t *testing.T) {
+	blocks := []*MetadataBlock{
+		{
+			MetadataBlockHeader: MetadataBlockHeader{Type: MetadataBlockTypeStreamInfo},
+			Data: &StreamInfo{
+				MinimumBlockSize: 4096,
+				MaximumBlockSize: 4096,
+				MinimumFrameSize: 14,
+				MaximumFrameSize: 12345,
+				SampleRate:       44100,
+				Channels:         2,
+				BitsPerSample:    16,
+				TotalSamples:     1<<36 - 1,
+				MD5:              bytes.Repeat([]byte{0xab}, 16),
+			},
+		},
+		{
+			MetadataBlockHeader: MetadataBlockHeader{Type: MetadataBlockTypePadding, Length: 100},
+		},
+		{
+			MetadataBlockHeader: MetadataBlockHeader{Type: MetadataBlockTypeApplication},
+			Data:                &Application{ID: "test", Data: []byte("application data")},
+		},
+		{
+			MetadataBlockHeader: MetadataBlockHeader{Type: MetadataBlockTypeSeekTable},
+			Data: &SeekTable{SeekPoints: []*SeekPoint{
+				{SampleNumber: 0, Offset: 0, NumSamples: 4096},
+				{SampleNumber: 40960, Offset: 31337, NumSamples: 4096},
+				{SampleNumber: PlaceholderSampleNumber},
+			}},
+		},
+		{
+			MetadataBlockHeader: MetadataBlockHeader{Type: MetadataBlockTypeVorbisComment},
+			Data:                &VorbisComment{Vendor: "vendor", UserComments: []string{"TITLE=a", "ARTIST=b"}},
+		},
+		{
+			MetadataBlockHeader: MetadataBlockHeader{Type: MetadataBlockTypeCueSheet},
+			Data: &CueSheet{
+				CatalogNumber:    "1234567890123",
+				NumLeadInSamples: 88200,
+				IsCD:             true,
+				Tracks: []*CueSheetTrack{
+					{
+						OffsetSamples: 0,
+						TrackNumber:   1,
+						ISRC:          "USRC17607839",
+						IsAudio:       true,
+						Indices:       []*CueSheetTrackIndex{{OffsetSamples: 0, PointNumber: 1}},
+					},
+					{
+						OffsetSamples: 588 * 100,
+						TrackNumber:   170,
+						IsAudio:       true,
+						Indices:       []*CueSheetTrackIndex{},
+					},
+				},
+			},
+		},
+		{
+			MetadataBlockHeader: MetadataBlockHeader{Type: MetadataBlockTypePicture, Last: true},
+			Data: &Picture{
+				Type:        PictureTypeCoverFront,
+				MimeType:    "image/png",
+				Description: "cover",
+				Width:       1,
+				Height:      2,
+				Depth:       24,
+				Data:        []byte{0x89, 'P', 'N', 'G'},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, b := range blocks {
+		if err := w.WriteBlock(b); err != nil {
+			t.Fatalf("%s: %v", b.Type, err)
+		}
+	}
+
+	got, err := readBlocks(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(blocks) {
+		t.Fatalf("read %d blocks, want %d", len(got), len(blocks))
+	}
+	for i := range blocks {
+		if !reflect.DeepEqual(got[i], blocks[i]) {
+			t.Errorf("block %d (%s) = %+v, want %+v", i, blocks[i].Type, got[i], blocks[i])
+		}
+	}
+}
@@ -0,0 +1,546 @@
+package flac
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/icza/bitio"
+)
+
+// EncoderConfig holds the settings of an Encoder.
+type EncoderConfig struct {
+	// BlockSize is the number of inter-channel samples of each frame.
+	BlockSize uint16
+	// MaxLPCOrder is the largest LPC predictor order to use. With 0 only
+	// FIXED predictors are used.
+	MaxLPCOrder int
+	// LPCPrecision is the precision of the quantized LPC coefficients in bits,
+	// or 0 to choose it from the block size.
+	LPCPrecision uint8
+	// MaxPartitionOrder is the largest Rice partition order to use.
+	MaxPartitionOrder int
+	// MidSide enables stereo decorrelation of 2 channel streams.
+	MidSide bool
+	// ExhaustiveModelSearch encodes every LPC order up to MaxLPCOrder and keeps
+	// the smallest, instead of estimating the best order.
+	ExhaustiveModelSearch bool
+	// VariableBlockSize lets the encoder end a block early, in steps of an
+	// eighth of BlockSize, before a transient in the audio, so that the sudden
+	// change in the signal starts a new block instead of degrading the
+	// prediction of the rest of the block. The frames are coded with the
+	// variable-blocksize strategy.
+	VariableBlockSize bool
+}
+
+// CompressionLevel returns the settings of compression level 0 (fastest)
+// through 8 (smallest), which follow those of the reference encoder.
+func CompressionLevel(level int) EncoderConfig {
+	switch {
+	case level <= 0:
+		return EncoderConfig{BlockSize: 1152, MaxPartitionOrder: 3}
+	case level <= 2:
+		return EncoderConfig{BlockSize: 1152, MaxPartitionOrder: 3, MidSide: true}
+	case level == 3:
+		return EncoderConfig{BlockSize: 4096, MaxLPCOrder: 6, MaxPartitionOrder: 4}
+	case level == 4:
+		return EncoderConfig{BlockSize: 4096, MaxLPCOrder: 8, MaxPartitionOrder: 4, MidSide: true}
+	case level == 5:
+		return EncoderConfig{BlockSize: 4096, MaxLPCOrder: 8, MaxPartitionOrder: 5, MidSide: true}
+	case level == 6:
+		return EncoderConfig{BlockSize: 4096, MaxLPCOrder: 8, MaxPartitionOrder: 6, MidSide: true}
+	}
+	// levels 7 and 8 differ only in the apodization functions of the
+	// reference encoder, and neither searches exhaustively
+	return EncoderConfig{BlockSize: 4096, MaxLPCOrder: 12, MaxPartitionOrder: 6, MidSide: true}
+}
+
+var (
+	ErrInvalidStreamInfo = errors.New("invalid stream parameters")
+	ErrEncoderClosed     = errors.New("encoder is closed")
+)
+
+// Encoder encodes audio samples to a FLAC stream.
+//
+// The STREAMINFO block is written with the MD5 signature, total samples and
+// frame sizes unknown. If the underlying writer is an io.WriteSeeker, Close
+// rewrites the metadata blocks with those values and with the seek points of
+// a SEEKTABLE block resolved.
+type Encoder struct {
+	w      *Writer
+	dst    io.Writer
+	config EncoderConfig
+
+	info      *StreamInfo
+	blocks    []*MetadataBlock
+	seekTable *SeekTable
+	md5       *AudioMD5
+
+	pending      [][]int32 // samples not yet encoded
+	frameNumber  uint64
+	sampleNumber uint64
+	offset       uint64 // bytes of frames written
+	window       []float64
+	closed       bool
+
+	// minBlockSize is the smallest block size of the frames before the last
+	// one, and lastBlockSize the size of the last frame written.
+	minBlockSize  uint16
+	lastBlockSize uint16
+	maxBlockSize  uint16
+
+	// start is the offset of the stream in a seekable writer, or -1.
+	start int64
+}
+
+// NewEncoder writes the metadata of a stream to w and returns an Encoder for
+// its audio. The SampleRate, Channels and BitsPerSample of info must be set;
+// the other fields are filled in by the encoder. blocks are written after
+// STREAMINFO.
+func NewEncoder(w io.Writer, info *StreamInfo, config EncoderConfig, blocks ...*MetadataBlock) (*Encoder, error) {
+	switch {
+	case info.SampleRate == 0 || info.SampleRate >= 1<<20:
+		return nil, fmt.Errorf("sample rate %d: %w", info.SampleRate, ErrInvalidStreamInfo)
+	case info.Channels < 1 || info.Channels > 8:
+		return nil, fmt.Errorf("%d channels: %w", info.Channels, ErrInvalidStreamInfo)
+	case info.BitsPerSample < 4 || info.BitsPerSample > 32:
+		return nil, fmt.Errorf("%d bits per sample: %w", info.BitsPerSample, ErrInvalidStreamInfo)
+	case config.BlockSize < 16:
+		return nil, fmt.Errorf("block size %d: %w", config.BlockSize, ErrInvalidStreamInfo)
+	case config.MaxLPCOrder < 0 || config.MaxLPCOrder > maxLPCOrder:
+		return nil, fmt.Errorf("LPC order %d: %w", config.MaxLPCOrder, ErrInvalidStreamInfo)
+	case config.LPCPrecision > 15:
+		return nil, fmt.Errorf("LPC precision %d: %w", config.LPCPrecision, ErrInvalidStreamInfo)
+	case config.MaxPartitionOrder < 0 || config.MaxPartitionOrder > 15:
+		return nil, fmt.Errorf("partition order %d: %w", config.MaxPartitionOrder, ErrInvalidStreamInfo)
+	}
+
+	info.MinimumBlockSize = config.BlockSize
+	info.MaximumBlockSize = config.BlockSize
+	if config.VariableBlockSize {
+		// the smallest possible block, until the stream is known
+		info.MinimumBlockSize = max(config.BlockSize/transientSplits, 16)
+	}
+	info.MinimumFrameSize = 0
+	info.MaximumFrameSize = 0
+	info.MD5 = make([]byte, 16)
+
+	e := &Encoder{
+		w:       NewWriter(w),
+		dst:     w,
+		config:  config,
+		info:    info,
+		md5:     NewAudioMD5(info.BitsPerSample),
+		pending: make([][]int32, info.Channels),
+		start:   -1,
+	}
+	if ws, ok := w.(io.WriteSeeker); ok {
+		if pos, err := ws.Seek(0, io.SeekCurrent); err == nil {
+			e.start = pos
+		}
+	}
+
+	e.blocks = append([]*MetadataBlock{{
+		MetadataBlockHeader: MetadataBlockHeader{Type: MetadataBlockTypeStreamInfo},
+		Data:                info,
+	}}, blocks...)
+	for i, b := range e.blocks {
+		b.Last = i == len(e.blocks)-1
+		if t, ok := b.Data.(*SeekTable); ok && e.seekTable == nil {
+			t.Sort()
+			e.seekTable = t
+		}
+		if err := e.w.WriteBlock(b); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// Write encodes the samples of each channel. Samples are buffered until a
+// full block is available.
+func (e *Encoder) Write(samples [][]int32) error {
+	if e.closed {
+		return ErrEncoderClosed
+	}
+	if e.w.err != nil {
+		return e.w.err
+	}
+	if len(samples) != len(e.pending) {
+		return fmt.Errorf("got %d channels, expected %d", len(samples), len(e.pending))
+	}
+	for _, ch := range samples[1:] {
+		if len(ch) != len(samples[0]) {
+			return errors.New("channels have different numbers of samples")
+		}
+	}
+
+	e.md5.Write(samples)
+	for i, ch := range samples {
+		e.pending[i] = append(e.pending[i], ch...)
+	}
+
+	blockSize := int(e.config.BlockSize)
+	var n int
+	for len(e.pending[0])-n >= blockSize {
+		block := make([][]int32, len(e.pending))
+		for i, ch := range e.pending {
+			block[i] = ch[n : n+blockSize]
+		}
+		block = e.splitBlock(block)
+		if err := e.writeFrame(block); err != nil {
+			return err
+		}
+		n += len(block[0])
+	}
+	if n > 0 {
+		for i, ch := range e.pending {
+			e.pending[i] = append(ch[:0], ch[n:]...)
+		}
+	}
+
+	return nil
+}
+
+// Close encodes the remaining samples and, if possible, rewrites the metadata
+// blocks with the values known at the end of the stream. It does not close
+// the underlying writer.
+func (e *Encoder) Close() error {
+	if e.closed {
+		return ErrEncoderClosed
+	}
+	e.closed = true
+
+	for len(e.pending[0]) > 0 {
+		block := e.splitBlock(e.pending)
+		if err := e.writeFrame(block); err != nil {
+			return err
+		}
+		for i, ch := range e.pending {
+			e.pending[i] = ch[len(block[i]):]
+		}
+	}
+
+	e.info.TotalSamples = e.sampleNumber
+	e.info.MD5 = e.md5.Sum()
+	// as in the reference encoder, the minimum block size does not take the
+	// last frame into account, which may be shorter, unless it is the only
+	// frame
+	if e.minBlockSize == 0 {
+		e.info.MinimumBlockSize = e.lastBlockSize
+	} else {
+		e.info.MinimumBlockSize = e.minBlockSize
+	}
+	e.info.MaximumBlockSize = e.maxBlockSize
+
+	if t := e.seekTable; t != nil {
+		// points past the end of the stream could not be resolved
+		n := len(t.SeekPoints)
+		for _, p := range t.SeekPoints {
+			if !p.IsPlaceholder() && p.NumSamples == 0 {
+				*p = SeekPoint{SampleNumber: PlaceholderSampleNumber}
+			}
+		}
+		t.Sort()
+		// keep the size of the block written at the start
+		t.AppendPlaceholders(n - len(t.SeekPoints))
+	}
+
+	if e.start < 0 {
+		return nil
+	}
+	ws := e.dst.(io.WriteSeeker)
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := ws.Seek(e.start+4, io.SeekStart); err != nil {
+		return err
+	}
+	w := &Writer{w: ws, wroteMarker: true}
+	for _, b := range e.blocks {
+		if err := w.WriteBlock(b); err != nil {
+			return err
+		}
+	}
+	_, err = ws.Seek(end, io.SeekStart)
+	return err
+}
+
+// writeFrame encodes a frame of samples.
+func (e *Encoder) writeFrame(samples [][]int32) error {
+	h := &FrameHeader{
+		HasVariableBlockSize: e.config.VariableBlockSize,
+		BlockSize:            uint16(len(samples[0])),
+		SampleRate:           e.info.SampleRate,
+		ChannelAssignment:    ChannelAssignment(len(samples) - 1),
+		BitsPerSample:        e.info.BitsPerSample,
+		Number:               e.frameNumber,
+	}
+	if h.HasVariableBlockSize {
+		h.Number = e.sampleNumber
+	}
+	bps := e.info.BitsPerSample
+
+	// in 64 bits, since the side channel of 32 bit samples has 33 bits
+	wide := make([][]int64, len(samples))
+	subframes := make([]*subframeCoding, len(samples))
+	for i, ch := range samples {
+		wide[i] = make([]int64, len(ch))
+		for j, v := range ch {
+			wide[i][j] = int64(v)
+		}
+		subframes[i] = e.chooseSubframe(wide[i], bps)
+	}
+
+	if len(samples) == 2 && e.config.MidSide {
+		left, right := subframes[0], subframes[1]
+		mid, side := correlate(ChannelAssignmentMidSide, wide[0], wide[1])
+		midSF, sideSF := e.chooseSubframe(mid, bps), e.chooseSubframe(side, bps+1)
+
+		best := left.bits + right.bits
+		for _, c := range []struct {
+			a        ChannelAssignment
+			ch0, ch1 *subframeCoding
+		}{
+			{ChannelAssignmentLeftSide, left, sideSF},
+			{ChannelAssignmentSideRight, sideSF, right},
+			{ChannelAssignmentMidSide, midSF, sideSF},
+		} {
+			if bits := c.ch0.bits + c.ch1.bits; bits < best {
+				best = bits
+				h.ChannelAssignment = c.a
+				subframes[0], subframes[1] = c.ch0, c.ch1
+			}
+		}
+	}
+
+	e.w.buf.Reset()
+	bw := bitio.NewWriter(&e.w.buf)
+	encodeFrameHeader(bw, h)
+	// <8 bits> CRC-8 of everything before the crc
+	h.CRC8 = updateCRC8(0, e.w.buf.Bytes())
+	bw.TryWriteBits(uint64(h.CRC8), 8)
+
+	for _, sf := range subframes {
+		encodeSubframe(bw, sf)
+	}
+
+	// <?> zero-padding to byte alignment
+	bw.TryAlign()
+	if bw.TryError != nil {
+		return bw.TryError
+	}
+	// <16 bits> CRC-16 of everything before the crc
+	crc := updateCRC16(0, e.w.buf.Bytes())
+	e.w.buf.WriteByte(byte(crc >> 8))
+	e.w.buf.WriteByte(byte(crc))
+
+	if !e.w.write(e.w.buf.Bytes()) {
+		return e.w.err
+	}
+
+	size := uint32(e.w.buf.Len())
+	if e.info.MinimumFrameSize == 0 || size < e.info.MinimumFrameSize {
+		e.info.MinimumFrameSize = size
+	}
+	if size > e.info.MaximumFrameSize {
+		e.info.MaximumFrameSize = size
+	}
+	if e.seekTable != nil {
+		e.seekTable.Resolve(e.sampleNumber, e.offset, h.BlockSize)
+	}
+
+	if e.frameNumber > 0 && (e.minBlockSize == 0 || e.lastBlockSize < e.minBlockSize) {
+		e.minBlockSize = e.lastBlockSize
+	}
+	e.lastBlockSize = h.BlockSize
+	e.maxBlockSize = max(e.maxBlockSize, h.BlockSize)
+	e.frameNumber++
+	e.sampleNumber += uint64(h.BlockSize)
+	e.offset += uint64(size)
+	return nil
+}
+
+// transientSplits is the number of parts of a block that are compared to find
+// transients with VariableBlockSize.
+const transientSplits = 8
+
+// transientRatio is the factor by which the energy of a part of a block must
+// differ from that of the part before it to count as a transient.
+const transientRatio = 8
+
+// splitBlock returns block up to the first transient, or all of block if there
+// is none or VariableBlockSize is not set. Transients, the sudden start or end
+// of a loud passage, are found in the energy of the first difference of the
+// signal, which stresses the high frequencies of an attack, in parts of an
+// eighth of BlockSize. Changes below -60 dBFS are not taken for transients.
+func (e *Encoder) splitBlock(block [][]int32) [][]int32 {
+	part := int(e.config.BlockSize) / transientSplits
+	if !e.config.VariableBlockSize || part < 16 {
+		return block
+	}
+
+	fullScale := math.Ldexp(1, int(e.info.BitsPerSample)-1)
+	floor := float64(part*len(block)) * fullScale * fullScale * 1e-6
+	var prev float64
+	for start := 0; start+part <= len(block[0]); start += part {
+		var energy float64
+		for _, ch := range block {
+			for i := max(start, 1); i < start+part; i++ {
+				d := float64(ch[i]) - float64(ch[i-1])
+				energy += d * d
+			}
+		}
+		if start > 0 && max(energy, prev) > floor && (energy > transientRatio*prev || prev > transientRatio*energy) {
+			split := make([][]int32, len(block))
+			for i, ch := range block {
+				split[i] = ch[:start]
+			}
+			return split
+		}
+		prev = energy
+	}
+	return block
+}
+
+// chooseSubframe chooses the subframe type and predictor that codes samples
+// of bps bits in the fewest bits.
+func (e *Encoder) chooseSubframe(samples []int64, bps uint8) *subframeCoding {
+	n := len(samples)
+
+	var or int64
+	constant := true
+	for _, v := range samples {
+		or |= v
+		constant = constant && v == samples[0]
+	}
+	if constant {
+		return &subframeCoding{
+			Subframe: Subframe{Type: SubframeTypeConstant},
+			bps:      bps,
+			samples:  samples,
+			bits:     8 + int(bps),
+		}
+	}
+
+	// the low bits that are zero in every sample need not be coded
+	header := 8
+	wasted := uint8(bits.TrailingZeros64(uint64(or)))
+	if wasted > 0 {
+		shifted := make([]int64, n)
+		for i, v := range samples {
+			shifted[i] = v >> wasted
+		}
+		samples = shifted
+		bps -= wasted
+		header += int(wasted)
+	}
+
+	best := &subframeCoding{
+		Subframe: Subframe{Type: SubframeTypeVerbatim, WastedBits: wasted},
+		bps:      bps,
+		samples:  samples,
+		bits:     header + n*int(bps),
+	}
+
+	for order := 0; order <= maxFixedOrder && order < n; order++ {
+		residual := make([]int32, n)
+		if !computeFixedResidual(samples, residual, order) {
+			continue
+		}
+		rice := chooseRiceCoding(residual, order, e.config.MaxPartitionOrder)
+		if bits := header + order*int(bps) + rice.bits; bits < best.bits {
+			best = &subframeCoding{
+				Subframe: Subframe{Type: SubframeTypeFixed, Order: order, WastedBits: wasted},
+				bps:      bps,
+				samples:  samples,
+				residual: residual,
+				rice:     rice,
+				bits:     bits,
+			}
+		}
+	}
+
+	if maxOrder := min(e.config.MaxLPCOrder, n-1); maxOrder > 0 {
+		if sf := e.chooseLPC(samples, bps, maxOrder); sf != nil {
+			sf.WastedBits = wasted
+			if sf.bits += header; sf.bits < best.bits {
+				best = sf
+			}
+		}
+	}
+
+	return best
+}
+
+// chooseLPC returns the LPC subframe of order up to maxOrder that codes
+// samples in the fewest bits, excluding the subframe header, or nil if
+// linear prediction fails.
+func (e *Encoder) chooseLPC(samples []int64, bps uint8, maxOrder int) *subframeCoding {
+	n := len(samples)
+	if len(e.window) != n {
+		e.window = tukeyWindow(n, 0.5)
+	}
+	coeffs, errs := levinsonDurbin(autocorrelation(samples, e.window, maxOrder), maxOrder)
+	if len(coeffs) == 0 {
+		return nil
+	}
+
+	precision := e.config.LPCPrecision
+	if precision == 0 {
+		precision = lpcPrecision(n)
+	}
+
+	orders := make([]int, 0, len(coeffs))
+	if e.config.ExhaustiveModelSearch {
+		for order := 1; order <= len(coeffs); order++ {
+			orders = append(orders, order)
+		}
+	} else {
+		// estimate the order that codes in the fewest bits
+		bestOrder, bestBits := 1, math.Inf(1)
+		for i, err := range errs {
+			order := i + 1
+			bits := expectedResidualBits(err, n)*float64(n-order) + float64(order)*float64(int(bps)+int(precision))
+			if bits < bestBits {
+				bestOrder, bestBits = order, bits
+			}
+		}
+		orders = append(orders, bestOrder)
+	}
+
+	var best *subframeCoding
+	for _, order := range orders {
+		q, shift, ok := quantizeCoefficients(coeffs[order-1], precision)
+		if !ok {
+			continue
+		}
+		residual := make([]int32, n)
+		if !computeLPCResidual(samples, residual, q, shift) {
+			continue
+		}
+		rice := chooseRiceCoding(residual, order, e.config.MaxPartitionOrder)
+		bits := order*int(bps) + 4 + 5 + order*int(precision) + rice.bits
+		if best == nil || bits < best.bits {
+			best = &subframeCoding{
+				Subframe: Subframe{
+					Type:         SubframeTypeLPC,
+					Order:        order,
+					Precision:    precision,
+					Shift:        shift,
+					Coefficients: q,
+				},
+				bps:      bps,
+				samples:  samples,
+				residual: residual,
+				rice:     rice,
+				bits:     bits,
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,227 @@
+package flac
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testAudio returns channels of n samples of bps bits: correlated tones with
+// noise, a square wave and silence.
+func testAudio(channels, n int, bps uint8) [][]int32 {
+	rnd := rand.New(rand.NewSource(int64(channels*n) + int64(bps)))
+	amp := float64(int64(1)<<(bps-1) - 1)
+
+	samples := make([][]int32, channels)
+	for ch := range samples {
+		samples[ch] = testSignal(n, func(i int) int32 {
+			switch ch {
+			case 2:
+				if i/50%2 == 0 {
+					return int32(amp / 4)
+				}
+				return int32(-amp / 4)
+			case 3:
+				return 0
+			}
+			v := 0.5*math.Sin(2*math.Pi*float64(i)*440/44100) + 0.2*math.Sin(2*math.Pi*float64(i)*(1000+float64(ch)*3)/44100)
+			v += 0.05 * (rnd.Float64() - 0.5)
+			return int32(v * amp)
+		})
+	}
+	return samples
+}
+
+// testEncode encodes the audio to w.
+func testEncode(t *testing.T, w io.Writer, info *StreamInfo, config EncoderConfig, audio [][]int32, blocks ...*MetadataBlock) {
+	t.Helper()
+	e, err := NewEncoder(w, info, config, blocks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Write(audio); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	tests := []struct {
+		desc     string
+		channels int
+		bps      uint8
+		samples  int
+		level    int
+	}{
+		{"mono 8 bit level 0", 1, 8, 5000, 0},
+		{"stereo 16 bit level 2", 2, 16, 10000, 2},
+		{"stereo 16 bit level 5", 2, 16, 10000, 5},
+		{"stereo 24 bit level 8", 2, 24, 9000, 8},
+		{"4 channels 12 bit level 3", 4, 12, 4097, 3},
+		{"stereo 32 bit level 5", 2, 32, 5000, 5},
+		{"short stream", 2, 16, 100, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			audio := testAudio(tt.channels, tt.samples, tt.bps)
+
+			f, err := os.Create(filepath.Join(t.TempDir(), "test.flac"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			table := new(SeekTable)
+			table.AppendSpacedPoints(3, uint64(tt.samples))
+			table.AppendPoint(uint64(tt.samples) * 2) // past the end
+			info := &StreamInfo{SampleRate: 44100, Channels: uint8(tt.channels), BitsPerSample: tt.bps}
+			e, err := NewEncoder(f, info, CompressionLevel(tt.level), &MetadataBlock{
+				MetadataBlockHeader: MetadataBlockHeader{Type: MetadataBlockTypeSeekTable},
+				Data:                table,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// write in uneven pieces
+			for i := 0; i < tt.samples; i += 1000 {
+				end := min(i+1000, tt.samples)
+				piece := make([][]int32, tt.channels)
+				for ch := range piece {
+					piece[ch] = audio[ch][i:end]
+				}
+				if err := e.Write(piece); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			r := NewReader(f)
+			var blocks []*MetadataBlock
+			for {
+				b, err := r.ReadBlock()
+				if err != nil {
+					t.Fatal(err)
+				}
+				blocks = append(blocks, b)
+				if b.Last {
+					break
+				}
+			}
+
+			si := r.StreamInfo()
+			if si.TotalSamples != uint64(tt.samples) {
+				t.Errorf("total samples = %d, want %d", si.TotalSamples, tt.samples)
+			}
+			md5 := NewAudioMD5(tt.bps)
+			md5.Write(audio)
+			if !bytes.Equal(si.MD5, md5.Sum()) {
+				t.Errorf("MD5 = %x, want %x", si.MD5, md5.Sum())
+			}
+
+			points := blocks[1].Data.(*SeekTable).SeekPoints
+			if len(points) != 4 || !points[3].IsPlaceholder() {
+				t.Errorf("seek points = %d, want 3 and a placeholder", len(points))
+			}
+
+			var n int
+			for {
+				frame, err := r.ReadFrame()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, p := range points[:3] {
+					if p.SampleNumber == frame.SampleNumber && int64(p.Offset) != frame.Offset-blocksEnd(blocks) {
+						t.Errorf("seek point to sample %d has offset %d, want %d", p.SampleNumber, p.Offset, frame.Offset-blocksEnd(blocks))
+					}
+				}
+				for ch := range audio {
+					for i, v := range frame.Samples[ch] {
+						if want := audio[ch][n+i]; v != want {
+							t.Fatalf("channel %d: sample %d = %d, want %d", ch, n+i, v, want)
+						}
+					}
+				}
+				n += int(frame.BlockSize)
+			}
+			if n != tt.samples {
+				t.Errorf("decoded %d samples, want %d", n, tt.samples)
+			}
+		})
+	}
+}
+
+// TestEncoder32Bit encodes full scale 32 bit stereo, whose side channel needs
+// 33 bits, with 8 wasted bits in the second half.
+func TestEncoder32Bit(t *testing.T) {
+	const n = 8192
+
+	audio := testAudio(2, n, 32)
+	for i := range audio[0] {
+		// nearly identical channels favor stereo decorrelation
+		audio[1][i] = audio[0][i] ^ 1
+		if i/64%2 == 0 {
+			audio[0][i], audio[1][i] = math.MaxInt32, math.MaxInt32-1
+		}
+		if i >= n/2 {
+			audio[0][i] &^= 0xff
+			audio[1][i] &^= 0xff
+		}
+	}
+
+	var stream bytes.Buffer
+	config := CompressionLevel(5)
+	config.BlockSize = 1024
+	testEncode(t, &stream, &StreamInfo{SampleRate: 192000, Channels: 2, BitsPerSample: 32}, config, audio)
+
+	r := NewReader(&stream)
+	var decorrelated, wasted int
+	for {
+		f, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.ChannelAssignment >= ChannelAssignmentLeftSide {
+			decorrelated++
+		}
+		if f.Subframes[0].WastedBits == 8 {
+			wasted++
+		}
+		for ch := range audio {
+			for i, v := range f.Samples[ch] {
+				if want := audio[ch][int(f.SampleNumber)+i]; v != want {
+					t.Fatalf("channel %d: sample %d = %d, want %d", ch, int(f.SampleNumber)+i, v, want)
+				}
+			}
+		}
+	}
+	if decorrelated == 0 || wasted == 0 {
+		t.Errorf("%d frames with stereo decorrelation and %d with wasted bits, want some of each", decorrelated, wasted)
+	}
+}
+
+// blocksEnd returns the offset of the first frame following blocks.
+func blocksEnd(blocks []*MetadataBlock) int64 {
+	n := int64(4)
+	for _, b := range blocks {
+		n += 4 + int64(b.Length)
+	}
+	return n
+}
@@ -0,0 +1,104 @@
+package flac
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// fft computes the discrete Fourier transform of x in place. The length of x
+// must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	shift := 64 - bits.Len(uint(n-1))
+	for i := range x {
+		if j := int(bits.Reverse64(uint64(i)) >> shift); i < j && n > 1 {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		half := size / 2
+		for k := 0; k < half; k++ {
+			s, c := math.Sincos(-2 * math.Pi * float64(k) / float64(size))
+			w := complex(c, s)
+			for start := 0; start < n; start += size {
+				a, b := x[start+k], x[start+k+half]*w
+				x[start+k], x[start+k+half] = a+b, a-b
+			}
+		}
+	}
+}
+
+// Window is a window function applied to the samples of an FFT.
+type Window uint8
+
+const (
+	// WindowHann is the Hann window, a good default with low leakage far
+	// from a frequency.
+	WindowHann Window = iota
+	// WindowHamming is the Hamming window, with a narrower main lobe and
+	// higher far sidelobes than the Hann window.
+	WindowHamming
+	// WindowBlackman is the Blackman window, with a wider main lobe and lower
+	// sidelobes than the Hann window.
+	WindowBlackman
+	// WindowRectangular applies no window, for the narrowest main lobe and
+	// the most leakage.
+	WindowRectangular
+)
+
+func (w Window) String() string {
+	switch w {
+	case WindowHann:
+		return "hann"
+	case WindowHamming:
+		return "hamming"
+	case WindowBlackman:
+		return "blackman"
+	case WindowRectangular:
+		return "rectangular"
+	}
+	return fmt.Sprintf("Window(%d)", w)
+}
+
+// coefficients returns the window of n samples.
+func (w Window) coefficients(n int) []float64 {
+	c := make([]float64, n)
+	for i := range c {
+		x := 2 * math.Pi * float64(i) / float64(n)
+		switch w {
+		case WindowHann:
+			c[i] = 0.5 - 0.5*math.Cos(x)
+		case WindowHamming:
+			c[i] = 0.54 - 0.46*math.Cos(x)
+		case WindowBlackman:
+			c[i] = 0.42 - 0.5*math.Cos(x) + 0.08*math.Cos(2*x)
+		default:
+			c[i] = 1
+		}
+	}
+	return c
+}
+
+// powerSpectrum adds the power spectrum of the samples x, weighted by the
+// window, to the n/2+1 bins of p, using buf of len(x) as scratch space. The
+// power is normalized so that a full scale sine has a power of about 1.
+func powerSpectrum(p []float64, x, window []float64, buf []complex128) {
+	var sum float64
+	for i, v := range x {
+		buf[i] = complex(v*window[i], 0)
+		sum += window[i]
+	}
+	fft(buf)
+	norm := 2 / sum
+	for k := range p {
+		v := buf[k]
+		re, im := real(v)*norm, imag(v)*norm
+		p[k] += re*re + im*im
+	}
+}
+
+// nextPowerOfTwo returns the smallest power of two of at least n.
+func nextPowerOfTwo(n int) int {
+	return 1 << bits.Len(uint(max(n, 1)-1))
+}
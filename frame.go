@@ -0,0 +1,592 @@
+package flac
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/icza/bitio"
+)
+
+// ChannelAssignment describes how the channels of a frame are coded. Values 0
+// through 7 mean the frame holds 1 through 8 independently coded channels.
+//
+// https://xiph.org/flac/format.html#frame_header
+type ChannelAssignment uint8
+
+// Stereo decorrelation channel assignments.
+const (
+	ChannelAssignmentLeftSide ChannelAssignment = 8 + iota
+	ChannelAssignmentSideRight
+	ChannelAssignmentMidSide
+)
+
+// Channels returns the number of channels coded with the assignment, or 0 if
+// the assignment is reserved.
+func (a ChannelAssignment) Channels() int {
+	switch {
+	case a < 8:
+		return int(a) + 1
+	case a <= ChannelAssignmentMidSide:
+		return 2
+	}
+	return 0
+}
+
+func (a ChannelAssignment) String() string {
+	switch {
+	case a < 8:
+		return "INDEPENDENT"
+	case a == ChannelAssignmentLeftSide:
+		return "LEFT_SIDE"
+	case a == ChannelAssignmentSideRight:
+		return "RIGHT_SIDE"
+	case a == ChannelAssignmentMidSide:
+		return "MID_SIDE"
+	}
+	return "RESERVED"
+}
+
+// FrameHeader represents an audio frame header.
+//
+// https://xiph.org/flac/format.html#frame_header
+type FrameHeader struct {
+	// HasVariableBlockSize is set when the stream uses the variable-blocksize
+	// strategy, in which case Number is a sample number.
+	HasVariableBlockSize bool
+	// Block size in inter-channel samples.
+	BlockSize uint16
+	// Sample rate in Hz.
+	SampleRate uint32
+	// Channel assignment of the subframes.
+	ChannelAssignment ChannelAssignment
+	// Bits per sample.
+	BitsPerSample uint8
+	// The frame number for fixed-blocksize streams, or the number of the first
+	// sample in the frame for variable-blocksize streams.
+	Number uint64
+	// CRC-8 of the frame header, excluding the CRC itself.
+	CRC8 uint8
+}
+
+// Frame represents a decoded audio frame.
+//
+// https://xiph.org/flac/format.html#frame
+type Frame struct {
+	FrameHeader
+	Subframes []*Subframe
+	// CRC-16 of the entire frame, excluding the CRC itself.
+	CRC16 uint16
+	// Concealed is set for frames of silence that ReadFrame returns in place
+	// of damaged frames with ErrorPolicyConceal. They have no subframes.
+	Concealed bool
+
+	// Offset is the byte offset of the frame header from the beginning of the
+	// stream.
+	Offset int64
+	// Size is the size of the frame in bytes.
+	Size int
+	// SampleNumber is the number of the first sample in the frame.
+	SampleNumber uint64
+	// Samples holds the decoded audio of each channel.
+	Samples [][]int32
+}
+
+// ReadFrame reads and decodes the next audio frame. Metadata blocks that have
+// not been read yet are skipped. ReadFrame returns io.EOF at the end of the
+// stream, or a *TruncatedError if the stream ends in the middle of a frame or
+// before the number of samples given in STREAMINFO.
+//
+// Damaged frames, whose CRCs do not match or which fail to decode, are
+// handled according to r.ErrorPolicy, and r.Gain, if set, is applied to the
+// decoded audio.
+func (r *Reader) ReadFrame() (*Frame, error) {
+	f, err := r.nextFrame()
+	if err == nil && r.Gain != nil {
+		if r.gainScale == 0 {
+			g, _ := ParseReplayGain(r.vorbisComment)
+			r.gainScale = g.Scale(*r.Gain)
+		}
+		r.gainClipped += uint64(ApplyGain(f.Samples, f.BitsPerSample, r.gainScale))
+	}
+	return f, err
+}
+
+// nextFrame reads the next audio frame for ReadFrame.
+func (r *Reader) nextFrame() (*Frame, error) {
+	if len(r.pending) > 0 {
+		f := r.pending[0]
+		r.pending = r.pending[1:]
+		return f, nil
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	for !r.readLastBlock {
+		if _, err := r.ReadBlock(); err != nil {
+			return nil, err
+		}
+	}
+	if r.scan && r.streamInfo == nil {
+		return r.scanFirstFrame()
+	}
+
+	for {
+		offset := r.cr.n
+		f, ok := r.readFrame()
+		if ok {
+			return r.acceptFrame(f), nil
+		}
+		if r.err == io.EOF {
+			if r.totalSamples() > r.nextSample && r.ErrorPolicy == ErrorPolicyAbort {
+				r.err = r.truncated(offset)
+				return nil, r.err
+			}
+			return r.concealEnd()
+		}
+		if r.err == io.ErrUnexpectedEOF {
+			r.err = r.truncated(offset)
+		}
+		if !r.recoverFrame(offset, f) {
+			if r.err == io.EOF {
+				return r.concealEnd()
+			}
+			return nil, r.err
+		}
+	}
+}
+
+// readFrame reads and decodes the next frame. If the frame header is valid
+// but the rest of the frame is not, it returns the frame with its header
+// decoded.
+func (r *Reader) readFrame() (*Frame, bool) {
+	f := new(Frame)
+	f.Offset = r.cr.n
+	r.cr.resetCRC()
+
+	if !r.decodeFrameHeader(&f.FrameHeader) {
+		return nil, false
+	}
+
+	if f.HasVariableBlockSize {
+		f.SampleNumber = f.Number
+	} else {
+		if r.blockSize == 0 {
+			r.blockSize = f.BlockSize
+			if si := r.streamInfo; si != nil && si.MinimumBlockSize == si.MaximumBlockSize && si.MaximumBlockSize != 0 {
+				r.blockSize = si.MaximumBlockSize
+			}
+		}
+		f.SampleNumber = f.Number * uint64(r.blockSize)
+	}
+
+	n := f.ChannelAssignment.Channels()
+	f.Subframes = make([]*Subframe, n)
+	samples := make([][]int64, n)
+	for ch := 0; ch < n; ch++ {
+		bps := f.BitsPerSample
+		switch {
+		case f.ChannelAssignment == ChannelAssignmentLeftSide && ch == 1,
+			f.ChannelAssignment == ChannelAssignmentSideRight && ch == 0,
+			f.ChannelAssignment == ChannelAssignmentMidSide && ch == 1:
+			bps++ // side channel has an extra bit
+		}
+
+		f.Subframes[ch], samples[ch] = r.decodeSubframe(bps, int(f.BlockSize))
+		if r.err != nil {
+			return f, false
+		}
+	}
+
+	f.Samples = decorrelate(f.ChannelAssignment, samples)
+
+	// <?> zero-padding to byte alignment
+	r.r.Align()
+
+	// <16 bits> CRC-16 of everything before the crc
+	crc16 := r.cr.crc16
+	footer, ok := r.readBits(16)
+	if !ok {
+		return f, false
+	}
+	f.CRC16 = uint16(footer)
+	f.Size = int(r.cr.n - f.Offset)
+	if f.CRC16 != crc16 {
+		r.err = fmt.Errorf("frame CRC-16 %#04x, computed %#04x: %w", f.CRC16, crc16, ErrCRCMismatch)
+		return f, false
+	}
+
+	return f, true
+}
+
+func (r *Reader) decodeFrameHeader(h *FrameHeader) bool {
+	// <14 bits> sync code, <1 bit> reserved, <1 bit> blocking strategy
+	b0, err := r.r.ReadBits(8)
+	if err != nil {
+		r.err = err // a clean end of stream
+		return false
+	}
+	b1, ok := r.readBits(8)
+	if !ok {
+		return false
+	}
+	if sync := b0<<8 | b1; sync&0xfffe != 0xfff8 {
+		r.err = ErrInvalidFrameSync
+		return false
+	}
+	h.HasVariableBlockSize = b1&1 != 0
+
+	// <4 bits> block size, <4 bits> sample rate
+	b, ok := r.readBits(8)
+	if !ok {
+		return false
+	}
+	blockSizeBits, sampleRateBits := b>>4, b&0xf
+
+	// <4 bits> channel assignment, <3 bits> sample size, <1 bit> reserved
+	if b, ok = r.readBits(8); !ok {
+		return false
+	}
+	h.ChannelAssignment = ChannelAssignment(b >> 4)
+	if h.ChannelAssignment.Channels() == 0 {
+		r.err = fmt.Errorf("channel assignment %d: %w", h.ChannelAssignment, ErrReservedValue)
+		return false
+	}
+	sampleSizeBits := b >> 1 & 0b111
+	if b&1 != 0 {
+		r.err = fmt.Errorf("frame header reserved bit set: %w", ErrReservedValue)
+		return false
+	}
+
+	// <8-56 bits> "UTF-8" coded frame or sample number
+	if h.Number, ok = r.readCodedNumber(); !ok {
+		return false
+	}
+
+	switch {
+	case blockSizeBits == 0:
+		r.err = fmt.Errorf("block size: %w", ErrReservedValue)
+		return false
+	case blockSizeBits == 1:
+		h.BlockSize = 192
+	case blockSizeBits <= 5:
+		h.BlockSize = 576 << (blockSizeBits - 2)
+	case blockSizeBits == 6: // <8 bits> block size - 1
+		if b, ok = r.readBits(8); !ok {
+			return false
+		}
+		h.BlockSize = uint16(b) + 1
+	case blockSizeBits == 7: // <16 bits> block size - 1
+		if b, ok = r.readBits(16); !ok {
+			return false
+		}
+		if b == 0xffff {
+			r.err = fmt.Errorf("block size: %w", ErrReservedValue)
+			return false
+		}
+		h.BlockSize = uint16(b) + 1
+	default:
+		h.BlockSize = 256 << (blockSizeBits - 8)
+	}
+
+	switch sampleRateBits {
+	case 0:
+		switch {
+		case r.streamInfo != nil:
+			h.SampleRate = r.streamInfo.SampleRate
+		case !r.scan: // else unknown, which does not keep the frame from decoding
+			r.err = errors.New("frame sample rate refers to missing STREAMINFO")
+			return false
+		}
+	case 12: // <8 bits> sample rate in kHz
+		if b, ok = r.readBits(8); !ok {
+			return false
+		}
+		h.SampleRate = uint32(b) * 1000
+	case 13: // <16 bits> sample rate in Hz
+		if b, ok = r.readBits(16); !ok {
+			return false
+		}
+		h.SampleRate = uint32(b)
+	case 14: // <16 bits> sample rate in tens of Hz
+		if b, ok = r.readBits(16); !ok {
+			return false
+		}
+		h.SampleRate = uint32(b) * 10
+	case 15:
+		r.err = fmt.Errorf("sample rate: %w", ErrReservedValue)
+		return false
+	default:
+		h.SampleRate = frameSampleRates[sampleRateBits]
+	}
+
+	switch sampleSizeBits {
+	case 0:
+		if r.streamInfo == nil {
+			r.err = errors.New("frame sample size refers to missing STREAMINFO")
+			return false
+		}
+		h.BitsPerSample = r.streamInfo.BitsPerSample
+	case 3:
+		r.err = fmt.Errorf("sample size: %w", ErrReservedValue)
+		return false
+	default:
+		h.BitsPerSample = frameSampleSizes[sampleSizeBits]
+	}
+
+	// <8 bits> CRC-8 of everything before the crc
+	crc8 := r.cr.crc8
+	if b, ok = r.readBits(8); !ok {
+		return false
+	}
+	h.CRC8 = uint8(b)
+	if h.CRC8 != crc8 {
+		r.err = fmt.Errorf("frame header CRC-8 %#02x, computed %#02x: %w", h.CRC8, crc8, ErrCRCMismatch)
+		return false
+	}
+
+	return true
+}
+
+// frameSampleRates maps the sample rate bits of a frame header to the sample
+// rate in Hz.
+var frameSampleRates = [...]uint32{
+	1:  88200,
+	2:  176400,
+	3:  192000,
+	4:  8000,
+	5:  16000,
+	6:  22050,
+	7:  24000,
+	8:  32000,
+	9:  44100,
+	10: 48000,
+	11: 96000,
+}
+
+// frameSampleSizes maps the sample size bits of a frame header to the bits
+// per sample.
+var frameSampleSizes = [...]uint8{
+	1: 8,
+	2: 12,
+	4: 16,
+	5: 20,
+	6: 24,
+	7: 32,
+}
+
+// readCodedNumber reads a frame or sample number coded in the extended UTF-8
+// scheme of the frame header.
+func (r *Reader) readCodedNumber() (uint64, bool) {
+	b, ok := r.readBits(8)
+	if !ok {
+		return 0, false
+	}
+
+	var n int // number of continuation bytes
+	switch {
+	case b&0x80 == 0:
+		return b, true
+	case b&0xe0 == 0xc0:
+		b, n = b&0x1f, 1
+	case b&0xf0 == 0xe0:
+		b, n = b&0x0f, 2
+	case b&0xf8 == 0xf0:
+		b, n = b&0x07, 3
+	case b&0xfc == 0xf8:
+		b, n = b&0x03, 4
+	case b&0xfe == 0xfc:
+		b, n = b&0x01, 5
+	case b == 0xfe:
+		b, n = 0, 6
+	default:
+		r.err = errors.New("invalid coded frame number")
+		return 0, false
+	}
+
+	v := b
+	for i := 0; i < n; i++ {
+		if b, ok = r.readBits(8); !ok {
+			return 0, false
+		}
+		if b&0xc0 != 0x80 {
+			r.err = errors.New("invalid coded frame number")
+			return 0, false
+		}
+		v = v<<6 | b&0x3f
+	}
+
+	return v, true
+}
+
+// readBits reads n bits. Reaching the end of the stream is unexpected.
+func (r *Reader) readBits(n uint8) (uint64, bool) {
+	v, err := r.r.ReadBits(n)
+	if err != nil {
+		r.err = unexpectedEOF(err)
+		return 0, false
+	}
+	return v, true
+}
+
+// unexpectedEOF turns io.EOF into io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// decorrelate restores the left and right channels of stereo decorrelated
+// samples and returns the channels as 32 bit samples. The side channel of 32
+// bit samples needs 33 bits, so the samples are decorrelated in 64 bits.
+func decorrelate(a ChannelAssignment, samples [][]int64) [][]int32 {
+	switch a {
+	case ChannelAssignmentLeftSide:
+		left, side := samples[0], samples[1]
+		for i := range side {
+			side[i] = left[i] - side[i]
+		}
+	case ChannelAssignmentSideRight:
+		side, right := samples[0], samples[1]
+		for i := range side {
+			side[i] += right[i]
+		}
+	case ChannelAssignmentMidSide:
+		mid, side := samples[0], samples[1]
+		for i := range mid {
+			m := mid[i]<<1 | side[i]&1
+			mid[i] = (m + side[i]) >> 1
+			side[i] = (m - side[i]) >> 1
+		}
+	}
+
+	channels := make([][]int32, len(samples))
+	for ch, s := range samples {
+		channels[ch] = make([]int32, len(s))
+		for i, v := range s {
+			channels[ch][i] = int32(v)
+		}
+	}
+	return channels
+}
+
+// correlate turns the left and right channels of a stereo frame into the
+// channels of the channel assignment a. The side channel needs one more bit
+// than the left and right channels.
+func correlate(a ChannelAssignment, left, right []int64) (ch0, ch1 []int64) {
+	side := make([]int64, len(left))
+	for i := range side {
+		side[i] = left[i] - right[i]
+	}
+
+	switch a {
+	case ChannelAssignmentLeftSide:
+		return left, side
+	case ChannelAssignmentSideRight:
+		return side, right
+	case ChannelAssignmentMidSide:
+		mid := make([]int64, len(left))
+		for i := range mid {
+			mid[i] = (left[i] + right[i]) >> 1
+		}
+		return mid, side
+	}
+	return left, right
+}
+
+// encodeFrameHeader writes a frame header, except its CRC-8. Sample rates that
+// cannot be coded in the header must be the one of STREAMINFO.
+func encodeFrameHeader(bw *bitio.Writer, h *FrameHeader) {
+	// <14 bits> sync code, <1 bit> reserved, <1 bit> blocking strategy
+	sync := uint64(0xfff8)
+	if h.HasVariableBlockSize {
+		sync |= 1
+	}
+	bw.TryWriteBits(sync, 16)
+
+	// <4 bits> block size
+	var blockSizeBits uint64
+	switch bs := h.BlockSize; {
+	case bs == 192:
+		blockSizeBits = 1
+	case bs == 576, bs == 1152, bs == 2304, bs == 4608:
+		blockSizeBits = uint64(bits.TrailingZeros16(bs/576)) + 2
+	case bs >= 256 && bs&(bs-1) == 0:
+		blockSizeBits = uint64(bits.TrailingZeros16(bs/256)) + 8
+	case bs <= 256:
+		blockSizeBits = 6
+	default:
+		blockSizeBits = 7
+	}
+
+	// <4 bits> sample rate
+	var sampleRateBits uint64
+	for i, rate := range frameSampleRates {
+		if rate != 0 && rate == h.SampleRate {
+			sampleRateBits = uint64(i)
+		}
+	}
+	if sampleRateBits == 0 {
+		switch sr := h.SampleRate; {
+		case sr%1000 == 0 && sr/1000 <= 0xff:
+			sampleRateBits = 12
+		case sr <= 0xffff:
+			sampleRateBits = 13
+		case sr%10 == 0 && sr/10 <= 0xffff:
+			sampleRateBits = 14
+		}
+	}
+	bw.TryWriteBits(blockSizeBits<<4|sampleRateBits, 8)
+
+	// <4 bits> channel assignment, <3 bits> sample size, <1 bit> reserved
+	var sampleSizeBits uint64
+	for i, size := range frameSampleSizes {
+		if size != 0 && size == h.BitsPerSample {
+			sampleSizeBits = uint64(i)
+		}
+	}
+	bw.TryWriteBits(uint64(h.ChannelAssignment)<<4|sampleSizeBits<<1, 8)
+
+	// <8-56 bits> "UTF-8" coded frame or sample number
+	writeCodedNumber(bw, h.Number)
+
+	switch blockSizeBits {
+	case 6: // <8 bits> block size - 1
+		bw.TryWriteBits(uint64(h.BlockSize)-1, 8)
+	case 7: // <16 bits> block size - 1
+		bw.TryWriteBits(uint64(h.BlockSize)-1, 16)
+	}
+
+	switch sampleRateBits {
+	case 12: // <8 bits> sample rate in kHz
+		bw.TryWriteBits(uint64(h.SampleRate/1000), 8)
+	case 13: // <16 bits> sample rate in Hz
+		bw.TryWriteBits(uint64(h.SampleRate), 16)
+	case 14: // <16 bits> sample rate in tens of Hz
+		bw.TryWriteBits(uint64(h.SampleRate/10), 16)
+	}
+}
+
+// writeCodedNumber writes a frame or sample number coded in the extended UTF-8
+// scheme of the frame header.
+func writeCodedNumber(bw *bitio.Writer, v uint64) {
+	if v < 0x80 {
+		bw.TryWriteBits(v, 8)
+		return
+	}
+
+	// number of continuation bytes
+	n := 1
+	for ; n < 6 && v >= 1<<(5*n+6); n++ {
+	}
+
+	// the first byte has n+1 leading 1 bits followed by a 0 bit
+	lead := uint64(0xff00>>(n+1)) & 0xff
+	bw.TryWriteBits(lead|v>>(6*n), 8)
+	for i := n - 1; i >= 0; i-- {
+		bw.TryWriteBits(0x80|v>>(6*i)&0x3f, 8)
+	}
+}
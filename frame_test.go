@@ -0,0 +1,395 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/icza/bitio"
+)
+
+// testSubframe describes how to code one channel of a test frame.
+type testSubframe struct {
+	typ        SubframeType
+	order      int
+	wastedBits uint8
+	coeffs     []int32
+	shift      int8
+	precision  uint8
+	riceParam  uint8
+}
+
+// buildTestFrame codes samples, which must already be decorrelated according
+// to the channel assignment, as a frame with a 16 bit block size and the
+// sample rate and size taken from STREAMINFO.
+func buildTestFrame(t *testing.T, number uint64, a ChannelAssignment, bps uint8, samples [][]int64, subframes []testSubframe) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := bitio.NewWriter(&buf)
+	w.WriteBits(0xfff8>>1, 15) // sync code, reserved bit
+	w.WriteBits(0, 1)          // fixed blocksize
+	w.WriteBits(7, 4)          // 16 bit block size at end of header
+	w.WriteBits(0, 4)          // sample rate from STREAMINFO
+	w.WriteBits(uint64(a), 4)
+	w.WriteBits(0, 3) // sample size from STREAMINFO
+	w.WriteBits(0, 1)
+	if number >= 0x80 {
+		t.Fatal("test frame numbers must fit in a single byte")
+	}
+	w.WriteBits(number, 8)
+	w.WriteBits(uint64(len(samples[0])-1), 16)
+	w.Align()
+	w.WriteBits(uint64(updateCRC8(0, buf.Bytes())), 8)
+
+	for ch, sf := range subframes {
+		chBps := bps
+		if (a == ChannelAssignmentLeftSide || a == ChannelAssignmentMidSide) && ch == 1 ||
+			a == ChannelAssignmentSideRight && ch == 0 {
+			chBps++
+		}
+		writeTestSubframe(w, sf, samples[ch], chBps)
+	}
+	w.Align()
+	w.WriteBits(uint64(updateCRC16(0, buf.Bytes())), 16)
+	w.Close()
+
+	return buf.Bytes()
+}
+
+func writeTestSubframe(w *bitio.Writer, sf testSubframe, samples []int64, bps uint8) {
+	s := make([]int64, len(samples))
+	for i := range s {
+		s[i] = samples[i] >> sf.wastedBits
+	}
+	bps -= sf.wastedBits
+
+	var typeBits uint64
+	switch sf.typ {
+	case SubframeTypeConstant:
+		typeBits = 0
+	case SubframeTypeVerbatim:
+		typeBits = 1
+	case SubframeTypeFixed:
+		typeBits = 0x08 | uint64(sf.order)
+	case SubframeTypeLPC:
+		typeBits = 0x20 | uint64(sf.order-1)
+	}
+	w.WriteBits(typeBits, 7) // zero padding, subframe type
+	if sf.wastedBits > 0 {
+		w.WriteBits(1, 1)
+		w.WriteBits(1, sf.wastedBits) // unary wasted bits - 1
+	} else {
+		w.WriteBits(0, 1)
+	}
+
+	switch sf.typ {
+	case SubframeTypeConstant:
+		w.WriteBits(uint64(s[0]), bps)
+		return
+	case SubframeTypeVerbatim:
+		for _, v := range s {
+			w.WriteBits(uint64(v), bps)
+		}
+		return
+	}
+
+	for _, v := range s[:sf.order] {
+		w.WriteBits(uint64(v), bps)
+	}
+
+	residual := make([]int64, len(s))
+	for i := sf.order; i < len(s); i++ {
+		var pred int64
+		switch sf.typ {
+		case SubframeTypeFixed:
+			coeffs := [][]int64{{}, {1}, {2, -1}, {3, -3, 1}, {4, -6, 4, -1}}[sf.order]
+			for j, c := range coeffs {
+				pred += c * s[i-j-1]
+			}
+		case SubframeTypeLPC:
+			for j, c := range sf.coeffs {
+				pred += int64(c) * s[i-j-1]
+			}
+			pred >>= sf.shift
+		}
+		residual[i] = s[i] - pred
+	}
+
+	if sf.typ == SubframeTypeLPC {
+		w.WriteBits(uint64(sf.precision-1), 4)
+		w.WriteBits(uint64(sf.shift), 5)
+		for _, c := range sf.coeffs {
+			w.WriteBits(uint64(c), sf.precision)
+		}
+	}
+
+	w.WriteBits(0, 2) // 4 bit Rice parameters
+	w.WriteBits(0, 4) // partition order
+	w.WriteBits(uint64(sf.riceParam), 4)
+	for _, v := range residual[sf.order:] {
+		u := uint64(v<<1 ^ v>>63)
+		for q := u >> sf.riceParam; q > 0; q-- {
+			w.WriteBits(0, 1)
+		}
+		w.WriteBits(1, 1)
+		w.WriteBits(u, sf.riceParam)
+	}
+}
+
+// widen returns the channels as 64 bit samples, as coded in subframes.
+func widen(channels ...[]int32) [][]int64 {
+	wide := make([][]int64, len(channels))
+	for ch, s := range channels {
+		wide[ch] = make([]int64, len(s))
+		for i, v := range s {
+			wide[ch][i] = int64(v)
+		}
+	}
+	return wide
+}
+
+func testSignal(n int, f func(i int) int32) []int32 {
+	s := make([]int32, n)
+	for i := range s {
+		s[i] = f(i)
+	}
+	return s
+}
+
+func TestReadFrame(t *testing.T) {
+	const blockSize = 64
+
+	left := testSignal(blockSize, func(i int) int32 { return int32((i*37)%200 - 100) })
+	right := testSignal(blockSize, func(i int) int32 { return int32(i*i%300) - 150 })
+	quad := testSignal(blockSize, func(i int) int32 { return int32(i*i - 40*i) })
+	even := testSignal(blockSize, func(i int) int32 { return int32(i*8 - 200) })
+
+	frames := []struct {
+		desc       string
+		assignment ChannelAssignment
+		channels   [][]int32 // decoded channels
+		coded      [][]int32 // channels as coded in the subframes
+		subframes  []testSubframe
+	}{
+		{
+			desc:       "verbatim and constant",
+			assignment: 1,
+			channels:   [][]int32{left, testSignal(blockSize, func(int) int32 { return -7 })},
+			coded:      [][]int32{left, testSignal(blockSize, func(int) int32 { return -7 })},
+			subframes:  []testSubframe{{typ: SubframeTypeVerbatim}, {typ: SubframeTypeConstant}},
+		},
+		{
+			desc:       "fixed with left-side",
+			assignment: ChannelAssignmentLeftSide,
+			channels:   [][]int32{quad, even},
+			coded:      [][]int32{quad, testSignal(blockSize, func(i int) int32 { return quad[i] - even[i] })},
+			subframes: []testSubframe{
+				{typ: SubframeTypeFixed, order: 2, riceParam: 1},
+				{typ: SubframeTypeFixed, order: 3, riceParam: 3},
+			},
+		},
+		{
+			desc:       "fixed with side-right and wasted bits",
+			assignment: ChannelAssignmentSideRight,
+			channels:   [][]int32{left, even},
+			coded:      [][]int32{testSignal(blockSize, func(i int) int32 { return left[i] - even[i] }), even},
+			subframes: []testSubframe{
+				{typ: SubframeTypeFixed, order: 0, riceParam: 7},
+				{typ: SubframeTypeFixed, order: 1, wastedBits: 3, riceParam: 1},
+			},
+		},
+		{
+			desc:       "LPC with mid-side",
+			assignment: ChannelAssignmentMidSide,
+			channels:   [][]int32{left, right},
+			coded: [][]int32{
+				testSignal(blockSize, func(i int) int32 { return (left[i] + right[i]) >> 1 }),
+				testSignal(blockSize, func(i int) int32 { return left[i] - right[i] }),
+			},
+			subframes: []testSubframe{
+				{typ: SubframeTypeLPC, order: 2, coeffs: []int32{3, -1}, shift: 1, precision: 4, riceParam: 6},
+				{typ: SubframeTypeLPC, order: 1, coeffs: []int32{1}, shift: 0, precision: 2, riceParam: 7},
+			},
+		},
+	}
+
+	var stream bytes.Buffer
+	w := NewWriter(&stream)
+	err := w.WriteBlock(&MetadataBlock{
+		MetadataBlockHeader: MetadataBlockHeader{Last: true},
+		Data: &StreamInfo{
+			MinimumBlockSize: blockSize,
+			MaximumBlockSize: blockSize,
+			SampleRate:       44100,
+			Channels:         2,
+			BitsPerSample:    16,
+			TotalSamples:     blockSize * uint64(len(frames)),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range frames {
+		stream.Write(buildTestFrame(t, uint64(i), f.assignment, 16, widen(f.coded...), f.subframes))
+	}
+
+	r := NewReader(bytes.NewReader(stream.Bytes()))
+	for i, tt := range frames {
+		t.Run(tt.desc, func(t *testing.T) {
+			f, err := r.ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.SampleNumber != uint64(i*blockSize) {
+				t.Errorf("sample number = %d, want %d", f.SampleNumber, i*blockSize)
+			}
+			if f.ChannelAssignment != tt.assignment {
+				t.Errorf("channel assignment = %d, want %d", f.ChannelAssignment, tt.assignment)
+			}
+			for ch := range tt.channels {
+				if f.Subframes[ch].Type != tt.subframes[ch].typ {
+					t.Errorf("channel %d: subframe type = %s, want %s", ch, f.Subframes[ch].Type, tt.subframes[ch].typ)
+				}
+				for j := range tt.channels[ch] {
+					if f.Samples[ch][j] != tt.channels[ch][j] {
+						t.Fatalf("channel %d: sample %d = %d, want %d", ch, j, f.Samples[ch][j], tt.channels[ch][j])
+					}
+				}
+			}
+		})
+	}
+
+	if _, err := r.ReadFrame(); err != io.EOF {
+		t.Errorf("ReadFrame at end of stream: err = %v, want io.EOF", err)
+	}
+}
+
+// TestReadFrame32Bit decodes 32 bit stereo frames whose side channels need
+// 33 bits and whose residuals do not fit in 32 bits.
+func TestReadFrame32Bit(t *testing.T) {
+	const blockSize = 32
+
+	// full scale square waves in opposite phase
+	left := testSignal(blockSize, func(i int) int32 {
+		if i/4%2 == 0 {
+			return math.MaxInt32
+		}
+		return math.MinInt32
+	})
+	right := testSignal(blockSize, func(i int) int32 { return ^left[i] })
+	wasted := testSignal(blockSize, func(i int) int32 { return left[i] &^ 0xff })
+	side := make([]int64, blockSize)
+	mid := make([]int64, blockSize)
+	for i := range side {
+		side[i] = int64(left[i]) - int64(right[i])
+		mid[i] = (int64(left[i]) + int64(right[i])) >> 1
+	}
+
+	frames := []struct {
+		desc       string
+		assignment ChannelAssignment
+		channels   [][]int32 // decoded channels
+		coded      [][]int64 // channels as coded in the subframes
+		subframes  []testSubframe
+	}{
+		{
+			desc:       "verbatim 33 bit side with left-side",
+			assignment: ChannelAssignmentLeftSide,
+			channels:   [][]int32{left, right},
+			coded:      [][]int64{widen(left)[0], side},
+			subframes:  []testSubframe{{typ: SubframeTypeVerbatim}, {typ: SubframeTypeVerbatim}},
+		},
+		{
+			desc:       "fixed with side-right and residual overflowing 32 bits",
+			assignment: ChannelAssignmentSideRight,
+			channels:   [][]int32{left, right},
+			coded:      [][]int64{side, widen(right)[0]},
+			subframes: []testSubframe{
+				{typ: SubframeTypeFixed, order: 2, riceParam: 14},
+				{typ: SubframeTypeFixed, order: 1, riceParam: 14},
+			},
+		},
+		{
+			desc:       "LPC with mid-side",
+			assignment: ChannelAssignmentMidSide,
+			channels:   [][]int32{left, right},
+			coded:      [][]int64{mid, side},
+			subframes: []testSubframe{
+				{typ: SubframeTypeLPC, order: 1, coeffs: []int32{1}, precision: 2, riceParam: 14},
+				{typ: SubframeTypeLPC, order: 2, coeffs: []int32{3, -2}, shift: 1, precision: 4, riceParam: 14},
+			},
+		},
+		{
+			desc:       "wasted bits",
+			assignment: ChannelAssignmentLeftSide,
+			channels:   [][]int32{wasted, wasted},
+			coded:      [][]int64{widen(wasted)[0], make([]int64, blockSize)},
+			subframes: []testSubframe{
+				{typ: SubframeTypeFixed, order: 1, wastedBits: 8, riceParam: 14},
+				{typ: SubframeTypeConstant},
+			},
+		},
+	}
+
+	var stream bytes.Buffer
+	w := NewWriter(&stream)
+	err := w.WriteBlock(&MetadataBlock{
+		MetadataBlockHeader: MetadataBlockHeader{Last: true},
+		Data: &StreamInfo{
+			MinimumBlockSize: blockSize,
+			MaximumBlockSize: blockSize,
+			SampleRate:       192000,
+			Channels:         2,
+			BitsPerSample:    32,
+			TotalSamples:     blockSize * uint64(len(frames)),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range frames {
+		stream.Write(buildTestFrame(t, uint64(i), f.assignment, 32, f.coded, f.subframes))
+	}
+
+	r := NewReader(bytes.NewReader(stream.Bytes()))
+	for _, tt := range frames {
+		t.Run(tt.desc, func(t *testing.T) {
+			f, err := r.ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for ch := range tt.channels {
+				for j := range tt.channels[ch] {
+					if f.Samples[ch][j] != tt.channels[ch][j] {
+						t.Fatalf("channel %d: sample %d = %d, want %d", ch, j, f.Samples[ch][j], tt.channels[ch][j])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReadFrameTruncated(t *testing.T) {
+	var stream bytes.Buffer
+	w := NewWriter(&stream)
+	w.WriteBlock(&MetadataBlock{
+		MetadataBlockHeader: MetadataBlockHeader{Last: true},
+		Data:                &StreamInfo{MinimumBlockSize: 16, MaximumBlockSize: 16, SampleRate: 8000, Channels: 1, BitsPerSample: 8},
+	})
+	s := testSignal(16, func(i int) int32 { return int32(i) })
+	frame := buildTestFrame(t, 0, 0, 8, widen(s), []testSubframe{{typ: SubframeTypeVerbatim}})
+	stream.Write(frame[:len(frame)-5])
+
+	r := NewReader(&stream)
+	_, err := r.ReadFrame()
+	if !errors.Is(err, io.ErrUnexpectedEOF) || !errors.Is(err, ErrTruncated) {
+		t.Errorf("err = %v, want ErrTruncated and io.ErrUnexpectedEOF", err)
+	}
+	var terr *TruncatedError
+	if errors.As(err, &terr) && (terr.Offset != 42 || terr.Samples != 0) {
+		t.Errorf("truncated at offset %d after %d samples, want offset 42 after 0 samples", terr.Offset, terr.Samples)
+	}
+}
@@ -0,0 +1,151 @@
+package flac
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// GainMode selects which of the gains stored in the Vorbis comments of a
+// stream is applied to its audio.
+type GainMode uint8
+
+const (
+	// GainModeTrack applies the track gain, or the album gain if the
+	// stream has no track gain.
+	GainModeTrack GainMode = iota
+	// GainModeAlbum applies the album gain, or the track gain if the
+	// stream has no album gain.
+	GainModeAlbum
+)
+
+func (m GainMode) String() string {
+	switch m {
+	case GainModeTrack:
+		return "track"
+	case GainModeAlbum:
+		return "album"
+	}
+	return fmt.Sprintf("GainMode(%d)", m)
+}
+
+// GainConfig holds the settings of the gain applied to decoded audio.
+type GainConfig struct {
+	// Mode selects the track or album gain.
+	Mode GainMode
+	// Preamp is added to the stored gain, in dB.
+	Preamp float64
+	// PreventClipping lowers the gain so that the stored peak does not
+	// exceed full scale.
+	PreventClipping bool
+}
+
+// ReplayGain holds the gains and peaks stored in the REPLAYGAIN_* and R128_*
+// Vorbis comments of a stream.
+type ReplayGain struct {
+	// TrackGain and AlbumGain are in dB, to the ReplayGain 2.0 reference
+	// loudness of -18 LUFS.
+	TrackGain, AlbumGain       float64
+	HasTrackGain, HasAlbumGain bool
+	// TrackPeak and AlbumPeak are the largest absolute sample values, with 1
+	// being full scale, or 0 if unknown.
+	TrackPeak, AlbumPeak float64
+}
+
+// Vorbis comment field names of ReplayGain and of the R128 gains of Opus,
+// which are in 1/256 dB to a reference loudness of -23 LUFS.
+const (
+	replayGainTrackGain = "REPLAYGAIN_TRACK_GAIN"
+	replayGainTrackPeak = "REPLAYGAIN_TRACK_PEAK"
+	replayGainAlbumGain = "REPLAYGAIN_ALBUM_GAIN"
+	replayGainAlbumPeak = "REPLAYGAIN_ALBUM_PEAK"
+	r128TrackGain       = "R128_TRACK_GAIN"
+	r128AlbumGain       = "R128_ALBUM_GAIN"
+	r128Reference       = -23.0 // LUFS
+)
+
+// ParseReplayGain returns the gains and peaks stored in vc, and whether it has
+// a track or album gain. REPLAYGAIN_* gains take precedence over R128_* gains,
+// which are converted to the ReplayGain reference loudness.
+func ParseReplayGain(vc *VorbisComment) (ReplayGain, bool) {
+	var g ReplayGain
+	if vc == nil {
+		return g, false
+	}
+	g.TrackGain, g.HasTrackGain = parseGain(vc, replayGainTrackGain, r128TrackGain)
+	g.AlbumGain, g.HasAlbumGain = parseGain(vc, replayGainAlbumGain, r128AlbumGain)
+	g.TrackPeak = parsePeak(vc, replayGainTrackPeak)
+	g.AlbumPeak = parsePeak(vc, replayGainAlbumPeak)
+	return g, g.HasTrackGain || g.HasAlbumGain
+}
+
+// parseGain returns the gain of the first valid comment of the ReplayGain
+// field, formatted like "-3.21 dB", or else of the R128 field.
+func parseGain(vc *VorbisComment, field, r128Field string) (float64, bool) {
+	for _, v := range vc.Values(field) {
+		v = strings.TrimSpace(v)
+		if len(v) > 2 && strings.EqualFold(v[len(v)-2:], "dB") {
+			v = strings.TrimSpace(v[:len(v)-2])
+		}
+		if gain, err := strconv.ParseFloat(v, 64); err == nil {
+			return gain, true
+		}
+	}
+	for _, v := range vc.Values(r128Field) {
+		if q, err := strconv.ParseInt(strings.TrimSpace(v), 10, 16); err == nil {
+			return float64(q)/256 + ReplayGain2ReferenceLoudness - r128Reference, true
+		}
+	}
+	return 0, false
+}
+
+// parsePeak returns the peak of the first valid comment of the field, or 0.
+func parsePeak(vc *VorbisComment, field string) float64 {
+	for _, v := range vc.Values(field) {
+		if peak, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && peak >= 0 {
+			return peak
+		}
+	}
+	return 0
+}
+
+// Scale returns the factor by which the samples are multiplied to apply the
+// gain selected by config, or 1 if there is no gain.
+func (g ReplayGain) Scale(config GainConfig) float64 {
+	if !g.HasTrackGain && !g.HasAlbumGain {
+		return 1
+	}
+	gain, peak := g.TrackGain, g.TrackPeak
+	if config.Mode == GainModeAlbum && g.HasAlbumGain || !g.HasTrackGain {
+		gain, peak = g.AlbumGain, g.AlbumPeak
+	}
+
+	scale := math.Pow(10, (gain+config.Preamp)/20)
+	if config.PreventClipping && peak > 0 {
+		scale = min(scale, 1/peak)
+	}
+	return scale
+}
+
+// ApplyGain multiplies the channels of samples of bps bits by scale in place,
+// rounding them and clipping them to full scale. It returns the number of
+// samples clipped.
+func ApplyGain(samples [][]int32, bps uint8, scale float64) int {
+	if scale == 1 {
+		return 0
+	}
+	lo, hi := -math.Ldexp(1, int(bps)-1), math.Ldexp(1, int(bps)-1)-1
+	clipped := 0
+	for _, ch := range samples {
+		for i, v := range ch {
+			y := math.Round(float64(v) * scale)
+			if y < lo || y > hi {
+				y = max(lo, min(y, hi))
+				clipped++
+			}
+			ch[i] = int32(y)
+		}
+	}
+	return clipped
+}
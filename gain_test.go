@@ -0,0 +1,79 @@
+package flac
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestReplayGain(t *testing.T) {
+	near := func(desc string, got, want float64) {
+		t.Helper()
+		if math.Abs(got-want) > 1e-9 {
+			t.Errorf("%s = %v, want %v", desc, got, want)
+		}
+	}
+
+	vc := &VorbisComment{UserComments: []string{
+		"replaygain_track_gain=-6.02 dB",
+		"REPLAYGAIN_TRACK_PEAK=0.9",
+		"REPLAYGAIN_ALBUM_GAIN=bogus",
+		"R128_ALBUM_GAIN=-1280",
+		"REPLAYGAIN_ALBUM_PEAK=1.25",
+	}}
+	g, ok := ParseReplayGain(vc)
+	if !ok || !g.HasTrackGain || !g.HasAlbumGain {
+		t.Fatalf("ParseReplayGain = %+v, %v", g, ok)
+	}
+	near("track gain", g.TrackGain, -6.02)
+	near("track peak", g.TrackPeak, 0.9)
+	near("album gain from R128", g.AlbumGain, 0)
+	near("album peak", g.AlbumPeak, 1.25)
+
+	near("track scale", g.Scale(GainConfig{Mode: GainModeTrack}), math.Pow(10, -6.02/20))
+	near("album scale with preamp", g.Scale(GainConfig{Mode: GainModeAlbum, Preamp: 4}), math.Pow(10, 4./20))
+	near("track scale limited by peak", g.Scale(GainConfig{Preamp: 8, PreventClipping: true}), 1/0.9)
+	near("album scale limited by peak", g.Scale(GainConfig{Mode: GainModeAlbum, Preamp: 12, PreventClipping: true}), 1/1.25)
+
+	// the other gain is used if the one asked for is missing
+	g, _ = ParseReplayGain(&VorbisComment{UserComments: []string{"R128_TRACK_GAIN=512"}})
+	near("album scale from track gain", g.Scale(GainConfig{Mode: GainModeAlbum}), math.Pow(10, (2+5)/20.))
+	if g, ok := ParseReplayGain(&VorbisComment{UserComments: []string{"TITLE=x"}}); ok || g.Scale(GainConfig{Preamp: 6}) != 1 {
+		t.Errorf("stream without gain has scale %v", g.Scale(GainConfig{Preamp: 6}))
+	}
+
+	// a Reader applies the gain, clipping what exceeds full scale
+	audio := [][]int32{{100, -100, 20000, -30000, 0}}
+	var stream bytes.Buffer
+	testEncode(t, &stream, &StreamInfo{SampleRate: 44100, Channels: 1, BitsPerSample: 16}, CompressionLevel(0), audio, &MetadataBlock{
+		MetadataBlockHeader: MetadataBlockHeader{Type: MetadataBlockTypeVorbisComment},
+		Data:                &VorbisComment{Vendor: "test", UserComments: []string{"REPLAYGAIN_TRACK_GAIN=+6.0206 dB", "REPLAYGAIN_TRACK_PEAK=0.92"}},
+	})
+	for _, tt := range []struct {
+		config  GainConfig
+		want    []int32
+		clipped uint64
+	}{
+		{GainConfig{}, []int32{200, -200, 32767, -32768, 0}, 2},
+		{GainConfig{PreventClipping: true}, []int32{109, -109, 21739, -32609, 0}, 0},
+	} {
+		r := NewReader(bytes.NewReader(stream.Bytes()))
+		r.Gain = &tt.config
+		f, err := r.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, v := range f.Samples[0] {
+			if v != tt.want[i] {
+				t.Errorf("%+v: sample %d = %d, want %d", tt.config, i, v, tt.want[i])
+			}
+		}
+		if r.GainClipped() != tt.clipped {
+			t.Errorf("%+v: %d samples clipped, want %d", tt.config, r.GainClipped(), tt.clipped)
+		}
+		if _, err := r.ReadFrame(); err != io.EOF {
+			t.Errorf("%+v: got %v, want EOF", tt.config, err)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package flac
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// Defaults of the zero fields of an InspectConfig.
+const (
+	defaultSilenceThreshold = -60.0 // dBFS
+	defaultMinSilence       = 2.0   // seconds
+	defaultMinClipRun       = 3     // samples
+	drBlockTime             = 3.0   // seconds per block of the dynamic range meter
+	drLoudestBlocks         = 0.2   // fraction of the blocks of the dynamic range
+)
+
+// InspectConfig holds the settings of an Inspector. Zero fields select the
+// defaults.
+type InspectConfig struct {
+	// SilenceThreshold is the level in dBFS below which every channel must
+	// be for the audio to be silent. The default is -60 dBFS.
+	SilenceThreshold float64
+	// MinSilence is the length in seconds of the shortest silence reported
+	// within the audio. Leading and trailing silence is reported whatever
+	// its length. The default is 2 seconds.
+	MinSilence float64
+	// MinClipRun is the number of consecutive full scale samples of a
+	// channel reported as clipping. The default is 3.
+	MinClipRun int
+}
+
+// QualityReport holds the results of an Inspector.
+type QualityReport struct {
+	// SampleRate and Samples are the sample rate and the number of samples
+	// of each channel inspected.
+	SampleRate uint32
+	Samples    uint64
+	// Channels holds the measurements of each channel.
+	Channels []ChannelQuality
+	// ClipRuns are the runs of clipped samples, in order of their start,
+	// and ClippedSamples is the number of samples in them.
+	ClipRuns       []ClipRun
+	ClippedSamples uint64
+	// LeadingSilence and TrailingSilence are the number of silent samples
+	// at the start and end of the audio. Both are Samples if the audio is
+	// silent throughout.
+	LeadingSilence, TrailingSilence uint64
+	// Silences are the spans of silence within the audio.
+	Silences []SampleSpan
+	// DynamicRange is the dynamic range in the manner of the DR meter: the
+	// mean of the dynamic range of the channels, rounded.
+	DynamicRange int
+}
+
+// ChannelQuality holds the measurements of a channel. Levels are relative to
+// full scale, with 1 being full scale.
+type ChannelQuality struct {
+	// DCOffset is the mean of the samples.
+	DCOffset float64
+	// Peak is the largest absolute sample value, and RMS the root mean
+	// square of the samples.
+	Peak, RMS float64
+	// CrestFactor is the ratio of the peak and RMS, in dB.
+	CrestFactor float64
+	// DynamicRange is the ratio, in dB, of the second largest peak of 3
+	// second blocks and the RMS of the loudest 20% of the blocks.
+	DynamicRange float64
+}
+
+// ClipRun is a run of consecutive full scale samples of a channel.
+type ClipRun struct {
+	Channel int
+	Start   uint64 // sample number of the first clipped sample
+	Length  uint64
+}
+
+// SampleSpan is a span of samples.
+type SampleSpan struct {
+	Start  uint64 // sample number of the first sample
+	Length uint64
+}
+
+// Inspector inspects decoded audio for quality control: clipping, DC offset,
+// silence, crest factor and dynamic range. The samples of a stream are passed
+// to Write or WriteFrame in order, and Report returns the results.
+type Inspector struct {
+	config     InspectConfig
+	sampleRate uint32
+	lo, hi     int32   // full scale sample values
+	scale      float64 // factor of a sample relative to full scale
+	silent     int64   // largest absolute sample value of silence
+	minSilence uint64  // samples of the shortest internal silence
+
+	n        uint64 // samples inspected
+	sum, sq  []float64
+	peak     []int64
+	clipping []uint64 // length of the current run of clipped samples of each channel
+	clipRuns []ClipRun
+	clipped  uint64
+
+	silenceStart uint64 // start of the current silence
+	inSilence    bool
+	leading      uint64
+	silences     []SampleSpan
+
+	drBlock  uint64      // samples per dynamic range block
+	drN      uint64      // samples in the current block
+	drSq     []float64   // sum of squares of the current block of each channel
+	drPeak   []int64     // peak of the current block of each channel
+	drBlocks [][]drBlock // blocks of each channel
+}
+
+// drBlock holds the measurements of a block of the dynamic range meter.
+type drBlock struct {
+	rms, peak float64
+}
+
+// NewInspector returns an Inspector of audio of the sample rate, channels and
+// bits per sample of info.
+func NewInspector(info *StreamInfo, config InspectConfig) (*Inspector, error) {
+	if err := checkAudioFormat(info); err != nil {
+		return nil, err
+	}
+	if config.SilenceThreshold == 0 {
+		config.SilenceThreshold = defaultSilenceThreshold
+	}
+	if config.MinSilence == 0 {
+		config.MinSilence = defaultMinSilence
+	}
+	if config.MinClipRun == 0 {
+		config.MinClipRun = defaultMinClipRun
+	}
+
+	channels := int(info.Channels)
+	fullScale := math.Ldexp(1, int(info.BitsPerSample)-1)
+	return &Inspector{
+		config:     config,
+		sampleRate: info.SampleRate,
+		lo:         int32(-fullScale),
+		hi:         int32(fullScale - 1),
+		scale:      1 / fullScale,
+		silent:     int64(fullScale * math.Pow(10, config.SilenceThreshold/20)),
+		minSilence: uint64(math.Ceil(config.MinSilence * float64(info.SampleRate))),
+		sum:        make([]float64, channels),
+		sq:         make([]float64, channels),
+		peak:       make([]int64, channels),
+		clipping:   make([]uint64, channels),
+		inSilence:  true,
+		drBlock:    uint64(drBlockTime * float64(info.SampleRate)),
+		drSq:       make([]float64, channels),
+		drPeak:     make([]int64, channels),
+		drBlocks:   make([][]drBlock, channels),
+	}, nil
+}
+
+// WriteFrame inspects the samples of a frame.
+func (in *Inspector) WriteFrame(f *Frame) {
+	in.Write(f.Samples)
+}
+
+// Write inspects channels of samples of the bits per sample of the stream.
+func (in *Inspector) Write(samples [][]int32) {
+	for i := range samples[0] {
+		silent := true
+		for c, ch := range samples {
+			v := ch[i]
+			x := float64(v)
+			in.sum[c] += x
+			in.sq[c] += x * x
+			in.drSq[c] += x * x
+			a := max(int64(v), -int64(v))
+			in.peak[c] = max(in.peak[c], a)
+			in.drPeak[c] = max(in.drPeak[c], a)
+			silent = silent && a <= in.silent
+
+			if v == in.lo || v == in.hi {
+				in.clipping[c]++
+			} else {
+				in.endClipRun(c)
+			}
+		}
+
+		switch {
+		case silent && !in.inSilence:
+			in.silenceStart, in.inSilence = in.n, true
+		case !silent && in.inSilence:
+			in.endSilence()
+		}
+
+		in.n++
+		if in.drN++; in.drN == in.drBlock {
+			in.endDRBlock()
+		}
+	}
+}
+
+// endClipRun ends the run of clipped samples of channel c, if any.
+func (in *Inspector) endClipRun(c int) {
+	if n := in.clipping[c]; n >= uint64(in.config.MinClipRun) {
+		in.clipRuns = append(in.clipRuns, ClipRun{Channel: c, Start: in.n - n, Length: n})
+		in.clipped += n
+	}
+	in.clipping[c] = 0
+}
+
+// endSilence ends the current silence at sample in.n.
+func (in *Inspector) endSilence() {
+	in.inSilence = false
+	n := in.n - in.silenceStart
+	switch {
+	case in.silenceStart == 0:
+		in.leading = n
+	case n >= in.minSilence:
+		in.silences = append(in.silences, SampleSpan{Start: in.silenceStart, Length: n})
+	}
+}
+
+// endDRBlock ends a block of the dynamic range meter.
+func (in *Inspector) endDRBlock() {
+	for c := range in.drBlocks {
+		in.drBlocks[c] = append(in.drBlocks[c], drBlock{
+			rms:  math.Sqrt(2*in.drSq[c]/float64(in.drN)) * in.scale,
+			peak: float64(in.drPeak[c]) * in.scale,
+		})
+		in.drSq[c], in.drPeak[c] = 0, 0
+	}
+	in.drN = 0
+}
+
+// Report returns the results of the audio inspected so far.
+func (in *Inspector) Report() *QualityReport {
+	rep := &QualityReport{
+		SampleRate:     in.sampleRate,
+		Samples:        in.n,
+		ClipRuns:       slices.Clone(in.clipRuns),
+		ClippedSamples: in.clipped,
+		LeadingSilence: in.leading,
+		Silences:       slices.Clone(in.silences),
+	}
+
+	// runs of clipped samples and silence at the end
+	for c, n := range in.clipping {
+		if n >= uint64(in.config.MinClipRun) {
+			rep.ClipRuns = append(rep.ClipRuns, ClipRun{Channel: c, Start: in.n - n, Length: n})
+			rep.ClippedSamples += n
+		}
+	}
+	slices.SortStableFunc(rep.ClipRuns, func(a, b ClipRun) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+	if in.inSilence {
+		if in.silenceStart == 0 {
+			rep.LeadingSilence = in.n
+		}
+		rep.TrailingSilence = in.n - in.silenceStart
+	}
+
+	var dr float64
+	for c := range in.sum {
+		q := ChannelQuality{Peak: float64(in.peak[c]) * in.scale}
+		if in.n > 0 {
+			q.DCOffset = in.sum[c] / float64(in.n) * in.scale
+			q.RMS = math.Sqrt(in.sq[c]/float64(in.n)) * in.scale
+		}
+		if q.RMS > 0 {
+			q.CrestFactor = 20 * math.Log10(q.Peak/q.RMS)
+		}
+		blocks := in.drBlocks[c]
+		if len(blocks) == 0 && in.drN > 0 {
+			// audio shorter than a block is measured as one
+			blocks = []drBlock{{
+				rms:  math.Sqrt(2*in.drSq[c]/float64(in.drN)) * in.scale,
+				peak: float64(in.drPeak[c]) * in.scale,
+			}}
+		}
+		q.DynamicRange = dynamicRange(blocks)
+		dr += q.DynamicRange
+		rep.Channels = append(rep.Channels, q)
+	}
+	rep.DynamicRange = int(math.Round(dr / float64(len(in.sum))))
+	return rep
+}
+
+// dynamicRange returns the dynamic range in dB of the blocks of a channel:
+// the ratio of the second largest peak and the RMS of the loudest blocks.
+func dynamicRange(blocks []drBlock) float64 {
+	if len(blocks) == 0 {
+		return 0
+	}
+	peaks := make([]float64, len(blocks))
+	rms := make([]float64, len(blocks))
+	for i, b := range blocks {
+		peaks[i], rms[i] = b.peak, b.rms
+	}
+	slices.Sort(peaks)
+	slices.Sort(rms)
+	peak := peaks[len(peaks)-1]
+	if len(peaks) > 1 {
+		peak = peaks[len(peaks)-2]
+	}
+
+	loudest := rms[len(rms)-max(int(float64(len(rms))*drLoudestBlocks), 1):]
+	var sq float64
+	for _, v := range loudest {
+		sq += v * v
+	}
+	r := math.Sqrt(sq / float64(len(loudest)))
+	if r == 0 || peak == 0 {
+		return 0
+	}
+	return 20 * math.Log10(peak/r)
+}
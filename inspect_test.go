@@ -0,0 +1,85 @@
+package flac
+
+import (
+	"math"
+	"testing"
+)
+
+func TestInspector(t *testing.T) {
+	const rate = 8000
+
+	// 1 s of silence, 4 s of a sine with a DC offset that clips channel 0
+	// for 5 samples, 3 s of near silence, 4 s of the sine and 0.5 s of
+	// silence
+	var left, right []int32
+	add := func(n int, f func(i int) (int32, int32)) {
+		for i := 0; i < n; i++ {
+			l, r := f(i)
+			left, right = append(left, l), append(right, r)
+		}
+	}
+	sine := func(i int) (int32, int32) {
+		v := 16000 * math.Sin(2*math.Pi*float64(i)*440/rate)
+		return int32(v + 1000), int32(v / 4)
+	}
+	add(rate, func(int) (int32, int32) { return 0, 0 })
+	add(4*rate, sine)
+	clipStart := len(left) - 2*rate
+	for i := clipStart; i < clipStart+5; i++ {
+		left[i] = 32767
+	}
+	left[clipStart+100], left[clipStart+101] = -32768, -32768 // too short
+	add(3*rate, func(i int) (int32, int32) { return int32(i % 3), 0 })
+	add(4*rate, sine)
+	add(rate/2, func(int) (int32, int32) { return 0, 0 })
+
+	in, err := NewInspector(&StreamInfo{SampleRate: rate, Channels: 2, BitsPerSample: 16}, InspectConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(left); i += 4096 {
+		end := min(i+4096, len(left))
+		in.Write([][]int32{left[i:end], right[i:end]})
+	}
+	rep := in.Report()
+
+	if rep.Samples != uint64(len(left)) || rep.SampleRate != rate {
+		t.Errorf("report of %d samples at %d Hz, want %d at %d Hz", rep.Samples, rep.SampleRate, len(left), rate)
+	}
+	if len(rep.ClipRuns) != 1 || rep.ClipRuns[0] != (ClipRun{Channel: 0, Start: uint64(clipStart), Length: 5}) || rep.ClippedSamples != 5 {
+		t.Errorf("clip runs = %+v, %d samples", rep.ClipRuns, rep.ClippedSamples)
+	}
+	if rep.LeadingSilence != rate || rep.TrailingSilence != rate/2 {
+		t.Errorf("leading and trailing silence = %d and %d samples, want %d and %d", rep.LeadingSilence, rep.TrailingSilence, rate, rate/2)
+	}
+	// the sine crosses zero within -60 dBFS, but too briefly to be silence
+	if len(rep.Silences) != 1 || rep.Silences[0].Length < 3*rate || rep.Silences[0].Length > 3*rate+10 || rep.Silences[0].Start > 5*rate {
+		t.Errorf("silences = %+v, want 3 s at 5 s", rep.Silences)
+	}
+
+	if len(rep.Channels) != 2 {
+		t.Fatalf("report of %d channels", len(rep.Channels))
+	}
+	music := 8.0 / 12.5 // fraction of the audio that is the sine
+	if dc := rep.Channels[0].DCOffset; math.Abs(dc-music*1000/32768) > 0.001 {
+		t.Errorf("DC offset = %.5f, want %.5f", dc, music*1000/32768)
+	}
+	if dc := rep.Channels[1].DCOffset; math.Abs(dc) > 0.0001 {
+		t.Errorf("DC offset of channel 1 = %.5f, want 0", dc)
+	}
+	if p := rep.Channels[0].Peak; p != 1 {
+		t.Errorf("peak = %v, want 1", p)
+	}
+	// a sine has a crest factor of 3 dB, raised by the silence
+	wantCrest := 3.01 - 10*math.Log10(music)
+	if c := rep.Channels[1].CrestFactor; math.Abs(c-wantCrest) > 0.1 {
+		t.Errorf("crest factor = %.2f dB, want %.2f dB", c, wantCrest)
+	}
+	// and a dynamic range of 0 dB in the manner of the DR meter
+	if dr := rep.Channels[1].DynamicRange; math.Abs(dr) > 0.1 {
+		t.Errorf("dynamic range of channel 1 = %.2f dB, want 0", dr)
+	}
+	if rep.DynamicRange != 0 {
+		t.Errorf("dynamic range = DR%d, want DR0", rep.DynamicRange)
+	}
+}
@@ -0,0 +1,453 @@
+package flac
+
+import (
+	"math"
+	"slices"
+)
+
+// ReplayGain 1.0 analysis, after the reference gain_analysis.c.
+//
+// https://wiki.hydrogenaud.io/index.php?title=ReplayGain_1.0_specification
+const (
+	// ReplayGainReferenceLoudness is the loudness in dB SPL to which
+	// ReplayGain 1.0 adjusts audio.
+	ReplayGainReferenceLoudness = 89.0
+
+	rgPinkRef       = 64.82 // analysis level of the pink noise reference
+	rgStepsPerDB    = 100
+	rgMaxDB         = 120
+	rgRMSPercentile = 0.95
+	rgWindowTime    = 0.050 // seconds per RMS window
+)
+
+// rgYuleFilters holds the coefficients of the equal loudness filters of the
+// supported sample rates, as {b0, a1, b1, ..., a10, b10}.
+var rgYuleFilters = map[uint32][21]float64{
+	48000: {0.03857599435200, -3.84664617118067, -0.02160367184185, 7.81501653005538, -0.00123395316851, -11.34170355132042, -0.00009291677959, 13.05504219327545, -0.01655260341619, -12.28759895145294, 0.02161526843274, 9.48293806319790, -0.02074045215285, -5.87257861775999, 0.00594298065125, 2.75465861874613, 0.00306428023191, -0.86984376593551, 0.00012025322027, 0.13919314567432, 0.00288463683916},
+	44100: {0.05418656406430, -3.47845948550071, -0.02911007808948, 6.36317777566148, -0.00848709379851, -8.54751527471874, -0.00851165645469, 9.47693607801280, -0.00834990904936, -8.81498681370155, 0.02245293253339, 6.85401540936998, -0.02596338512915, -4.39470996079559, 0.01624864962975, 2.19611684890774, -0.00240879051584, -0.75104302451432, 0.00674613682247, 0.13149317958808, -0.00187763777362},
+	32000: {0.15457299681924, -2.37898834973084, -0.09331049056315, 2.84868151156327, -0.06247880153653, -2.64577170229825, 0.02163541888798, 2.23697657451713, -0.05588393329856, -1.67148153367602, 0.04781476674921, 1.00595954808547, 0.00222312597743, -0.45953458054983, 0.03174092540049, 0.16378164858596, -0.01390589421898, -0.05032077717131, 0.00651420667831, 0.02347897407020, -0.00881362733839},
+	24000: {0.30296907319327, -1.61273165137247, -0.22613988682123, 1.07977492259970, -0.08587323730772, -0.25656257754070, 0.03282930172664, -0.16276719120440, -0.00915702933434, -0.22638893773906, -0.02364141202522, 0.39120800788284, -0.00584456039913, -0.22138138954925, 0.06276101321749, 0.04500235387352, -0.00000828086748, 0.02005851806501, 0.00205861885564, 0.00302439095741, -0.02950134983287},
+	22050: {0.33642304856132, -1.49858979367799, -0.25572241425570, 0.87350271418188, -0.11828570177555, 0.12205022308084, 0.11921148675203, -0.80774944671438, -0.07834489609479, 0.47854794562326, -0.00469977914380, -0.12453458140019, -0.00589500224440, -0.04067510197014, 0.05724228140351, 0.08333755284107, 0.00832043980773, -0.04237348025746, -0.01635381384540, 0.02977207319925, -0.01760176568150},
+	16000: {0.44915256608450, -0.62820619233671, -0.14351757464547, 0.29661783706366, -0.22784394429749, -0.37256372942400, -0.01419140100551, 0.00213767857124, 0.04078262797139, -0.42029820170918, -0.12398163381748, 0.22199650564824, 0.04097565135648, 0.00613424350682, 0.10478503600251, 0.06747620744683, -0.01863887810927, 0.05784820375801, -0.03193428438915, 0.03222754072173, 0.00541907748707},
+	12000: {0.56619470757641, -1.04800335126349, -0.75464456939302, 0.29156311971249, 0.16242137742230, -0.26806001042947, 0.16744243493672, 0.00819999645858, -0.18901604199609, 0.45054734505008, 0.30931782841830, -0.33032403314006, -0.27562961986224, 0.06739368333110, 0.00647310677246, -0.04784254229033, 0.08647503780351, 0.01639907836189, -0.03788984554840, 0.01807364323573, -0.00588215443421},
+	11025: {0.58100494960553, -0.51035327095184, -0.53174909058578, -0.31863563325245, -0.14289799034253, -0.20256413484477, 0.17520704835522, 0.14728154134330, 0.02377945217615, 0.38952639978999, 0.15558449135573, -0.23313271880868, -0.25344790059353, -0.05246019024463, 0.01628462406333, -0.02505961724053, 0.06920467763959, 0.02442357316099, -0.03721611395801, 0.01818801111503, -0.00749618797172},
+	8000:  {0.53648789255105, -0.25049871956020, -0.42163034350696, -0.43193942311114, -0.00275953611929, -0.03424681017675, 0.04267842219415, -0.04678328784242, -0.10214864179676, 0.26408300200955, 0.14590772289388, 0.15113130533216, -0.02459864859345, -0.17556493366449, -0.11202315195388, -0.18823009262115, -0.04060034127000, 0.05477720428674, 0.04788665548180, 0.04704409688120, -0.02217936801134},
+}
+
+// EBU R128 and ITU-R BS.1770 analysis.
+//
+// https://tech.ebu.ch/docs/r/r128.pdf
+// https://tech.ebu.ch/docs/tech/tech3342.pdf
+const (
+	// ReplayGain2ReferenceLoudness is the loudness in LUFS to which
+	// ReplayGain 2.0 adjusts audio.
+	ReplayGain2ReferenceLoudness = -18.0
+
+	absoluteGate       = -70.0 // LUFS
+	integratedGate     = -10.0 // LU below the ungated loudness
+	rangeGate          = -20.0 // LU below the ungated loudness
+	momentaryBlocks    = 4     // 100 ms blocks in a momentary window
+	shortTermBlocks    = 30    // 100 ms blocks in a short-term window
+	truePeakOversample = 4
+	truePeakTaps       = 12 // input samples per interpolated sample
+)
+
+// iirFilter is a direct form I IIR filter with a0 = 1.
+type iirFilter struct {
+	b, a []float64 // a[0] is unused
+	x, y []float64 // input and output history, most recent first
+}
+
+func newIIRFilter(b, a []float64) *iirFilter {
+	return &iirFilter{b: b, a: a, x: make([]float64, len(b)), y: make([]float64, len(a))}
+}
+
+func (f *iirFilter) filter(in float64) float64 {
+	copy(f.x[1:], f.x)
+	f.x[0] = in
+	out := 0.0
+	for i, b := range f.b {
+		out += b * f.x[i]
+	}
+	for i := 1; i < len(f.a); i++ {
+		out -= f.a[i] * f.y[i-1]
+	}
+	copy(f.y[1:], f.y)
+	f.y[0] = out
+	return out
+}
+
+// newYuleFilter returns the ReplayGain 1.0 equal loudness filter for the
+// sample rate, or nil if the sample rate is not supported.
+func newYuleFilter(sampleRate uint32) *iirFilter {
+	c, ok := rgYuleFilters[sampleRate]
+	if !ok {
+		return nil
+	}
+	b := []float64{c[0]}
+	a := []float64{1}
+	for i := 1; i < len(c); i += 2 {
+		a = append(a, c[i])
+		b = append(b, c[i+1])
+	}
+	return newIIRFilter(b, a)
+}
+
+// newButterFilter returns the 2nd order Butterworth 150 Hz high-pass filter
+// of ReplayGain 1.0 for the sample rate.
+func newButterFilter(sampleRate uint32) *iirFilter {
+	k := math.Tan(math.Pi * 150 / float64(sampleRate))
+	norm := 1 / (1 + math.Sqrt2*k + k*k)
+	b := []float64{norm, -2 * norm, norm}
+	a := []float64{1, 2 * (k*k - 1) * norm, (1 - math.Sqrt2*k + k*k) * norm}
+	return newIIRFilter(b, a)
+}
+
+// newKWeightingFilters returns the high shelf and high-pass filters of the
+// BS.1770 K-weighting for the sample rate, derived from their analog
+// prototypes so that any sample rate is supported.
+func newKWeightingFilters(sampleRate uint32) (shelf, highpass *iirFilter) {
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / float64(sampleRate))
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf = newIIRFilter(
+		[]float64{(vh + vb*k/q + k*k) / a0, 2 * (k*k - vh) / a0, (vh - vb*k/q + k*k) / a0},
+		[]float64{1, 2 * (k*k - 1) / a0, (1 - k/q + k*k) / a0},
+	)
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / float64(sampleRate))
+	a0 = 1 + k/q + k*k
+	highpass = newIIRFilter(
+		[]float64{1, -2, 1},
+		[]float64{1, 2 * (k*k - 1) / a0, (1 - k/q + k*k) / a0},
+	)
+	return shelf, highpass
+}
+
+// loudnessWeights returns the BS.1770 weights of the channels of a stream in
+// the channel order of FLAC: 1.41 for the surround channels, 0 for the LFE
+// channel and 1 for the others.
+func loudnessWeights(channels int) []float64 {
+	w := make([]float64, channels)
+	for i := range w {
+		w[i] = 1
+	}
+	switch channels {
+	case 4: // front left, front right, back left, back right
+		w[2], w[3] = 1.41, 1.41
+	case 5: // front left, front right, front center, back left, back right
+		w[3], w[4] = 1.41, 1.41
+	case 6: // as 5 channels with LFE after front center
+		w[3], w[4], w[5] = 0, 1.41, 1.41
+	case 7: // front left, front right, front center, LFE, back center, side left, side right
+		w[3], w[5], w[6] = 0, 1.41, 1.41
+	case 8: // front left, front right, front center, LFE, back left, back right, side left, side right
+		w[3], w[6], w[7] = 0, 1.41, 1.41
+	}
+	return w
+}
+
+// truePeakFilter holds the Kaiser windowed sinc interpolation filter of each
+// of the oversampled positions between two samples.
+var truePeakFilter = func() (h [truePeakOversample][truePeakTaps]float64) {
+	for p := range h {
+		for k := range h[p] {
+			t := float64(p)/truePeakOversample + float64(truePeakTaps/2-1-k)
+			h[p][k] = sinc(t) * kaiser(t/(truePeakTaps/2), 5)
+		}
+	}
+	return h
+}()
+
+// Loudness holds the loudness measurements of a track or album.
+type Loudness struct {
+	// Integrated is the EBU R128 integrated loudness in LUFS, or -Inf for
+	// silence.
+	Integrated float64
+	// Range is the EBU R128 loudness range in LU.
+	Range float64
+	// MaxMomentary and MaxShortTerm are the largest momentary (400 ms) and
+	// short-term (3 s) loudness in LUFS, or -Inf for audio shorter than
+	// the window.
+	MaxMomentary, MaxShortTerm float64
+	// SamplePeak is the largest absolute sample value, with 1 being full
+	// scale.
+	SamplePeak float64
+	// TruePeak is the largest absolute value of the audio oversampled 4
+	// times, with 1 being full scale.
+	TruePeak float64
+	// ReplayGain1 is the ReplayGain 1.0 gain in dB, or NaN if the sample
+	// rate has no ReplayGain 1.0 filter or the audio is shorter than 50 ms.
+	ReplayGain1 float64
+	// ReplayGain2 is the ReplayGain 2.0 gain in dB, the difference between
+	// the integrated loudness and ReplayGain2ReferenceLoudness.
+	ReplayGain2 float64
+}
+
+// LoudnessAnalyzer measures the loudness of decoded audio with any number of
+// channels. The samples of a track are passed to Write or WriteFrame in
+// order, and Loudness returns the measurements of the track. AlbumLoudness
+// combines the measurements of several tracks.
+type LoudnessAnalyzer struct {
+	bps     uint8
+	weights []float64
+
+	// BS.1770
+	shelf, highpass []*iirFilter
+	blockSize       int       // samples per 100 ms block
+	n               int       // samples in the current block
+	sum             float64   // weighted sum of squares of the current block
+	recent          []float64 // sums of the last shortTermBlocks blocks, most recent last
+	momentary       []float64 // mean square of each momentary window
+	shortTerm       []float64 // mean square of each short-term window
+
+	// ReplayGain 1.0, if the sample rate is supported
+	yule, butter []*iirFilter
+	rgChannels   int // channels analyzed, all but LFE
+	rgWindow     int // samples per RMS window
+	rgN          int
+	rgSum        float64
+	histogram    []uint32
+
+	history    [][]float64 // last truePeakTaps samples of each channel, most recent last
+	samplePeak float64
+	truePeak   float64
+}
+
+// NewLoudnessAnalyzer returns a LoudnessAnalyzer for audio of the sample
+// rate, channels and bits per sample of info.
+func NewLoudnessAnalyzer(info *StreamInfo) (*LoudnessAnalyzer, error) {
+	if err := checkAudioFormat(info); err != nil {
+		return nil, err
+	}
+
+	channels := int(info.Channels)
+	a := &LoudnessAnalyzer{
+		bps:       info.BitsPerSample,
+		weights:   loudnessWeights(channels),
+		blockSize: max(int(info.SampleRate)/10, 1),
+		history:   make([][]float64, channels),
+	}
+	for c := 0; c < channels; c++ {
+		shelf, highpass := newKWeightingFilters(info.SampleRate)
+		a.shelf = append(a.shelf, shelf)
+		a.highpass = append(a.highpass, highpass)
+		a.history[c] = make([]float64, truePeakTaps)
+	}
+	if _, ok := rgYuleFilters[info.SampleRate]; ok {
+		for c := 0; c < channels; c++ {
+			a.yule = append(a.yule, newYuleFilter(info.SampleRate))
+			a.butter = append(a.butter, newButterFilter(info.SampleRate))
+			if a.weights[c] != 0 {
+				a.rgChannels++
+			}
+		}
+		a.rgWindow = int(math.Ceil(float64(info.SampleRate) * rgWindowTime))
+		a.histogram = make([]uint32, rgStepsPerDB*rgMaxDB)
+	}
+	return a, nil
+}
+
+// WriteFrame analyzes the samples of a frame.
+func (a *LoudnessAnalyzer) WriteFrame(f *Frame) {
+	a.Write(f.Samples)
+}
+
+// Write analyzes channels of samples of the bits per sample of the stream.
+func (a *LoudnessAnalyzer) Write(samples [][]int32) {
+	scale := math.Ldexp(1, 1-int(a.bps))
+	for i := range samples[0] {
+		for c, ch := range samples {
+			x := float64(ch[i]) * scale
+			a.samplePeak = max(a.samplePeak, math.Abs(x))
+			a.addTruePeak(c, x)
+
+			y := a.highpass[c].filter(a.shelf[c].filter(x))
+			a.sum += a.weights[c] * y * y
+
+			if a.yule != nil && a.weights[c] != 0 {
+				r := a.butter[c].filter(a.yule[c].filter(x * 32768)) // 16 bit range
+				a.rgSum += r * r
+			}
+		}
+
+		if a.n++; a.n == a.blockSize {
+			a.endBlock()
+		}
+		if a.yule != nil {
+			if a.rgN++; a.rgN == a.rgWindow {
+				v := rgStepsPerDB * 10 * math.Log10(a.rgSum/float64(a.rgN*a.rgChannels)+1e-37)
+				a.histogram[min(max(int(v), 0), len(a.histogram)-1)]++
+				a.rgSum, a.rgN = 0, 0
+			}
+		}
+	}
+}
+
+// addTruePeak adds a sample of channel c to the true peak, interpolating the
+// samples between the samples half the filter length before.
+func (a *LoudnessAnalyzer) addTruePeak(c int, x float64) {
+	h := a.history[c]
+	copy(h, h[1:])
+	h[len(h)-1] = x
+	for p := 1; p < truePeakOversample; p++ {
+		var y float64
+		for k, v := range h {
+			y += v * truePeakFilter[p][k]
+		}
+		a.truePeak = max(a.truePeak, math.Abs(y))
+	}
+}
+
+// endBlock ends a 100 ms block and records the momentary and short-term
+// windows ending with it.
+func (a *LoudnessAnalyzer) endBlock() {
+	if len(a.recent) == shortTermBlocks {
+		a.recent = a.recent[1:]
+	}
+	a.recent = append(a.recent, a.sum)
+	a.sum, a.n = 0, 0
+
+	meanSquare := func(blocks int) float64 {
+		var s float64
+		for _, v := range a.recent[len(a.recent)-blocks:] {
+			s += v
+		}
+		return s / float64(blocks*a.blockSize)
+	}
+	if len(a.recent) >= momentaryBlocks {
+		a.momentary = append(a.momentary, meanSquare(momentaryBlocks))
+	}
+	if len(a.recent) == shortTermBlocks {
+		a.shortTerm = append(a.shortTerm, meanSquare(shortTermBlocks))
+	}
+}
+
+// Loudness returns the measurements of the audio analyzed so far.
+func (a *LoudnessAnalyzer) Loudness() Loudness {
+	return AlbumLoudness(a)
+}
+
+// AlbumLoudness returns the measurements of tracks analyzed as one: the
+// integrated loudness and loudness range of all of them, and the maximum of
+// the peaks and momentary and short-term loudness. The ReplayGain 1.0 album
+// gain is NaN unless every track has one.
+func AlbumLoudness(tracks ...*LoudnessAnalyzer) Loudness {
+	l := Loudness{
+		MaxMomentary: math.Inf(-1),
+		MaxShortTerm: math.Inf(-1),
+	}
+	var momentary, shortTerm []float64
+	histogram := make([]uint32, rgStepsPerDB*rgMaxDB)
+	rg1 := len(tracks) > 0
+	for _, a := range tracks {
+		momentary = append(momentary, a.momentary...)
+		shortTerm = append(shortTerm, a.shortTerm...)
+		for _, v := range a.momentary {
+			l.MaxMomentary = max(l.MaxMomentary, blockLoudness(v))
+		}
+		for _, v := range a.shortTerm {
+			l.MaxShortTerm = max(l.MaxShortTerm, blockLoudness(v))
+		}
+		l.SamplePeak = max(l.SamplePeak, a.samplePeak)
+		l.TruePeak = max(l.TruePeak, a.samplePeak, a.truePeak)
+		if a.histogram == nil {
+			rg1 = false
+			continue
+		}
+		for i, n := range a.histogram {
+			histogram[i] += n
+		}
+	}
+
+	l.Integrated = integratedLoudness(momentary)
+	l.Range = loudnessRange(shortTerm)
+	l.ReplayGain2 = ReplayGain2ReferenceLoudness - l.Integrated
+	l.ReplayGain1 = math.NaN()
+	if rg1 {
+		l.ReplayGain1 = histogramGain(histogram)
+	}
+	return l
+}
+
+// blockLoudness returns the loudness in LUFS of the weighted mean square of
+// the channels.
+func blockLoudness(meanSquare float64) float64 {
+	return -0.691 + 10*math.Log10(meanSquare)
+}
+
+// gatedMean returns the mean of the mean squares of blocks louder than gate,
+// and their number.
+func gatedMean(blocks []float64, gate float64) (float64, int) {
+	var sum float64
+	n := 0
+	for _, v := range blocks {
+		if blockLoudness(v) > gate {
+			sum += v
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	return sum / float64(n), n
+}
+
+// integratedLoudness returns the gated loudness of the momentary windows.
+func integratedLoudness(momentary []float64) float64 {
+	mean, n := gatedMean(momentary, absoluteGate)
+	if n == 0 {
+		return math.Inf(-1)
+	}
+	mean, _ = gatedMean(momentary, max(absoluteGate, blockLoudness(mean)+integratedGate))
+	return blockLoudness(mean)
+}
+
+// loudnessRange returns the difference of the 10th and 95th percentile of
+// the gated loudness of the short-term windows.
+func loudnessRange(shortTerm []float64) float64 {
+	mean, n := gatedMean(shortTerm, absoluteGate)
+	if n == 0 {
+		return 0
+	}
+	gate := max(absoluteGate, blockLoudness(mean)+rangeGate)
+	var loudness []float64
+	for _, v := range shortTerm {
+		if l := blockLoudness(v); l > gate {
+			loudness = append(loudness, l)
+		}
+	}
+	if len(loudness) == 0 {
+		return 0
+	}
+	slices.Sort(loudness)
+	percentile := func(p float64) float64 {
+		return loudness[int(math.Round(float64(len(loudness)-1)*p))]
+	}
+	return percentile(0.95) - percentile(0.10)
+}
+
+// histogramGain returns the ReplayGain 1.0 gain of a loudness histogram, or
+// NaN if it is empty.
+func histogramGain(histogram []uint32) float64 {
+	var elems uint64
+	for _, n := range histogram {
+		elems += uint64(n)
+	}
+	if elems == 0 {
+		return math.NaN()
+	}
+
+	upper := int64(math.Ceil(float64(elems) * (1 - rgRMSPercentile)))
+	i := len(histogram)
+	for i > 0 {
+		i--
+		if upper -= int64(histogram[i]); upper <= 0 {
+			break
+		}
+	}
+	return rgPinkRef - float64(i)/rgStepsPerDB
+}
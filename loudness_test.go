@@ -0,0 +1,97 @@
+package flac
+
+import (
+	"math"
+	"testing"
+)
+
+// analyzeLoudness analyzes channels of float samples at the sample rate as
+// 24 bit audio, in blocks as frames.
+func analyzeLoudness(t *testing.T, rate uint32, channels ...[]float64) *LoudnessAnalyzer {
+	t.Helper()
+	a, err := NewLoudnessAnalyzer(&StreamInfo{SampleRate: rate, Channels: uint8(len(channels)), BitsPerSample: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(channels[0]); i += 4096 {
+		block := make([][]int32, len(channels))
+		for c, ch := range channels {
+			for _, v := range ch[i:min(i+4096, len(ch))] {
+				block[c] = append(block[c], int32(math.Round(v*(1<<23))))
+			}
+		}
+		a.Write(block)
+	}
+	return a
+}
+
+// tone returns seconds of a sine of freq Hz at the sample rate and level in
+// dBFS, starting at the phase in radians.
+func tone(rate uint32, seconds, freq, level, phase float64) []float64 {
+	s := make([]float64, int(seconds*float64(rate)))
+	amp := math.Pow(10, level/20)
+	for i := range s {
+		s[i] = amp * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)+phase)
+	}
+	return s
+}
+
+func TestLoudness(t *testing.T) {
+	near := func(desc string, got, want, tolerance float64) {
+		t.Helper()
+		if math.Abs(got-want) > tolerance {
+			t.Errorf("%s = %.3f, want %.3f", desc, got, want)
+		}
+	}
+
+	// EBU Tech 3341 case 1: a stereo 1 kHz sine at -23 dBFS is -23 LUFS
+	s := tone(48000, 10, 1000, -23, 0)
+	l := analyzeLoudness(t, 48000, s, s).Loudness()
+	near("integrated loudness", l.Integrated, -23, 0.1)
+	near("maximum momentary loudness", l.MaxMomentary, -23, 0.1)
+	near("maximum short-term loudness", l.MaxShortTerm, -23, 0.1)
+	near("loudness range", l.Range, 0, 0.1)
+	near("ReplayGain 2.0 gain", l.ReplayGain2, -18-l.Integrated, 1e-9)
+	near("sample peak", 20*math.Log10(l.SamplePeak), -23, 0.01)
+	if math.IsNaN(l.ReplayGain1) {
+		t.Error("no ReplayGain 1.0 gain at 48 kHz")
+	}
+
+	// EBU Tech 3342 case 1: 20 s at -20 dBFS and 20 s at -30 dBFS have a
+	// loudness range of 10 LU
+	s = append(tone(16000, 20, 1000, -20, 0), tone(16000, 20, 1000, -30, 0)...)
+	a := analyzeLoudness(t, 16000, s, s)
+	near("loudness range", a.Loudness().Range, 10, 1)
+
+	// the true peak of a quarter sample rate sine sampled 45° off its peaks
+	// is 3 dB above the sample peak
+	s = tone(44100, 1, 44100./4, -6, math.Pi/4)
+	l = analyzeLoudness(t, 44100, s).Loudness()
+	near("sample peak", 20*math.Log10(l.SamplePeak), -9.01, 0.01)
+	near("true peak", 20*math.Log10(l.TruePeak), -6, 0.2)
+
+	// the surround channels of 5.1 weigh 1.41 and the LFE channel nothing;
+	// 96 kHz has no ReplayGain 1.0 filter
+	silence := make([]float64, 96000*2)
+	s = tone(96000, 2, 1000, -23, 0)
+	l = analyzeLoudness(t, 96000, silence, silence, silence, s, silence, silence).Loudness()
+	if !math.IsInf(l.Integrated, -1) {
+		t.Errorf("integrated loudness of LFE = %.3f, want -Inf", l.Integrated)
+	}
+	if !math.IsNaN(l.ReplayGain1) {
+		t.Errorf("ReplayGain 1.0 gain at 96 kHz = %.3f, want NaN", l.ReplayGain1)
+	}
+	l = analyzeLoudness(t, 96000, silence, silence, silence, silence, s, silence).Loudness()
+	near("integrated loudness of surround", l.Integrated, -23-3.01+10*math.Log10(1.41), 0.1)
+
+	// an album is measured as one
+	quiet := analyzeLoudness(t, 48000, tone(48000, 5, 1000, -30, 0))
+	loud := analyzeLoudness(t, 48000, tone(48000, 5, 1000, -20, 0))
+	l = AlbumLoudness(quiet, loud)
+	near("album integrated loudness", l.Integrated, -20-3-3+10*math.Log10(1+0.1), 0.1)
+	near("album sample peak", l.SamplePeak, loud.Loudness().SamplePeak, 0)
+	near("album maximum momentary loudness", l.MaxMomentary, loud.Loudness().MaxMomentary, 0)
+	if g := l.ReplayGain1; g >= quiet.Loudness().ReplayGain1 || g <= loud.Loudness().ReplayGain1-0.5 {
+		t.Errorf("album ReplayGain 1.0 gain = %.2f, tracks %.2f and %.2f", g, quiet.Loudness().ReplayGain1, loud.Loudness().ReplayGain1)
+	}
+}
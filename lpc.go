@@ -0,0 +1,298 @@
+package flac
+
+import (
+	"math"
+	"math/bits"
+)
+
+// maxLPCOrder is the largest predictor order of an LPC subframe.
+const maxLPCOrder = 32
+
+// maxFixedOrder is the largest predictor order of a FIXED subframe.
+const maxFixedOrder = 4
+
+// tukeyWindow returns a Tukey window of n points of which the ratio p is
+// tapered.
+func tukeyWindow(n int, p float64) []float64 {
+	w := make([]float64, n)
+	for i := range w {
+		w[i] = 1
+	}
+	taper := int(p / 2 * float64(n))
+	for i := 0; i < taper; i++ {
+		v := 0.5 - 0.5*math.Cos(math.Pi*float64(i)/float64(taper))
+		w[i] = v
+		w[n-1-i] = v
+	}
+	return w
+}
+
+// autocorrelation returns the autocorrelation of the windowed signal x for
+// lags 0 through maxLag.
+func autocorrelation(x []int64, window []float64, maxLag int) []float64 {
+	xw := make([]float64, len(x))
+	for i, v := range x {
+		xw[i] = float64(v) * window[i]
+	}
+
+	r := make([]float64, maxLag+1)
+	for lag := range r {
+		var sum float64
+		for i := lag; i < len(xw); i++ {
+			sum += xw[i] * xw[i-lag]
+		}
+		r[lag] = sum
+	}
+	return r
+}
+
+// levinsonDurbin computes the linear predictor coefficients of every order 1
+// through maxOrder from the autocorrelation r. coeffs[i] holds the
+// coefficients of order i+1 and errs[i] its prediction error. The order may be
+// lowered if the signal is fully predicted by fewer coefficients.
+func levinsonDurbin(r []float64, maxOrder int) (coeffs [][]float64, errs []float64) {
+	if r[0] == 0 {
+		return nil, nil
+	}
+
+	lpc := make([]float64, maxOrder)
+	err := r[0]
+	for i := 0; i < maxOrder; i++ {
+		// reflection coefficient
+		k := -r[i+1]
+		for j := 0; j < i; j++ {
+			k -= lpc[j] * r[i-j]
+		}
+		k /= err
+
+		// update the coefficients in place
+		lpc[i] = k
+		for j := 0; j < i/2; j++ {
+			tmp := lpc[j]
+			lpc[j] += k * lpc[i-1-j]
+			lpc[i-1-j] += k * tmp
+		}
+		if i&1 != 0 {
+			lpc[i/2] += lpc[i/2] * k
+		}
+		err *= 1 - k*k
+
+		c := make([]float64, i+1)
+		for j := range c {
+			c[j] = -lpc[j]
+		}
+		coeffs = append(coeffs, c)
+		errs = append(errs, err)
+
+		if err == 0 {
+			break
+		}
+	}
+	return coeffs, errs
+}
+
+// expectedResidualBits estimates the bits per residual sample of a predictor
+// with the prediction error err over n samples.
+func expectedResidualBits(err float64, n int) float64 {
+	if err <= 0 {
+		return 0
+	}
+	b := 0.5 * math.Log2(0.5*err/float64(n))
+	if b < 0 {
+		return 0
+	}
+	return b
+}
+
+// quantizeCoefficients quantizes the predictor coefficients lp to signed
+// integers of precision bits. It returns false if the coefficients are too
+// large to be quantized with a non-negative shift.
+func quantizeCoefficients(lp []float64, precision uint8) (q []int32, shift int8, ok bool) {
+	var cmax float64
+	for _, c := range lp {
+		cmax = math.Max(cmax, math.Abs(c))
+	}
+	if cmax == 0 {
+		return nil, 0, false
+	}
+
+	precision-- // sign bit
+	qmax := int32(1)<<precision - 1
+	qmin := -int32(1) << precision
+
+	_, exp := math.Frexp(cmax)
+	s := int(precision) - exp
+	if s > 15 { // largest shift of the 5 bit signed field
+		s = 15
+	}
+	if s < 0 {
+		return nil, 0, false
+	}
+
+	q = make([]int32, len(lp))
+	var e float64
+	for i, c := range lp {
+		e += c * float64(int64(1)<<s)
+		v := int32(math.Round(e))
+		if v > qmax {
+			v = qmax
+		} else if v < qmin {
+			v = qmin
+		}
+		e -= float64(v)
+		q[i] = v
+	}
+	return q, int8(s), true
+}
+
+// lpcPrecision returns the coefficient precision in bits for LPC subframes of
+// the given block size.
+func lpcPrecision(blockSize int) uint8 {
+	switch {
+	case blockSize <= 192:
+		return 7
+	case blockSize <= 384:
+		return 8
+	case blockSize <= 576:
+		return 9
+	case blockSize <= 1152:
+		return 10
+	case blockSize <= 2304:
+		return 11
+	case blockSize <= 4608:
+		return 12
+	}
+	return 13
+}
+
+// computeLPCResidual computes the residual of a linear predictor into
+// residual[order:]. It returns false if a residual sample does not fit in 32
+// bits, which RFC 9639 requires of the residual.
+func computeLPCResidual(s []int64, residual, coeffs []int32, shift int8) bool {
+	for i := len(coeffs); i < len(s); i++ {
+		var sum int64
+		for j, c := range coeffs {
+			sum += int64(c) * s[i-j-1]
+		}
+		v := s[i] - sum>>shift
+		if v != int64(int32(v)) {
+			return false
+		}
+		residual[i] = int32(v)
+	}
+	return true
+}
+
+// computeFixedResidual computes the residual of a fixed predictor of the given
+// order into residual[order:]. It returns false if a residual sample does not
+// fit in 32 bits.
+func computeFixedResidual(s []int64, residual []int32, order int) bool {
+	for i := order; i < len(s); i++ {
+		var v int64
+		switch order {
+		case 0:
+			v = s[i]
+		case 1:
+			v = s[i] - s[i-1]
+		case 2:
+			v = s[i] - 2*s[i-1] + s[i-2]
+		case 3:
+			v = s[i] - 3*s[i-1] + 3*s[i-2] - s[i-3]
+		case 4:
+			v = s[i] - 4*s[i-1] + 6*s[i-2] - 4*s[i-3] + s[i-4]
+		}
+		if v != int64(int32(v)) {
+			return false
+		}
+		residual[i] = int32(v)
+	}
+	return true
+}
+
+// riceCoding holds the partitioned Rice coding parameters of a residual.
+type riceCoding struct {
+	partitionOrder uint8
+	params         []uint8
+	bits           int // size of the residual section in bits
+}
+
+// maxRiceParam is the largest Rice parameter of the 5 bit parameter coding
+// method, which is one less than its escape code.
+const maxRiceParam = 30
+
+// chooseRiceCoding chooses the partition order, up to maxPartitionOrder, and
+// the Rice parameters that code residual[order:] in the fewest bits.
+func chooseRiceCoding(residual []int32, order, maxPartitionOrder int) riceCoding {
+	n := len(residual)
+
+	// the block size must be divisible by the number of partitions and the
+	// first partition must hold more samples than the predictor order
+	p := maxPartitionOrder
+	for ; p > 0; p-- {
+		if n%(1<<p) == 0 && n>>p > order {
+			break
+		}
+	}
+
+	// sums of the zigzag coded residual of the partitions at the largest
+	// partition order, then merged pairwise for the smaller orders
+	sums := make([]uint64, 1<<p)
+	size := n >> p
+	for i := order; i < n; i++ {
+		v := residual[i]
+		sums[i/size] += uint64(uint32(v<<1 ^ v>>31))
+	}
+
+	best := riceCoding{bits: math.MaxInt}
+	for ; p >= 0; p-- {
+		parts := 1 << p
+		size := n >> p
+		c := riceCoding{partitionOrder: uint8(p), params: make([]uint8, parts), bits: 2 + 4}
+
+		var maxParam uint8
+		for i, sum := range sums[:parts] {
+			count := size
+			if i == 0 {
+				count -= order
+			}
+			k, bits := riceParam(sum, count)
+			c.params[i] = k
+			c.bits += bits
+			if k > maxParam {
+				maxParam = k
+			}
+		}
+		if maxParam < 15 {
+			c.bits += 4 * parts
+		} else {
+			c.bits += 5 * parts
+		}
+
+		if c.bits < best.bits {
+			best = c
+		}
+		for i := 0; i < parts/2; i++ {
+			sums[i] = sums[2*i] + sums[2*i+1]
+		}
+	}
+	return best
+}
+
+// riceParam estimates the best Rice parameter for count zigzag coded residual
+// samples summing to sum, and the bits needed to code them with it.
+func riceParam(sum uint64, count int) (uint8, int) {
+	if count == 0 {
+		return 0, 0
+	}
+	k0 := bits.Len64(sum / uint64(count))
+
+	// the residual of 32 bit samples may call for more than maxRiceParam
+	bestK, bestBits := uint8(0), math.MaxInt
+	for k := min(max(k0-1, 0), maxRiceParam); k <= min(k0+1, maxRiceParam); k++ {
+		b := count*(k+1) + int(sum>>k)
+		if b < bestBits {
+			bestK, bestBits = uint8(k), b
+		}
+	}
+	return bestK, bestBits
+}
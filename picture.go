@@ -155,3 +155,21 @@ func (r *Reader) decodePicture() (*Picture, error) {
 
 	return picture, nil
 }
+
+func (w *Writer) encodePicture(picture *Picture) {
+	binary.Write(&w.buf, binary.BigEndian, picture.Type)
+
+	binary.Write(&w.buf, binary.BigEndian, uint32(len(picture.MimeType)))
+	w.buf.WriteString(picture.MimeType)
+
+	binary.Write(&w.buf, binary.BigEndian, uint32(len(picture.Description)))
+	w.buf.WriteString(picture.Description)
+
+	binary.Write(&w.buf, binary.BigEndian, picture.Width)
+	binary.Write(&w.buf, binary.BigEndian, picture.Height)
+	binary.Write(&w.buf, binary.BigEndian, picture.Depth)
+	binary.Write(&w.buf, binary.BigEndian, picture.Colors)
+
+	binary.Write(&w.buf, binary.BigEndian, uint32(len(picture.Data)))
+	w.buf.Write(picture.Data)
+}
@@ -0,0 +1,104 @@
+package flac
+
+import (
+	"errors"
+	"io"
+)
+
+// ScanStreamInfo reads the FLAC stream r to the end and returns its
+// STREAMINFO with the minimum and maximum block and frame sizes and the total
+// number of samples recomputed from the audio frames. If computeMD5 is set,
+// the MD5 signature is computed from the decoded audio as well; otherwise the
+// signature of the stream is kept.
+//
+// As in the reference encoder, the minimum block size does not take the last
+// frame into account, which may be shorter, unless it is the only frame.
+func ScanStreamInfo(r io.Reader, computeMD5 bool) (*StreamInfo, error) {
+	fr := NewReader(r)
+	fr.IgnoreTotalSamples = true // being recomputed, so fewer samples are no error
+	if _, err := fr.ReadBlock(); err != nil {
+		return nil, err
+	}
+	orig := fr.StreamInfo()
+	if orig == nil {
+		return nil, errors.New("first metadata block is not STREAMINFO")
+	}
+
+	si := *orig
+	si.MinimumBlockSize, si.MaximumBlockSize = 0, 0
+	si.MinimumFrameSize, si.MaximumFrameSize = 0, 0
+	si.TotalSamples = 0
+	var md5 *AudioMD5
+	if computeMD5 {
+		md5 = NewAudioMD5(si.BitsPerSample)
+	}
+
+	var last uint16 // block size of the previous frame
+	for n := 0; ; n++ {
+		f, err := fr.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if n > 0 && (si.MinimumBlockSize == 0 || last < si.MinimumBlockSize) {
+			si.MinimumBlockSize = last
+		}
+		last = f.BlockSize
+		si.MaximumBlockSize = max(si.MaximumBlockSize, f.BlockSize)
+		if si.MinimumFrameSize == 0 || uint32(f.Size) < si.MinimumFrameSize {
+			si.MinimumFrameSize = uint32(f.Size)
+		}
+		si.MaximumFrameSize = max(si.MaximumFrameSize, uint32(f.Size))
+		si.TotalSamples += uint64(f.BlockSize)
+		if md5 != nil {
+			md5.Write(f.Samples)
+		}
+	}
+	if si.MinimumBlockSize == 0 {
+		si.MinimumBlockSize = last
+	}
+	if md5 != nil {
+		si.MD5 = md5.Sum()
+	}
+	return &si, nil
+}
+
+// RepairStreamInfo scans the FLAC stream in f, from its current position, with
+// ScanStreamInfo and writes the recomputed STREAMINFO back in place, which is
+// possible because the block has a fixed size. It returns the recomputed
+// STREAMINFO.
+func RepairStreamInfo(f io.ReadWriteSeeker, computeMD5 bool) (*StreamInfo, error) {
+	start, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	si, err := ScanStreamInfo(f, computeMD5)
+	if err != nil {
+		return nil, err
+	}
+
+	// read the header of the STREAMINFO block again for its last-block flag
+	if _, err := f.Seek(start+4, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var hdr [1]byte
+	if _, err := io.ReadFull(f, hdr[:]); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(start+4, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	w := &Writer{w: f, wroteMarker: true}
+	err = w.WriteBlock(&MetadataBlock{
+		MetadataBlockHeader: MetadataBlockHeader{Last: hdr[0]&0x80 != 0, Type: MetadataBlockTypeStreamInfo},
+		Data:                si,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return si, nil
+}
@@ -0,0 +1,53 @@
+package flac
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepairStreamInfo(t *testing.T) {
+	audio := testAudio(2, 10000, 16)
+
+	dir := t.TempDir()
+	want, err := os.Create(filepath.Join(dir, "want.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.Close()
+	testEncode(t, want, &StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 16}, CompressionLevel(5), audio)
+
+	// a streamed encoder cannot seek back to complete STREAMINFO
+	got, err := os.Create(filepath.Join(dir, "got.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	var streamed bytes.Buffer
+	testEncode(t, &streamed, &StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 16}, CompressionLevel(5), audio)
+	got.Write(streamed.Bytes())
+	got.Seek(0, io.SeekStart)
+	si, err := ScanStreamInfo(got, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si.TotalSamples != 10000 || !bytes.Equal(si.MD5, make([]byte, 16)) {
+		t.Errorf("scanned total samples %d, MD5 %x, want 10000 and the unset MD5", si.TotalSamples, si.MD5)
+	}
+
+	got.Seek(0, io.SeekStart)
+	if _, err := RepairStreamInfo(got, true); err != nil {
+		t.Fatal(err)
+	}
+	gotData, _ := os.ReadFile(got.Name())
+	wantData, _ := os.ReadFile(want.Name())
+	if !bytes.Equal(gotData, wantData) {
+		r := NewReader(bytes.NewReader(gotData))
+		r.ReadBlock()
+		w := NewReader(bytes.NewReader(wantData))
+		w.ReadBlock()
+		t.Errorf("repaired STREAMINFO = %+v, want %+v", r.StreamInfo(), w.StreamInfo())
+	}
+}
@@ -0,0 +1,256 @@
+package flac
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrResampleRatio is returned by NewResampler for sample rates it cannot
+// convert between.
+var ErrResampleRatio = errors.New("unsupported resampling ratio")
+
+// ResampleQuality selects the filter of a Resampler, trading speed for a
+// flatter passband and more attenuation of aliases.
+type ResampleQuality uint8
+
+const (
+	// ResampleQualityLow passes 80% of the lower Nyquist frequency and
+	// attenuates aliases by 60 dB.
+	ResampleQualityLow ResampleQuality = iota
+	// ResampleQualityMedium passes 90% of the lower Nyquist frequency and
+	// attenuates aliases by 96 dB.
+	ResampleQualityMedium
+	// ResampleQualityHigh passes 95% of the lower Nyquist frequency and
+	// attenuates aliases by 140 dB.
+	ResampleQualityHigh
+)
+
+// resampleFilters are the Kaiser windowed sinc filters of each quality, with
+// taps counted in samples of the lower of the two rates.
+var resampleFilters = [...]struct {
+	taps     int
+	beta     float64
+	passband float64
+}{
+	ResampleQualityLow:    {40, 5.65, 0.80},
+	ResampleQualityMedium: {128, 9.62, 0.90},
+	ResampleQualityHigh:   {384, 14.47, 0.95},
+}
+
+// maxResampleCoefs limits the size of the filter bank of a Resampler, which
+// grows with the interpolation factor of the ratio.
+const maxResampleCoefs = 1 << 22
+
+func (q ResampleQuality) String() string {
+	switch q {
+	case ResampleQualityLow:
+		return "low"
+	case ResampleQualityMedium:
+		return "medium"
+	case ResampleQualityHigh:
+		return "high"
+	}
+	return fmt.Sprintf("ResampleQuality(%d)", q)
+}
+
+// ResamplerConfig holds the settings of a Resampler.
+type ResamplerConfig struct {
+	// InputRate and OutputRate are the sample rates in Hz.
+	InputRate, OutputRate uint32
+	// Channels is the number of channels.
+	Channels uint8
+	// BitsPerSample is the bits per sample of the input and output.
+	BitsPerSample uint8
+	// Quality selects the filter.
+	Quality ResampleQuality
+}
+
+// Resampler converts the sample rate of audio, such as 96 kHz masters
+// delivered at 44.1 or 48 kHz, with a polyphase filter bank for the rational
+// ratio of the rates. Blocks of samples, such as the samples of the frames of
+// a stream, are passed to Resample in order, and Flush returns the samples
+// held back at the end of the stream. The output is aligned with the input,
+// without the delay of the filter, and has ceil(n*OutputRate/InputRate)
+// samples for n input samples.
+type Resampler struct {
+	config ResamplerConfig
+	l, m   int       // interpolation and decimation factors
+	half   int       // input samples on either side of an output sample
+	coefs  []float64 // 2*half taps of each of the l phases
+	lo, hi float64   // range of the samples
+
+	buf     [][]float64 // input samples of each channel from base on
+	base    int64       // number of the input sample buf[c][0]
+	next    int64       // input sample at or before the next output sample
+	phase   int         // position of the next output sample after next, in 1/l input samples
+	clipped uint64
+}
+
+// NewResampler returns a Resampler with the given settings.
+func NewResampler(config ResamplerConfig) (*Resampler, error) {
+	if config.InputRate == 0 || config.OutputRate == 0 {
+		return nil, fmt.Errorf("%d Hz to %d Hz: %w", config.InputRate, config.OutputRate, ErrResampleRatio)
+	}
+	if err := checkAudioFormat(&StreamInfo{SampleRate: config.InputRate, Channels: config.Channels, BitsPerSample: config.BitsPerSample}); err != nil {
+		return nil, err
+	}
+	if int(config.Quality) >= len(resampleFilters) {
+		return nil, fmt.Errorf("resample quality %d: %w", config.Quality, ErrInvalidStreamInfo)
+	}
+
+	g := gcd(int(config.InputRate), int(config.OutputRate))
+	r := &Resampler{
+		config: config,
+		l:      int(config.OutputRate) / g,
+		m:      int(config.InputRate) / g,
+		lo:     -math.Ldexp(1, int(config.BitsPerSample)-1),
+		hi:     math.Ldexp(1, int(config.BitsPerSample)-1) - 1,
+	}
+
+	filter := resampleFilters[config.Quality]
+	ratio := min(1, float64(r.l)/float64(r.m))
+	r.half = int(math.Ceil(float64(filter.taps) / 2 / ratio))
+	if r.l*2*r.half > maxResampleCoefs {
+		return nil, fmt.Errorf("%d Hz to %d Hz: %w", config.InputRate, config.OutputRate, ErrResampleRatio)
+	}
+
+	// the cutoff is halfway between the passband and the Nyquist frequency
+	// of the lower rate, in cycles per input sample
+	fc := ratio * (1 + filter.passband) / 4
+	r.coefs = make([]float64, r.l*2*r.half)
+	for p := 0; p < r.l; p++ {
+		for k := 0; k < 2*r.half; k++ {
+			t := float64(p)/float64(r.l) + float64(r.half-1-k)
+			r.coefs[p*2*r.half+k] = 2 * fc * sinc(2*fc*t) * kaiser(t/float64(r.half), filter.beta)
+		}
+	}
+	r.reset()
+	return r, nil
+}
+
+// reset starts a new stream.
+func (r *Resampler) reset() {
+	r.buf = make([][]float64, r.config.Channels)
+	for c := range r.buf {
+		r.buf[c] = make([]float64, r.half-1)
+	}
+	r.base = -int64(r.half - 1)
+	r.next, r.phase = 0, 0
+}
+
+// Clipped returns the number of samples clipped so far, which the ringing of
+// the filter can push past full scale.
+func (r *Resampler) Clipped() uint64 {
+	return r.clipped
+}
+
+// OutputLength returns the number of samples the Resampler returns for a
+// stream of n samples.
+func (r *Resampler) OutputLength(n uint64) uint64 {
+	return (n*uint64(r.l) + uint64(r.m) - 1) / uint64(r.m)
+}
+
+// Resample adds the channels of samples to the input and returns the output
+// samples it completes. Fewer output samples than the ratio suggests are
+// returned at first, as the filter needs the input following each output
+// sample.
+func (r *Resampler) Resample(samples [][]int32) [][]int32 {
+	for c, ch := range samples {
+		for _, v := range ch {
+			r.buf[c] = append(r.buf[c], float64(v))
+		}
+	}
+	return r.produce()
+}
+
+// Flush ends the stream, returns the remaining output samples and resets the
+// Resampler for a new stream.
+func (r *Resampler) Flush() [][]int32 {
+	for c := range r.buf {
+		r.buf[c] = append(r.buf[c], make([]float64, r.half)...)
+	}
+	out := r.produce()
+	r.reset()
+	return out
+}
+
+// produce computes the output samples whose input samples are all buffered
+// and drops the input samples no longer needed.
+func (r *Resampler) produce() [][]int32 {
+	end := r.base + int64(len(r.buf[0]))
+	// the output samples at input positions i+phase/l with i+half < end
+	n := 0
+	if d := (end-int64(r.half)-r.next)*int64(r.l) - int64(r.phase); d > 0 {
+		n = int((d + int64(r.m) - 1) / int64(r.m))
+	}
+
+	out := make([][]int32, len(r.buf))
+	for c, x := range r.buf {
+		out[c] = make([]int32, n)
+		i, p := r.next, r.phase
+		for j := range out[c] {
+			h := r.coefs[p*2*r.half : (p+1)*2*r.half]
+			x := x[i-int64(r.half-1)-r.base:][:2*r.half]
+			var y float64
+			for k, v := range x {
+				y += v * h[k]
+			}
+			y = math.Round(y)
+			if y < r.lo || y > r.hi {
+				y = max(r.lo, min(y, r.hi))
+				r.clipped++
+			}
+			out[c][j] = int32(y)
+
+			p += r.m
+			i += int64(p / r.l)
+			p %= r.l
+		}
+	}
+
+	phase := r.phase + n*r.m
+	r.next += int64(phase / r.l)
+	r.phase = phase % r.l
+	if drop := min(r.next-int64(r.half-1)-r.base, int64(len(r.buf[0]))); drop > 0 {
+		for c := range r.buf {
+			r.buf[c] = append(r.buf[c][:0], r.buf[c][drop:]...)
+		}
+		r.base += drop
+	}
+	return out
+}
+
+// sinc returns the normalized sinc function sin(πx)/(πx).
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// kaiser returns the Kaiser window of shape beta at x in [-1,1].
+func kaiser(x, beta float64) float64 {
+	if x < -1 || x > 1 {
+		return 0
+	}
+	return besselI0(beta*math.Sqrt(1-x*x)) / besselI0(beta)
+}
+
+// besselI0 returns the modified Bessel function of the first kind of order 0.
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > sum*1e-17; k++ {
+		term *= x * x / 4 / float64(k*k)
+		sum += term
+	}
+	return sum
+}
+
+// gcd returns the greatest common divisor of a and b.
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
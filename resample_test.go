@@ -0,0 +1,164 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"slices"
+	"testing"
+)
+
+// sineAt returns n samples of a tone of freq Hz at the given sample rate and
+// amplitude in LSB.
+func sineAt(n int, freq, rate, amp float64) []int32 {
+	return testSignal(n, func(i int) int32 {
+		return int32(math.Round(amp * math.Sin(2*math.Pi*float64(i)*freq/rate)))
+	})
+}
+
+// resampleAll resamples s in blocks of the given size and flushes r.
+func resampleAll(r *Resampler, s []int32, block int) []int32 {
+	var out []int32
+	for i := 0; i < len(s); i += block {
+		out = append(out, r.Resample([][]int32{s[i:min(i+block, len(s))]})[0]...)
+	}
+	return append(out, r.Flush()[0]...)
+}
+
+func TestResampler(t *testing.T) {
+	const n = 20000
+
+	tests := []struct {
+		in, out uint32
+		quality ResampleQuality
+		maxErr  float64 // largest error of a 1 kHz tone in LSB of 16 bits
+	}{
+		{96000, 44100, ResampleQualityHigh, 1},
+		{96000, 48000, ResampleQualityMedium, 1},
+		{88200, 44100, ResampleQualityLow, 4},
+		{192000, 44100, ResampleQualityMedium, 1},
+		{44100, 48000, ResampleQualityMedium, 1},
+	}
+	for _, tt := range tests {
+		config := ResamplerConfig{InputRate: tt.in, OutputRate: tt.out, Channels: 1, BitsPerSample: 16, Quality: tt.quality}
+		r, err := NewResampler(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		const amp = 16000
+		got := resampleAll(r, sineAt(n, 1000, float64(tt.in), amp), 4096)
+		if want := r.OutputLength(n); uint64(len(got)) != want {
+			t.Fatalf("%d to %d Hz: got %d samples, want %d", tt.in, tt.out, len(got), want)
+		}
+
+		// the output is aligned with the input; the ends are not compared
+		// as the input stops abruptly
+		want := sineAt(len(got), 1000, float64(tt.out), amp)
+		margin := len(got) / 20
+		for i := margin; i < len(got)-margin; i++ {
+			if d := math.Abs(float64(got[i] - want[i])); d > tt.maxErr {
+				t.Fatalf("%d to %d Hz: sample %d = %d, want %d", tt.in, tt.out, i, got[i], want[i])
+			}
+		}
+
+		// the same output in blocks of any size, and after Flush
+		if again := resampleAll(r, sineAt(n, 1000, float64(tt.in), amp), 777); !slices.Equal(got, again) {
+			t.Errorf("%d to %d Hz: output depends on the block size", tt.in, tt.out)
+		}
+	}
+
+	// a tone above the output Nyquist frequency is removed
+	r, err := NewResampler(ResamplerConfig{InputRate: 96000, OutputRate: 44100, Channels: 2, BitsPerSample: 24, Quality: ResampleQualityMedium})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tone := sineAt(n, 30000, 96000, 1<<22)
+	out := r.Resample([][]int32{tone, tone})
+	for c := range out {
+		var sq float64
+		for _, v := range out[c][500 : len(out[c])-500] {
+			sq += float64(v) * float64(v)
+		}
+		if rms := math.Sqrt(sq / float64(len(out[c])-1000)); rms > 1<<22*math.Pow(10, -90.0/20) {
+			t.Errorf("channel %d: alias of 30 kHz tone has RMS %.1f", c, rms)
+		}
+	}
+
+	if _, err := NewResampler(ResamplerConfig{InputRate: 44100, OutputRate: 44099, Channels: 1, BitsPerSample: 16, Quality: ResampleQualityHigh}); !errors.Is(err, ErrResampleRatio) {
+		t.Errorf("unsupported ratio: got error %v", err)
+	}
+}
+
+func TestResamplePipeline(t *testing.T) {
+	const n = 30000
+
+	// a 96 kHz stream, resampled to 48 kHz while decoding and encoded again
+	audio := [][]int32{sineAt(n, 440, 96000, 1<<20), sineAt(n, 880, 96000, 1<<20)}
+	var master bytes.Buffer
+	testEncode(t, &master, &StreamInfo{SampleRate: 96000, Channels: 2, BitsPerSample: 24}, CompressionLevel(5), audio)
+
+	r := NewReader(bytes.NewReader(master.Bytes()))
+	for {
+		b, err := r.ReadBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Last {
+			break
+		}
+	}
+	info := r.StreamInfo()
+	rs, err := NewResampler(ResamplerConfig{InputRate: info.SampleRate, OutputRate: 48000, Channels: info.Channels, BitsPerSample: info.BitsPerSample, Quality: ResampleQualityHigh})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var delivery bytes.Buffer
+	e, err := NewEncoder(&delivery, &StreamInfo{SampleRate: 48000, Channels: info.Channels, BitsPerSample: info.BitsPerSample}, CompressionLevel(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		f, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Write(rs.Resample(f.Samples)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Write(rs.Flush()); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r = NewReader(bytes.NewReader(delivery.Bytes()))
+	var got [2][]int32
+	for {
+		f, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[0] = append(got[0], f.Samples[0]...)
+		got[1] = append(got[1], f.Samples[1]...)
+	}
+	if info := r.StreamInfo(); info.SampleRate != 48000 || len(got[0]) != n/2 {
+		t.Fatalf("resampled stream has %d Hz and %d samples, want 48000 Hz and %d", info.SampleRate, len(got[0]), n/2)
+	}
+	for c, freq := range []float64{440, 880} {
+		want := sineAt(n/2, freq, 48000, 1<<20)
+		for i := 1000; i < n/2-1000; i++ {
+			if d := got[c][i] - want[i]; d < -16 || d > 16 {
+				t.Fatalf("channel %d sample %d = %d, want %d", c, i, got[c][i], want[i])
+			}
+		}
+	}
+}
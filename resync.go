@@ -0,0 +1,285 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrorPolicy determines how a Reader handles damaged frames, whose CRCs do
+// not match or which fail to decode.
+type ErrorPolicy uint8
+
+const (
+	// ErrorPolicyAbort makes ReadFrame return the error of the first damaged
+	// frame, which every later call returns as well.
+	ErrorPolicyAbort ErrorPolicy = iota
+	// ErrorPolicySkip drops damaged frames and resumes at the next frame
+	// header with a valid sync code and CRC-8.
+	ErrorPolicySkip
+	// ErrorPolicyConceal replaces damaged frames with frames of silence
+	// covering their samples and resumes at the next frame header with a
+	// valid sync code and CRC-8. The number of lost samples is taken from the
+	// sample number of the next valid frame, or at the end of the stream from
+	// STREAMINFO or the header of the damaged frame.
+	ErrorPolicyConceal
+)
+
+func (p ErrorPolicy) String() string {
+	switch p {
+	case ErrorPolicyAbort:
+		return "abort"
+	case ErrorPolicySkip:
+		return "skip"
+	case ErrorPolicyConceal:
+		return "conceal"
+	}
+	return fmt.Sprintf("ErrorPolicy(%d)", p)
+}
+
+// FrameError describes a damaged frame.
+type FrameError struct {
+	// Offset is the byte offset of the frame from the beginning of the stream.
+	Offset int64
+	// SampleNumber is the number of the first sample of the frame, from its
+	// header if that is valid, or following the previous frame otherwise.
+	SampleNumber uint64
+	Err          error
+}
+
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("frame at sample %d, offset %d: %v", e.SampleNumber, e.Offset, e.Err)
+}
+
+func (e *FrameError) Unwrap() error {
+	return e.Err
+}
+
+// damage describes a stretch of damaged frames.
+type damage struct {
+	// offset is the byte offset of the first damaged frame.
+	offset int64
+	// end is the number of the sample following the last damaged frame with a
+	// valid header, or 0 if there is none.
+	end uint64
+}
+
+// acceptFrame returns the valid frame f, or with ErrorPolicyConceal the first
+// of the frames of silence covering the samples lost before it.
+func (r *Reader) acceptFrame(f *Frame) *Frame {
+	d, start := r.damaged, r.nextSample
+	r.damaged = nil
+	r.nextSample = f.SampleNumber + uint64(f.BlockSize)
+	if d == nil || r.ErrorPolicy != ErrorPolicyConceal || f.SampleNumber <= start {
+		return f
+	}
+
+	r.pending = append(r.conceal(d.offset, start, f.SampleNumber), f)
+	f = r.pending[0]
+	r.pending = r.pending[1:]
+	return f
+}
+
+// recoverFrame reports the damaged frame at offset, whose header is f if it
+// is valid, and resumes at the next frame header unless the error policy is
+// ErrorPolicyAbort. It reports whether reading can continue.
+func (r *Reader) recoverFrame(offset int64, f *Frame) bool {
+	ferr := &FrameError{Offset: offset, SampleNumber: r.nextSample, Err: r.err}
+	if f != nil {
+		ferr.SampleNumber = f.SampleNumber
+	}
+	if r.OnFrameError != nil {
+		r.OnFrameError(ferr)
+	}
+	if r.ErrorPolicy == ErrorPolicyAbort {
+		return false
+	}
+
+	if r.damaged == nil {
+		r.damaged = &damage{offset: offset}
+	}
+	if f != nil {
+		r.damaged.end = max(r.damaged.end, f.SampleNumber+uint64(f.BlockSize))
+	}
+	r.err = nil
+	return r.resync()
+}
+
+// concealEnd is called at the end of the stream. With ErrorPolicyConceal, it
+// returns frames of silence covering the samples of damaged frames at the end
+// of the stream.
+func (r *Reader) concealEnd() (*Frame, error) {
+	d := r.damaged
+	r.damaged = nil
+	if d == nil || r.ErrorPolicy != ErrorPolicyConceal {
+		return nil, r.err
+	}
+
+	end := d.end
+	end = max(end, r.totalSamples())
+	if end <= r.nextSample {
+		return nil, r.err
+	}
+	r.pending = r.conceal(d.offset, r.nextSample, end)
+	r.nextSample = end
+	return r.ReadFrame()
+}
+
+// conceal returns frames of silence for the samples start up to end, which
+// were lost in the damaged frames at offset. It returns nil if the audio
+// format is unknown without STREAMINFO.
+func (r *Reader) conceal(offset int64, start, end uint64) []*Frame {
+	si := r.streamInfo
+	if si == nil {
+		return nil
+	}
+	size := uint64(65535)
+	switch {
+	case r.blockSize != 0:
+		size = uint64(r.blockSize)
+	case si.MaximumBlockSize != 0:
+		size = uint64(si.MaximumBlockSize)
+	}
+
+	var frames []*Frame
+	for n := start; n < end; n += size {
+		f := &Frame{
+			FrameHeader: FrameHeader{
+				HasVariableBlockSize: r.blockSize == 0,
+				BlockSize:            uint16(min(size, end-n)),
+				SampleRate:           si.SampleRate,
+				ChannelAssignment:    ChannelAssignment(si.Channels - 1),
+				BitsPerSample:        si.BitsPerSample,
+				Number:               n,
+			},
+			Concealed:    true,
+			Offset:       offset,
+			SampleNumber: n,
+			Samples:      make([][]int32, si.Channels),
+		}
+		if r.blockSize != 0 {
+			f.Number = n / uint64(r.blockSize)
+		}
+		for ch := range f.Samples {
+			f.Samples[ch] = make([]int32, f.BlockSize)
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// scanFirstFrame scans a stream of bare frames for the first frame that
+// decodes, and infers the STREAMINFO of the stream from it. Candidates that
+// fail to decode are not reported, since they are likely to be a sync code
+// and CRC-8 that match by chance, or a frame cut off at the start.
+func (r *Reader) scanFirstFrame() (*Frame, error) {
+	for {
+		if !r.resync() {
+			return nil, r.err
+		}
+		offset := r.cr.n
+		f, ok := r.readFrame()
+		if ok {
+			r.streamInfo = &StreamInfo{
+				SampleRate:    f.SampleRate,
+				Channels:      uint8(len(f.Subframes)),
+				BitsPerSample: f.BitsPerSample,
+				MD5:           make([]byte, 16),
+			}
+			r.nextSample = f.SampleNumber
+			return r.acceptFrame(f), nil
+		}
+		if errors.Is(r.err, io.ErrUnexpectedEOF) {
+			r.err = r.truncated(offset)
+			return nil, r.err
+		}
+		r.err = nil
+	}
+}
+
+// maxFrameHeaderSize is the size of the longest frame header, with a 7 byte
+// coded number, 16 bit block size and 16 bit sample rate.
+const maxFrameHeaderSize = 16
+
+// resync discards the bytes up to the next frame header with a valid sync
+// code and CRC-8. It reports whether one was found before the end of the
+// stream, or else sets r.err.
+func (r *Reader) resync() bool {
+	r.r.Align()
+	for {
+		b, err := r.cr.r.Peek(maxFrameHeaderSize)
+		if len(b) < 2 {
+			if err == nil {
+				err = io.EOF
+			}
+			r.err = err
+			return false
+		}
+		if validFrameHeader(b) {
+			return true
+		}
+
+		// skip to the next possible start of a sync code
+		n := 1 + bytes.IndexByte(b[1:], 0xff)
+		if n == 0 {
+			n = len(b)
+		}
+		for i := 0; i < n; i++ {
+			if _, err := r.cr.ReadByte(); err != nil {
+				r.err = err
+				return false
+			}
+		}
+	}
+}
+
+// validFrameHeader reports whether b starts with a frame header with a valid
+// sync code, no reserved values and a matching CRC-8.
+func validFrameHeader(b []byte) bool {
+	if len(b) < 6 || b[0] != 0xff || b[1]&0xfe != 0xf8 {
+		return false
+	}
+
+	n := 4 // sync code and the fields up to the coded number
+	switch c := b[4]; {
+	case c&0x80 == 0:
+		n++
+	case c&0xe0 == 0xc0:
+		n += 2
+	case c&0xf0 == 0xe0:
+		n += 3
+	case c&0xf8 == 0xf0:
+		n += 4
+	case c&0xfc == 0xf8:
+		n += 5
+	case c&0xfe == 0xfc:
+		n += 6
+	case c == 0xfe:
+		n += 7
+	default:
+		return false
+	}
+
+	switch b[2] >> 4 {
+	case 0:
+		return false
+	case 6:
+		n++
+	case 7:
+		n += 2
+	}
+	switch b[2] & 0xf {
+	case 12:
+		n++
+	case 13, 14:
+		n += 2
+	case 15:
+		return false
+	}
+	if ChannelAssignment(b[3]>>4).Channels() == 0 || b[3]>>1&0b111 == 3 || b[3]&1 != 0 {
+		return false
+	}
+
+	return len(b) > n && updateCRC8(0, b[:n]) == b[n]
+}
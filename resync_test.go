@@ -0,0 +1,148 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestReadFrameErrorPolicy(t *testing.T) {
+	const blockSize, n = 1024, 4000
+
+	audio := testAudio(2, n, 16)
+	var stream bytes.Buffer
+	config := CompressionLevel(5)
+	config.BlockSize = blockSize
+	testEncode(t, &stream, &StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 16, TotalSamples: n}, config, audio)
+
+	var offsets []int64
+	r := NewReader(bytes.NewReader(stream.Bytes()))
+	for {
+		f, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, f.Offset)
+	}
+	if len(offsets) != 4 {
+		t.Fatalf("encoded %d frames, want 4", len(offsets))
+	}
+
+	// damage the audio of the second frame and the header of the last one
+	damaged := bytes.Clone(stream.Bytes())
+	damaged[offsets[1]+100] ^= 0x55
+	damaged[offsets[3]+3] ^= 0x10
+
+	tests := []struct {
+		policy  ErrorPolicy
+		samples []uint64 // sample numbers of the frames read
+	}{
+		{ErrorPolicyAbort, []uint64{0}},
+		{ErrorPolicySkip, []uint64{0, 2048}},
+		{ErrorPolicyConceal, []uint64{0, 1024, 2048, 3072}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			var reported []*FrameError
+			r := NewReader(bytes.NewReader(damaged))
+			r.ErrorPolicy = tt.policy
+			r.OnFrameError = func(err *FrameError) { reported = append(reported, err) }
+
+			var samples []uint64
+			var err error
+			for {
+				var f *Frame
+				if f, err = r.ReadFrame(); err != nil {
+					break
+				}
+				samples = append(samples, f.SampleNumber)
+
+				want := audio
+				if f.Concealed {
+					want = make([][]int32, 2)
+					for ch := range want {
+						want[ch] = make([]int32, n)
+					}
+				}
+				for ch := range f.Samples {
+					if !slices.Equal(f.Samples[ch], want[ch][f.SampleNumber:][:f.BlockSize]) {
+						t.Errorf("frame at sample %d: channel %d differs", f.SampleNumber, ch)
+					}
+				}
+			}
+
+			if tt.policy == ErrorPolicyAbort {
+				if !errors.Is(err, ErrCRCMismatch) {
+					t.Errorf("err = %v, want ErrCRCMismatch", err)
+				}
+			} else if err != io.EOF {
+				t.Errorf("err = %v, want io.EOF", err)
+			}
+			if !slices.Equal(samples, tt.samples) {
+				t.Errorf("frames at samples %v, want %v", samples, tt.samples)
+			}
+
+			if len(reported) == 0 || reported[0].Offset != offsets[1] || reported[0].SampleNumber != blockSize {
+				t.Fatalf("first reported error = %v, want frame at sample %d, offset %d", reported, blockSize, offsets[1])
+			}
+			if tt.policy != ErrorPolicyAbort {
+				if len(reported) != 2 || reported[1].Offset != offsets[3] || reported[1].SampleNumber != 3*blockSize {
+					t.Errorf("reported errors = %v, want frames at offsets %d and %d", reported, offsets[1], offsets[3])
+				}
+			}
+		})
+	}
+}
+
+func TestNewFrameReader(t *testing.T) {
+	const blockSize, n = 1024, 4000
+
+	audio := testAudio(2, n, 16)
+	var stream bytes.Buffer
+	config := CompressionLevel(5)
+	config.BlockSize = blockSize
+	testEncode(t, &stream, &StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 16}, config, audio)
+	r := NewReader(bytes.NewReader(stream.Bytes()))
+	f, err := r.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// start in the middle of the first frame, without the marker and metadata
+	r = NewFrameReader(bytes.NewReader(stream.Bytes()[f.Offset+50:]))
+	var samples []uint64
+	for {
+		f, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		samples = append(samples, f.SampleNumber)
+		for ch := range f.Samples {
+			want := audio[ch][f.SampleNumber : f.SampleNumber+uint64(f.BlockSize)]
+			if !slices.Equal(f.Samples[ch], want) {
+				t.Fatalf("frame at sample %d, channel %d: samples differ", f.SampleNumber, ch)
+			}
+		}
+	}
+	if want := []uint64{1024, 2048, 3072}; !slices.Equal(samples, want) {
+		t.Errorf("read frames at samples %v, want %v", samples, want)
+	}
+	si := r.StreamInfo()
+	if si == nil || si.SampleRate != 44100 || si.Channels != 2 || si.BitsPerSample != 16 || si.TotalSamples != 0 {
+		t.Errorf("inferred STREAMINFO = %+v", si)
+	}
+
+	// a stream without frames
+	r = NewFrameReader(bytes.NewReader(make([]byte, 100)))
+	if _, err := r.ReadFrame(); err != io.EOF {
+		t.Errorf("reading a stream without frames: err = %v, want io.EOF", err)
+	}
+}
@@ -0,0 +1,76 @@
+package flac
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/icza/bitio"
+)
+
+// ErrNotSeekable is returned by SeekSample if the underlying reader is not an
+// io.ReadSeeker.
+var ErrNotSeekable = errors.New("reader is not seekable")
+
+// SeekSample moves to the frame holding the given sample and returns it. The
+// next ReadFrame returns the frame following it. The underlying reader must
+// be an io.ReadSeeker, positioned at the start of the stream when the Reader
+// was created or reset.
+//
+// SeekSample jumps to the closest seek point before the sample in the
+// SEEKTABLE block, if any, and reads the frames from there. Without a seek
+// point, it reads on from the current frame if that is before the sample, and
+// from the first frame otherwise. Since seek points and the headers of
+// variable-blocksize frames hold sample numbers, this works for streams of
+// either blocking strategy.
+func (r *Reader) SeekSample(sample uint64) (*Frame, error) {
+	rs, ok := r.src.(io.ReadSeeker)
+	if !ok {
+		return nil, ErrNotSeekable
+	}
+	for !r.readLastBlock {
+		if _, err := r.ReadBlock(); err != nil {
+			return nil, err
+		}
+	}
+	if si := r.streamInfo; si != nil && si.TotalSamples != 0 && sample >= si.TotalSamples {
+		return nil, fmt.Errorf("sample %d is past the end of the stream of %d samples", sample, si.TotalSamples)
+	}
+
+	// the closest seek point at or before the sample, else the first frame
+	var point SeekPoint
+	if t := r.seekTable; t != nil {
+		for _, p := range t.SeekPoints {
+			if !p.IsPlaceholder() && p.NumSamples != 0 && p.SampleNumber <= sample && p.SampleNumber >= point.SampleNumber {
+				point = *p
+			}
+		}
+	}
+	cont := r.err == nil && len(r.pending) == 0 && r.damaged == nil
+	if !cont || r.nextSample > sample || r.nextSample < point.SampleNumber {
+		offset := r.framesOffset + int64(point.Offset)
+		if _, err := rs.Seek(r.start+offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		r.cr.r.Reset(rs)
+		r.cr.n = offset
+		r.r = bitio.NewReader(r.cr)
+		r.err = nil
+		r.nextSample = point.SampleNumber
+		r.damaged = nil
+		r.pending = nil
+	}
+
+	for {
+		f, err := r.ReadFrame()
+		if err == io.EOF {
+			return nil, fmt.Errorf("sample %d is past the end of the stream", sample)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if sample < f.SampleNumber+uint64(f.BlockSize) {
+			return f, nil
+		}
+	}
+}
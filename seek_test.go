@@ -0,0 +1,109 @@
+package flac
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// transientAudio returns quiet stereo audio with a loud burst every 3000
+// samples.
+func transientAudio(n int) [][]int32 {
+	audio := testAudio(2, n, 16)
+	for ch := range audio {
+		for i := range audio[ch] {
+			if i%3000 >= 400 {
+				audio[ch][i] /= 64
+			}
+		}
+	}
+	return audio
+}
+
+func TestVariableBlockSize(t *testing.T) {
+	const n = 20000
+
+	audio := transientAudio(n)
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	table := new(SeekTable)
+	table.AppendSpacedPoints(4, n)
+	config := CompressionLevel(5)
+	config.VariableBlockSize = true
+	testEncode(t, f, &StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 16}, config, audio, &MetadataBlock{
+		MetadataBlockHeader: MetadataBlockHeader{Type: MetadataBlockTypeSeekTable},
+		Data:                table,
+	})
+
+	f.Seek(0, io.SeekStart)
+	r := NewReader(f)
+	sizes := make(map[uint16]bool)
+	var next uint64
+	for {
+		frame, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !frame.HasVariableBlockSize || frame.SampleNumber != next {
+			t.Fatalf("frame at sample %d has variable block size %t, want true at sample %d", frame.SampleNumber, frame.HasVariableBlockSize, next)
+		}
+		for ch := range audio {
+			if !slices.Equal(frame.Samples[ch], audio[ch][next:next+uint64(frame.BlockSize)]) {
+				t.Fatalf("frame at sample %d, channel %d: samples differ", next, ch)
+			}
+		}
+		sizes[frame.BlockSize] = true
+		next += uint64(frame.BlockSize)
+	}
+	if next != n || len(sizes) < 3 {
+		t.Errorf("decoded %d samples in blocks of %d sizes, want %d samples in blocks of at least 3 sizes", next, len(sizes), n)
+	}
+
+	f.Seek(0, io.SeekStart)
+	scanned, err := ScanStreamInfo(f, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si := r.StreamInfo(); si.MinimumBlockSize != scanned.MinimumBlockSize || si.MaximumBlockSize != scanned.MaximumBlockSize {
+		t.Errorf("STREAMINFO block sizes %d to %d, scanned %d to %d", si.MinimumBlockSize, si.MaximumBlockSize, scanned.MinimumBlockSize, scanned.MaximumBlockSize)
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, withTable := range []bool{true, false} {
+		r := NewReader(bytes.NewReader(data))
+		if !withTable {
+			if _, err := r.SeekSample(0); err != nil {
+				t.Fatal(err)
+			}
+			r.seekTable = nil
+		}
+		for _, sample := range []uint64{12345, 3000, 0, 19999, 3001, 3002} {
+			frame, err := r.SeekSample(sample)
+			if err != nil {
+				t.Fatalf("SeekSample(%d): %v", sample, err)
+			}
+			end := frame.SampleNumber + uint64(frame.BlockSize)
+			if sample < frame.SampleNumber || sample >= end {
+				t.Errorf("SeekSample(%d) = frame of samples %d to %d", sample, frame.SampleNumber, end)
+			}
+			if !slices.Equal(frame.Samples[0], audio[0][frame.SampleNumber:end]) {
+				t.Errorf("SeekSample(%d): samples differ", sample)
+			}
+		}
+		if _, err := r.SeekSample(n); err == nil {
+			t.Error("SeekSample past the end succeeded")
+		}
+	}
+}
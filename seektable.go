@@ -2,8 +2,12 @@ package flac
 
 import (
 	"encoding/binary"
+	"sort"
 )
 
+// PlaceholderSampleNumber is the sample number of a placeholder seek point.
+const PlaceholderSampleNumber = 0xFFFFFFFFFFFFFFFF
+
 // SeekTable represents seek table metadata block data.
 //
 // https://xiph.org/flac/format.html#metadata_block_seektable
@@ -27,7 +31,74 @@ type SeekPoint struct {
 
 // IsPlaceholder returns true if the seek point is a placeholder.
 func (sp *SeekPoint) IsPlaceholder() bool {
-	return sp.SampleNumber == 0xFFFFFFFFFFFFFFFF
+	return sp.SampleNumber == PlaceholderSampleNumber
+}
+
+// AppendPoint appends an unresolved seek point targeting the given sample.
+func (t *SeekTable) AppendPoint(sampleNumber uint64) {
+	t.SeekPoints = append(t.SeekPoints, &SeekPoint{SampleNumber: sampleNumber})
+}
+
+// AppendPlaceholders appends n placeholder seek points.
+func (t *SeekTable) AppendPlaceholders(n int) {
+	for i := 0; i < n; i++ {
+		t.SeekPoints = append(t.SeekPoints, &SeekPoint{SampleNumber: PlaceholderSampleNumber})
+	}
+}
+
+// AppendSpacedPoints appends n unresolved seek points evenly spaced over a
+// stream of totalSamples samples, starting at the first sample.
+func (t *SeekTable) AppendSpacedPoints(n int, totalSamples uint64) {
+	if n <= 0 || totalSamples == 0 {
+		return
+	}
+	for i := 0; i < n; i++ {
+		t.AppendPoint(totalSamples * uint64(i) / uint64(n))
+	}
+}
+
+// AppendSpacedPointsBySamples appends an unresolved seek point every samples
+// samples of a stream of totalSamples samples, starting at the first sample.
+func (t *SeekTable) AppendSpacedPointsBySamples(samples, totalSamples uint64) {
+	if samples == 0 {
+		return
+	}
+	for s := uint64(0); s < totalSamples; s += samples {
+		t.AppendPoint(s)
+	}
+}
+
+// Resolve updates the seek points targeting a sample of the frame starting at
+// sampleNumber to point to that frame. offset is the byte offset of the frame
+// header from the first frame header. The table must be sorted.
+func (t *SeekTable) Resolve(sampleNumber, offset uint64, numSamples uint16) {
+	end := sampleNumber + uint64(numSamples)
+	i := sort.Search(len(t.SeekPoints), func(i int) bool {
+		return t.SeekPoints[i].SampleNumber >= sampleNumber
+	})
+	for ; i < len(t.SeekPoints) && t.SeekPoints[i].SampleNumber < end; i++ {
+		p := t.SeekPoints[i]
+		p.SampleNumber = sampleNumber
+		p.Offset = offset
+		p.NumSamples = numSamples
+	}
+}
+
+// Sort sorts the seek points by sample number with placeholders last, and
+// removes points with duplicate sample numbers.
+func (t *SeekTable) Sort() {
+	sort.SliceStable(t.SeekPoints, func(i, j int) bool {
+		return t.SeekPoints[i].SampleNumber < t.SeekPoints[j].SampleNumber
+	})
+
+	points := t.SeekPoints[:0]
+	for _, p := range t.SeekPoints {
+		if n := len(points); n > 0 && !p.IsPlaceholder() && p.SampleNumber == points[n-1].SampleNumber {
+			continue
+		}
+		points = append(points, p)
+	}
+	t.SeekPoints = points
 }
 
 func (r *Reader) decodeSeekTable(blockLength uint32) (*SeekTable, error) {
@@ -66,3 +137,11 @@ func (r *Reader) decodeSeekPoint() (*SeekPoint, error) {
 
 	return seekPoint, nil
 }
+
+func (w *Writer) encodeSeekTable(t *SeekTable) {
+	for _, p := range t.SeekPoints {
+		binary.Write(&w.buf, binary.BigEndian, p.SampleNumber)
+		binary.Write(&w.buf, binary.BigEndian, p.Offset)
+		binary.Write(&w.buf, binary.BigEndian, p.NumSamples)
+	}
+}
@@ -0,0 +1,60 @@
+package flac
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSeekTableSort(t *testing.T) {
+	table := new(SeekTable)
+	table.AppendPoint(500)
+	table.AppendPlaceholders(2)
+	table.AppendPoint(100)
+	table.AppendPoint(500)
+	table.AppendPoint(0)
+
+	table.Sort()
+
+	want := []uint64{0, 100, 500, PlaceholderSampleNumber, PlaceholderSampleNumber}
+	var got []uint64
+	for _, p := range table.SeekPoints {
+		got = append(got, p.SampleNumber)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sample numbers = %v, want %v", got, want)
+	}
+}
+
+func TestSeekTableResolve(t *testing.T) {
+	table := new(SeekTable)
+	table.AppendSpacedPoints(4, 10000)
+	table.AppendSpacedPointsBySamples(3000, 10000)
+	table.AppendPlaceholders(1)
+	table.Sort()
+
+	// frames of 1024 samples, each 100 bytes long
+	for s := uint64(0); s < 10000; s += 1024 {
+		n := uint16(1024)
+		if s+1024 > 10000 {
+			n = uint16(10000 - s)
+		}
+		table.Resolve(s, s/1024*100, n)
+	}
+	table.Sort()
+
+	want := []*SeekPoint{
+		{SampleNumber: 0, Offset: 0, NumSamples: 1024},
+		{SampleNumber: 2048, Offset: 200, NumSamples: 1024},
+		{SampleNumber: 4096, Offset: 400, NumSamples: 1024},
+		{SampleNumber: 5120, Offset: 500, NumSamples: 1024},
+		{SampleNumber: 7168, Offset: 700, NumSamples: 1024},
+		{SampleNumber: 8192, Offset: 800, NumSamples: 1024},
+		{SampleNumber: PlaceholderSampleNumber},
+	}
+	if !reflect.DeepEqual(table.SeekPoints, want) {
+		for _, p := range table.SeekPoints {
+			t.Logf("%+v", *p)
+		}
+		t.Errorf("resolved seek table does not match")
+	}
+}
@@ -0,0 +1,313 @@
+package flac
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// ErrInvalidImageConfig is returned for image settings that cannot be
+// rendered.
+var ErrInvalidImageConfig = errors.New("invalid image settings")
+
+// FrequencyScale is the scale of the frequency axis of a Spectrogram.
+type FrequencyScale uint8
+
+const (
+	// FrequencyScaleLinear spaces frequencies evenly.
+	FrequencyScaleLinear FrequencyScale = iota
+	// FrequencyScaleLog spaces octaves evenly, from the MinFrequency of the
+	// SpectrogramConfig.
+	FrequencyScaleLog
+)
+
+func (s FrequencyScale) String() string {
+	switch s {
+	case FrequencyScaleLinear:
+		return "linear"
+	case FrequencyScaleLog:
+		return "log"
+	}
+	return fmt.Sprintf("FrequencyScale(%d)", s)
+}
+
+// Defaults of the zero fields of a SpectrogramConfig and WaveformConfig.
+const (
+	defaultImageWidth       = 800
+	defaultImageHeight      = 256 // pixels per channel
+	defaultFFTSize          = 2048
+	defaultMinFrequency     = 20.0  // Hz
+	defaultSpectrogramRange = 120.0 // dB
+	minFFTSize, maxFFTSize  = 16, 1 << 16
+	maxImageSize            = 1 << 14 // pixels of either side of an image
+)
+
+// SpectrogramConfig holds the settings of a Spectrogram. Zero fields select
+// the defaults.
+type SpectrogramConfig struct {
+	// Width is the width of the image in pixels. Each column shows an equal
+	// span of the stream. The default is 800.
+	Width int
+	// Height is the height in pixels of the spectrogram of each channel. The
+	// default is 256.
+	Height int
+	// FFTSize is the number of samples of each FFT, a power of two from 16
+	// to 65536. Larger sizes resolve frequencies more finely and time more
+	// coarsely. The default is 2048.
+	FFTSize int
+	// Window is the window function of the FFTs.
+	Window Window
+	// Scale is the scale of the frequency axis.
+	Scale FrequencyScale
+	// MinFrequency is the frequency in Hz at the bottom of a log scale. The
+	// default is 20 Hz.
+	MinFrequency float64
+	// Range is the range in dB below full scale of the levels shown. The
+	// default is 120 dB.
+	Range float64
+}
+
+// spectrogramColors are the colors of the levels of a Spectrogram, from the
+// bottom of the range to full scale.
+var spectrogramColors = []color.RGBA{
+	{0, 0, 0, 255},
+	{32, 0, 96, 255},
+	{128, 0, 160, 255},
+	{224, 32, 64, 255},
+	{255, 144, 0, 255},
+	{255, 240, 128, 255},
+	{255, 255, 255, 255},
+}
+
+// Spectrogram renders a spectrogram of decoded audio: time from left to right
+// and frequency from bottom to top, with the channels stacked from top to
+// bottom. The samples of a stream are passed to Write or WriteFrame in order,
+// and Image returns the rendering.
+type Spectrogram struct {
+	config  SpectrogramConfig
+	total   uint64 // samples of each channel of the stream
+	scale   float64
+	window  []float64
+	buf     []complex128
+	rowBins [][2]int // first and last FFT bin of each row, top row first
+
+	pending [][]float64 // samples of each channel not yet transformed
+	n       uint64      // samples written
+	col     int         // column of the power spectra being summed
+	power   [][]float64 // sum of the power spectra of each channel
+	windows int         // number of power spectra summed
+
+	levels [][]float64 // level in dB of each pixel of each channel, by column
+	filled []bool      // columns with levels
+}
+
+// NewSpectrogram returns a Spectrogram of audio of the sample rate, channels,
+// bits per sample and total samples of info.
+func NewSpectrogram(info *StreamInfo, config SpectrogramConfig) (*Spectrogram, error) {
+	if err := checkImageStreamInfo(info); err != nil {
+		return nil, err
+	}
+	if config.Width == 0 {
+		config.Width = defaultImageWidth
+	}
+	if config.Height == 0 {
+		config.Height = defaultImageHeight
+	}
+	if config.FFTSize == 0 {
+		config.FFTSize = defaultFFTSize
+	}
+	if config.MinFrequency == 0 {
+		config.MinFrequency = defaultMinFrequency
+	}
+	if config.Range == 0 {
+		config.Range = defaultSpectrogramRange
+	}
+	if err := checkImageSize(config.Width, config.Height, int(info.Channels)); err != nil {
+		return nil, err
+	}
+	if n := config.FFTSize; n < minFFTSize || n > maxFFTSize || n&(n-1) != 0 {
+		return nil, fmt.Errorf("FFT size %d: %w", n, ErrInvalidImageConfig)
+	}
+	if config.Window > WindowRectangular {
+		return nil, fmt.Errorf("window %d: %w", config.Window, ErrInvalidImageConfig)
+	}
+	nyquist := float64(info.SampleRate) / 2
+	switch {
+	case config.Scale > FrequencyScaleLog:
+		return nil, fmt.Errorf("frequency scale %d: %w", config.Scale, ErrInvalidImageConfig)
+	case config.Scale == FrequencyScaleLog && (config.MinFrequency < 0 || config.MinFrequency >= nyquist):
+		return nil, fmt.Errorf("minimum frequency %g Hz: %w", config.MinFrequency, ErrInvalidImageConfig)
+	case config.Range < 0:
+		return nil, fmt.Errorf("range %g dB: %w", config.Range, ErrInvalidImageConfig)
+	}
+
+	channels := int(info.Channels)
+	s := &Spectrogram{
+		config:  config,
+		total:   info.TotalSamples,
+		scale:   math.Ldexp(1, 1-int(info.BitsPerSample)),
+		window:  config.Window.coefficients(config.FFTSize),
+		buf:     make([]complex128, config.FFTSize),
+		rowBins: make([][2]int, config.Height),
+		pending: make([][]float64, channels),
+		power:   make([][]float64, channels),
+		levels:  make([][]float64, channels),
+		filled:  make([]bool, config.Width),
+	}
+	for c := range s.pending {
+		s.pending[c] = make([]float64, 0, config.FFTSize)
+		s.power[c] = make([]float64, config.FFTSize/2+1)
+		s.levels[c] = make([]float64, config.Width*config.Height)
+	}
+
+	binHz := float64(info.SampleRate) / float64(config.FFTSize)
+	last := config.FFTSize / 2
+	frequency := func(t float64) float64 {
+		if config.Scale == FrequencyScaleLog {
+			return config.MinFrequency * math.Pow(nyquist/config.MinFrequency, t)
+		}
+		return t * nyquist
+	}
+	h := float64(config.Height)
+	for y := range s.rowBins {
+		lo := min(int(math.Round(frequency((h-1-float64(y))/h)/binHz)), last)
+		hi := min(max(int(math.Round(frequency((h-float64(y))/h)/binHz))-1, lo), last)
+		s.rowBins[y] = [2]int{lo, hi}
+	}
+	return s, nil
+}
+
+// checkImageStreamInfo checks the stream parameters of an image of a stream,
+// which must have a known length.
+func checkImageStreamInfo(info *StreamInfo) error {
+	if err := checkAudioFormat(info); err != nil {
+		return err
+	}
+	if info.TotalSamples == 0 {
+		return fmt.Errorf("unknown total samples: %w", ErrInvalidStreamInfo)
+	}
+	return nil
+}
+
+// checkImageSize checks the size of an image of channels of the given height.
+func checkImageSize(width, height, channels int) error {
+	if width < 1 || width > maxImageSize || height < 1 || height*channels > maxImageSize {
+		return fmt.Errorf("%dx%d pixels of %d channels: %w", width, height, channels, ErrInvalidImageConfig)
+	}
+	return nil
+}
+
+// column returns the column of the image of sample i.
+func column(i, total uint64, width int) int {
+	return int(min(i*uint64(width)/total, uint64(width-1)))
+}
+
+// WriteFrame adds the samples of a frame to the spectrogram.
+func (s *Spectrogram) WriteFrame(f *Frame) {
+	s.Write(f.Samples)
+}
+
+// Write adds channels of samples of the bits per sample of the stream to the
+// spectrogram.
+func (s *Spectrogram) Write(samples [][]int32) {
+	for i := range samples[0] {
+		for c, ch := range samples {
+			s.pending[c] = append(s.pending[c], float64(ch[i])*s.scale)
+		}
+		s.n++
+		if len(s.pending[0]) == len(s.window) {
+			s.transform(s.n - uint64(len(s.window)/2))
+		}
+	}
+}
+
+// transform adds the power spectra of the pending samples, centered on sample
+// center, to its column, and drops the first half of the pending samples.
+func (s *Spectrogram) transform(center uint64) {
+	if col := column(center, s.total, s.config.Width); col != s.col {
+		s.endColumn()
+		s.col = col
+	}
+	hop := len(s.window) / 2
+	for c, p := range s.pending {
+		powerSpectrum(s.power[c], p, s.window, s.buf)
+		s.pending[c] = p[:copy(p, p[hop:])]
+	}
+	s.windows++
+}
+
+// endColumn sets the levels of the current column from the power spectra
+// summed.
+func (s *Spectrogram) endColumn() {
+	if s.windows == 0 {
+		return
+	}
+	for c, power := range s.power {
+		levels := s.levels[c][s.col*s.config.Height:]
+		for y, bins := range s.rowBins {
+			var p float64
+			for _, v := range power[bins[0] : bins[1]+1] {
+				p = max(p, v)
+			}
+			levels[y] = 10 * math.Log10(p/float64(s.windows)+1e-30)
+		}
+		clear(power)
+	}
+	s.filled[s.col] = true
+	s.windows = 0
+}
+
+// Image returns the spectrogram of the samples written so far. Columns
+// without an FFT of their own, where the image is wider than the stream has
+// FFTs, repeat the previous column, or the first for leading columns.
+func (s *Spectrogram) Image() *image.RGBA {
+	if s.n > 0 && s.windows == 0 && !s.filled[s.col] && len(s.pending[0]) > 0 {
+		// audio shorter than an FFT is transformed padded with silence
+		center := s.n - uint64(len(s.pending[0]))/2
+		for c, p := range s.pending {
+			s.pending[c] = append(p, make([]float64, len(s.window)-len(p))...)
+		}
+		s.transform(center)
+	}
+	s.endColumn()
+
+	w, h := s.config.Width, s.config.Height
+	img := image.NewRGBA(image.Rect(0, 0, w, h*len(s.levels)))
+	src := -1 // column of the levels of each column
+	for x := 0; x < w; x++ {
+		if s.filled[x] {
+			src = x
+		} else if src < 0 {
+			for i := x; i < w; i++ {
+				if s.filled[i] {
+					src = i
+					break
+				}
+			}
+			if src < 0 {
+				// nothing written
+				break
+			}
+		}
+		for c, levels := range s.levels {
+			for y, l := range levels[src*h : (src+1)*h] {
+				img.SetRGBA(x, c*h+y, s.color(l))
+			}
+		}
+	}
+	return img
+}
+
+// color returns the color of a level in dB.
+func (s *Spectrogram) color(level float64) color.RGBA {
+	t := min(max((level+s.config.Range)/s.config.Range, 0), 1) * float64(len(spectrogramColors)-1)
+	i := min(int(t), len(spectrogramColors)-2)
+	f := t - float64(i)
+	a, b := spectrogramColors[i], spectrogramColors[i+1]
+	mix := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + f*(float64(y)-float64(x))))
+	}
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
@@ -0,0 +1,84 @@
+package flac
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSpectrogram(t *testing.T) {
+	// a tone of 1 kHz then 10 kHz on the left channel, silence on the right
+	const rate, n = 44100, 44100
+	left := append(sineAt(n/2, 1000, rate, 16000), sineAt(n/2, 10000, rate, 16000)...)
+	right := make([]int32, n)
+	info := &StreamInfo{SampleRate: rate, Channels: 2, BitsPerSample: 16, TotalSamples: n}
+
+	for _, tt := range []struct {
+		scale        FrequencyScale
+		low, high    int // rows of 1 kHz and 10 kHz
+		quiet        int // row far from both
+		window       Window
+		bright, dark uint8
+	}{
+		{FrequencyScaleLinear, 95, 54, 20, WindowHann, 200, 64},
+		{FrequencyScaleLog, 44, 11, 80, WindowBlackman, 200, 64},
+		// leakage of the rectangular window lights up the other rows
+		{FrequencyScaleLinear, 95, 54, 20, WindowRectangular, 200, 230},
+	} {
+		s, err := NewSpectrogram(info, SpectrogramConfig{Width: 100, Height: 100, Scale: tt.scale, Window: tt.window})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i += 4096 {
+			s.Write([][]int32{left[i:min(i+4096, n)], right[i:min(i+4096, n)]})
+		}
+		img := s.Image()
+		if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 200 {
+			t.Fatalf("%v: image is %v", tt.scale, b)
+		}
+		for _, p := range []struct {
+			x, y   int
+			bright bool
+		}{
+			{20, tt.low, true},
+			{20, tt.high, false},
+			{80, tt.high, true},
+			{80, tt.low, false},
+			{30, tt.quiet, false},
+			{20, 100 + tt.low, false}, // right channel
+		} {
+			r := img.RGBAAt(p.x, p.y).R
+			if p.bright && r < tt.bright || !p.bright && r > tt.dark {
+				t.Errorf("%v, %v: pixel %d,%d has red %d, want bright %v", tt.scale, tt.window, p.x, p.y, r, p.bright)
+			}
+		}
+	}
+
+	// audio shorter than an FFT and than the image is wide
+	short := &StreamInfo{SampleRate: rate, Channels: 1, BitsPerSample: 16, TotalSamples: 100}
+	s, err := NewSpectrogram(short, SpectrogramConfig{Width: 300, Height: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write([][]int32{sineAt(100, 5000, rate, 16000)})
+	img := s.Image()
+	for _, x := range []int{0, 150, 299} {
+		if r := img.RGBAAt(x, 99-22).R; r < 128 {
+			t.Errorf("short audio: pixel %d has red %d", x, r)
+		}
+	}
+
+	for _, config := range []SpectrogramConfig{
+		{FFTSize: 1000},
+		{FFTSize: 8},
+		{Width: -1},
+		{Height: 1 << 14},
+		{Scale: FrequencyScaleLog, MinFrequency: 30000},
+	} {
+		if _, err := NewSpectrogram(info, config); !errors.Is(err, ErrInvalidImageConfig) {
+			t.Errorf("%+v: got %v, want ErrInvalidImageConfig", config, err)
+		}
+	}
+	if _, err := NewSpectrogram(&StreamInfo{SampleRate: rate, Channels: 1, BitsPerSample: 16}, SpectrogramConfig{}); !errors.Is(err, ErrInvalidStreamInfo) {
+		t.Errorf("unknown total samples: got %v", err)
+	}
+}
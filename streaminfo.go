@@ -1,5 +1,12 @@
 package flac
 
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
 // StreamInfo represents stream info metadata block data.
 //
 // https://xiph.org/flac/format.html#metadata_block_streaminfo
@@ -26,6 +33,20 @@ type StreamInfo struct {
 	MD5 []byte
 }
 
+// checkAudioFormat checks the sample rate, channels and bits per sample of
+// decoded audio passed to an analyzer or processor.
+func checkAudioFormat(info *StreamInfo) error {
+	switch {
+	case info.SampleRate == 0:
+		return fmt.Errorf("sample rate %d: %w", info.SampleRate, ErrInvalidStreamInfo)
+	case info.Channels == 0:
+		return fmt.Errorf("%d channels: %w", info.Channels, ErrInvalidStreamInfo)
+	case info.BitsPerSample < 4 || info.BitsPerSample > 32:
+		return fmt.Errorf("%d bits per sample: %w", info.BitsPerSample, ErrInvalidStreamInfo)
+	}
+	return nil
+}
+
 func (r *Reader) decodeStreamInfo() (*StreamInfo, error) {
 	streamInfo := new(StreamInfo)
 
@@ -80,7 +101,77 @@ func (r *Reader) decodeStreamInfo() (*StreamInfo, error) {
 	if !r.readFull(r.buf[:16]) {
 		return nil, r.err
 	}
-	streamInfo.MD5 = r.buf[:16]
+	streamInfo.MD5 = append([]byte(nil), r.buf[:16]...)
 
 	return streamInfo, nil
 }
+
+func (w *Writer) encodeStreamInfo(si *StreamInfo) {
+	var b [18]byte
+
+	// <16 bits> minimum block size, <16 bits> maximum block size
+	binary.BigEndian.PutUint16(b[0:], si.MinimumBlockSize)
+	binary.BigEndian.PutUint16(b[2:], si.MaximumBlockSize)
+
+	// <24 bits> minimum frame size, <24 bits> maximum frame size
+	b[4], b[5], b[6] = byte(si.MinimumFrameSize>>16), byte(si.MinimumFrameSize>>8), byte(si.MinimumFrameSize)
+	b[7], b[8], b[9] = byte(si.MaximumFrameSize>>16), byte(si.MaximumFrameSize>>8), byte(si.MaximumFrameSize)
+
+	// <20 bits> sample rate, <3 bits> channels - 1, <5 bits> bits per sample - 1,
+	// <36 bits> total samples
+	v := uint64(si.SampleRate&0xfffff)<<44 |
+		uint64((si.Channels-1)&0b111)<<41 |
+		uint64((si.BitsPerSample-1)&0b11111)<<36 |
+		si.TotalSamples&(1<<36-1)
+	binary.BigEndian.PutUint64(b[10:], v)
+
+	w.buf.Write(b[:])
+
+	// <128 bits> MD5 signature
+	var md5 [16]byte
+	copy(md5[:], si.MD5)
+	w.buf.Write(md5[:])
+}
+
+// AudioMD5 computes the MD5 signature of audio samples as stored in
+// STREAMINFO: the samples interleaved and coded as signed little-endian
+// integers of the smallest whole number of bytes that holds them.
+type AudioMD5 struct {
+	h     hash.Hash
+	bytes int
+	buf   []byte
+}
+
+func NewAudioMD5(bitsPerSample uint8) *AudioMD5 {
+	return &AudioMD5{h: md5.New(), bytes: (int(bitsPerSample) + 7) / 8}
+}
+
+// Write adds the samples of each channel to the signature.
+func (m *AudioMD5) Write(samples [][]int32) {
+	if len(samples) == 0 {
+		return
+	}
+
+	n := len(samples[0]) * len(samples) * m.bytes
+	if cap(m.buf) < n {
+		m.buf = make([]byte, n)
+	}
+	buf := m.buf[:n]
+
+	i := 0
+	for j := range samples[0] {
+		for _, ch := range samples {
+			v := ch[j]
+			for b := 0; b < m.bytes; b++ {
+				buf[i] = byte(v >> (8 * b))
+				i++
+			}
+		}
+	}
+	m.h.Write(buf)
+}
+
+// Sum returns the MD5 signature of the samples written so far.
+func (m *AudioMD5) Sum() []byte {
+	return m.h.Sum(nil)
+}
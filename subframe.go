@@ -0,0 +1,480 @@
+package flac
+
+import (
+	"fmt"
+
+	"github.com/icza/bitio"
+)
+
+// SubframeType is the prediction method of a subframe.
+type SubframeType uint8
+
+// Subframe types
+const (
+	SubframeTypeConstant SubframeType = iota
+	SubframeTypeVerbatim
+	SubframeTypeFixed
+	SubframeTypeLPC
+)
+
+func (t SubframeType) String() string {
+	switch t {
+	case SubframeTypeConstant:
+		return "CONSTANT"
+	case SubframeTypeVerbatim:
+		return "VERBATIM"
+	case SubframeTypeFixed:
+		return "FIXED"
+	case SubframeTypeLPC:
+		return "LPC"
+	}
+	return "INVALID"
+}
+
+// Subframe represents the header and prediction parameters of a subframe.
+//
+// https://xiph.org/flac/format.html#subframe
+type Subframe struct {
+	Type SubframeType
+	// Predictor order of a FIXED or LPC subframe.
+	Order int
+	// Number of wasted bits-per-sample.
+	WastedBits uint8
+	// Quantized linear predictor coefficient precision in bits of an LPC
+	// subframe.
+	Precision uint8
+	// Quantized linear predictor coefficient shift of an LPC subframe.
+	Shift int8
+	// Predictor coefficients of an LPC subframe.
+	Coefficients []int32
+	// Value of a CONSTANT subframe, excluding wasted bits. It needs 33 bits
+	// in the side channel of 32 bit stereo.
+	Value int64
+	// Warm-up samples of a FIXED or LPC subframe, excluding wasted bits.
+	Warmup []int64
+	// Coding of the residual of a FIXED or LPC subframe.
+	ResidualCoding *ResidualCoding
+	// Residual of a FIXED or LPC subframe, following the warm-up samples.
+	// Only kept by AnalyzeFrame. The residual of a 32 bit signal need not fit
+	// in 32 bits.
+	Residual []int64
+}
+
+// ResidualCoding describes the partitioned Rice coding of a residual.
+//
+// https://xiph.org/flac/format.html#residual
+type ResidualCoding struct {
+	// Method is 0 for 4 bit Rice parameters (RICE) and 1 for 5 bit Rice
+	// parameters (RICE2).
+	Method uint8
+	// The residual is divided into 2^PartitionOrder partitions.
+	PartitionOrder uint8
+	Partitions     []RicePartition
+}
+
+// RicePartition describes the coding of one residual partition.
+type RicePartition struct {
+	// Rice parameter of the partition, unless it is escaped.
+	Parameter uint8
+	// Escaped is set when the residual of the partition is stored unencoded
+	// as signed numbers of RawBits bits.
+	Escaped bool
+	RawBits uint8
+}
+
+// decodeSubframe decodes a subframe of n samples of bps bits each. The
+// samples are 64 bit, since the side channel of 32 bit stereo has 33 bits.
+func (r *Reader) decodeSubframe(bps uint8, n int) (*Subframe, []int64) {
+	sf := new(Subframe)
+
+	// <1 bit> zero padding, <6 bits> subframe type, <1 bit> wasted bits flag
+	b, ok := r.readBits(8)
+	if !ok {
+		return nil, nil
+	}
+	if b&0x80 != 0 {
+		r.err = fmt.Errorf("subframe padding bit set: %w", ErrReservedValue)
+		return nil, nil
+	}
+
+	typeBits := b >> 1 & 0x3f
+	switch {
+	case typeBits == 0:
+		sf.Type = SubframeTypeConstant
+	case typeBits == 1:
+		sf.Type = SubframeTypeVerbatim
+	case typeBits&0x38 == 0x08 && typeBits&0x07 <= 4:
+		sf.Type = SubframeTypeFixed
+		sf.Order = int(typeBits & 0x07)
+	case typeBits&0x20 != 0:
+		sf.Type = SubframeTypeLPC
+		sf.Order = int(typeBits&0x1f) + 1
+	default:
+		r.err = fmt.Errorf("subframe type %#b: %w", typeBits, ErrReservedValue)
+		return nil, nil
+	}
+
+	if b&1 != 0 {
+		// <k bits> unary coded wasted bits-per-sample - 1
+		k, ok := r.readUnary()
+		if !ok {
+			return nil, nil
+		}
+		sf.WastedBits = uint8(k) + 1
+		if sf.WastedBits >= bps {
+			r.err = fmt.Errorf("subframe has %d wasted bits of %d", sf.WastedBits, bps)
+			return nil, nil
+		}
+		bps -= sf.WastedBits
+	}
+
+	if n < sf.Order {
+		r.err = fmt.Errorf("predictor order %d exceeds block size %d", sf.Order, n)
+		return nil, nil
+	}
+
+	samples := make([]int64, n)
+
+	switch sf.Type {
+	case SubframeTypeConstant:
+		v, ok := r.readSigned(bps)
+		if !ok {
+			return nil, nil
+		}
+		sf.Value = v
+		for i := range samples {
+			samples[i] = v
+		}
+	case SubframeTypeVerbatim:
+		for i := range samples {
+			v, ok := r.readSigned(bps)
+			if !ok {
+				return nil, nil
+			}
+			samples[i] = v
+		}
+	case SubframeTypeFixed:
+		if !r.readWarmup(samples[:sf.Order], bps) || !r.decodeResidual(sf, samples) {
+			return nil, nil
+		}
+		restoreFixed(samples, sf.Order)
+	case SubframeTypeLPC:
+		if !r.readWarmup(samples[:sf.Order], bps) || !r.decodeLPCParams(sf) || !r.decodeResidual(sf, samples) {
+			return nil, nil
+		}
+		restoreLPC(samples, sf.Coefficients, sf.Shift)
+	}
+
+	if sf.WastedBits > 0 {
+		for i := range samples {
+			samples[i] <<= sf.WastedBits
+		}
+	}
+
+	return sf, samples
+}
+
+// readWarmup reads the unencoded warm-up samples of a predictor.
+func (r *Reader) readWarmup(samples []int64, bps uint8) bool {
+	for i := range samples {
+		v, ok := r.readSigned(bps)
+		if !ok {
+			return false
+		}
+		samples[i] = v
+	}
+	return true
+}
+
+func (r *Reader) decodeLPCParams(sf *Subframe) bool {
+	// <4 bits> quantized linear predictor coefficients' precision in bits - 1
+	b, ok := r.readBits(4)
+	if !ok {
+		return false
+	}
+	if b == 0xf {
+		r.err = fmt.Errorf("LPC precision: %w", ErrReservedValue)
+		return false
+	}
+	sf.Precision = uint8(b) + 1
+
+	// <5 bits> quantized linear predictor coefficient shift (signed)
+	shift, ok := r.readSigned(5)
+	if !ok {
+		return false
+	}
+	if shift < 0 {
+		r.err = fmt.Errorf("negative LPC shift %d", shift)
+		return false
+	}
+	sf.Shift = int8(shift)
+
+	// <n bits> unencoded predictor coefficients (signed)
+	sf.Coefficients = make([]int32, sf.Order)
+	for i := range sf.Coefficients {
+		c, ok := r.readSigned(sf.Precision)
+		if !ok {
+			return false
+		}
+		sf.Coefficients[i] = int32(c)
+	}
+
+	return true
+}
+
+// decodeResidual reads the Rice coded residual of the predictor of sf into
+// samples[sf.Order:], following the warm-up samples.
+func (r *Reader) decodeResidual(sf *Subframe, samples []int64) bool {
+	order := sf.Order
+	sf.Warmup = append([]int64(nil), samples[:order]...)
+
+	// <2 bits> residual coding method
+	method, ok := r.readBits(2)
+	if !ok {
+		return false
+	}
+	var paramBits uint8
+	switch method {
+	case 0:
+		paramBits = 4
+	case 1:
+		paramBits = 5
+	default:
+		r.err = fmt.Errorf("residual coding method %d: %w", method, ErrReservedValue)
+		return false
+	}
+	escape := uint64(1)<<paramBits - 1
+
+	// <4 bits> partition order
+	partitionOrder, ok := r.readBits(4)
+	if !ok {
+		return false
+	}
+	partitions := 1 << partitionOrder
+	if len(samples)%partitions != 0 || len(samples)>>partitionOrder < order {
+		r.err = fmt.Errorf("invalid partition order %d for block size %d", partitionOrder, len(samples))
+		return false
+	}
+	rc := &ResidualCoding{
+		Method:         uint8(method),
+		PartitionOrder: uint8(partitionOrder),
+		Partitions:     make([]RicePartition, partitions),
+	}
+	sf.ResidualCoding = rc
+
+	i := order
+	for p := 0; p < partitions; p++ {
+		end := (p + 1) * len(samples) >> partitionOrder
+
+		param, ok := r.readBits(paramBits)
+		if !ok {
+			return false
+		}
+
+		if param == escape {
+			// <5 bits> bits per unencoded residual sample
+			n, ok := r.readBits(5)
+			if !ok {
+				return false
+			}
+			rc.Partitions[p] = RicePartition{Escaped: true, RawBits: uint8(n)}
+			for ; i < end; i++ {
+				v, ok := r.readSigned(uint8(n))
+				if !ok {
+					return false
+				}
+				samples[i] = v
+			}
+			continue
+		}
+		rc.Partitions[p].Parameter = uint8(param)
+
+		for ; i < end; i++ {
+			q, ok := r.readUnary()
+			if !ok {
+				return false
+			}
+			lo, ok := r.readBits(uint8(param))
+			if !ok {
+				return false
+			}
+			u := q<<param | lo
+			samples[i] = int64(u>>1) ^ -int64(u&1)
+		}
+	}
+
+	if r.keepResidual {
+		sf.Residual = append([]int64(nil), samples[order:]...)
+	}
+	return true
+}
+
+// readUnary reads a unary coded number, i.e. the count of 0 bits before the
+// next 1 bit.
+func (r *Reader) readUnary() (uint64, bool) {
+	var n uint64
+	for {
+		bit, err := r.r.ReadBool()
+		if err != nil {
+			r.err = unexpectedEOF(err)
+			return 0, false
+		}
+		if bit {
+			return n, true
+		}
+		n++
+	}
+}
+
+// readSigned reads a two's complement signed number of n bits.
+func (r *Reader) readSigned(n uint8) (int64, bool) {
+	if n == 0 {
+		return 0, true
+	}
+	u, ok := r.readBits(n)
+	if !ok {
+		return 0, false
+	}
+	return int64(u<<(64-n)) >> (64 - n), true
+}
+
+// restoreFixed restores the signal of a fixed predictor of the given order
+// from its residual in place.
+func restoreFixed(s []int64, order int) {
+	switch order {
+	case 1:
+		for i := 1; i < len(s); i++ {
+			s[i] += s[i-1]
+		}
+	case 2:
+		for i := 2; i < len(s); i++ {
+			s[i] += 2*s[i-1] - s[i-2]
+		}
+	case 3:
+		for i := 3; i < len(s); i++ {
+			s[i] += 3*s[i-1] - 3*s[i-2] + s[i-3]
+		}
+	case 4:
+		for i := 4; i < len(s); i++ {
+			s[i] += 4*s[i-1] - 6*s[i-2] + 4*s[i-3] - s[i-4]
+		}
+	}
+}
+
+// restoreLPC restores the signal of a linear predictor from its residual in
+// place. With samples of up to 33 bits, coefficients of up to 15 bits and up
+// to 32 of them, the sum of the products fits in 64 bits.
+func restoreLPC(s []int64, coeffs []int32, shift int8) {
+	order := len(coeffs)
+	for i := order; i < len(s); i++ {
+		var sum int64
+		for j, c := range coeffs {
+			sum += int64(c) * s[i-j-1]
+		}
+		s[i] += sum >> shift
+	}
+}
+
+// subframeCoding is a subframe chosen by the encoder, with the data needed to
+// encode it.
+type subframeCoding struct {
+	Subframe
+	// Bits per sample, excluding wasted bits.
+	bps uint8
+	// Samples shifted right by the wasted bits.
+	samples []int64
+	// Residual of a FIXED or LPC predictor in residual[Order:].
+	residual []int32
+	rice     riceCoding
+	// Size of the encoded subframe in bits.
+	bits int
+}
+
+func encodeSubframe(bw *bitio.Writer, sf *subframeCoding) {
+	// <1 bit> zero padding, <6 bits> subframe type, <1 bit> wasted bits flag
+	var typeBits uint64
+	switch sf.Type {
+	case SubframeTypeConstant:
+		typeBits = 0
+	case SubframeTypeVerbatim:
+		typeBits = 1
+	case SubframeTypeFixed:
+		typeBits = 0x08 | uint64(sf.Order)
+	case SubframeTypeLPC:
+		typeBits = 0x20 | uint64(sf.Order-1)
+	}
+	bw.TryWriteBits(typeBits, 7)
+	bw.TryWriteBool(sf.WastedBits > 0)
+	if sf.WastedBits > 0 {
+		// <k bits> unary coded wasted bits-per-sample - 1
+		writeUnary(bw, uint64(sf.WastedBits)-1)
+	}
+
+	switch sf.Type {
+	case SubframeTypeConstant:
+		writeSigned(bw, sf.samples[0], sf.bps)
+	case SubframeTypeVerbatim:
+		for _, v := range sf.samples {
+			writeSigned(bw, v, sf.bps)
+		}
+	case SubframeTypeFixed:
+		for _, v := range sf.samples[:sf.Order] {
+			writeSigned(bw, v, sf.bps)
+		}
+		encodeResidual(bw, sf.residual, sf.Order, &sf.rice)
+	case SubframeTypeLPC:
+		for _, v := range sf.samples[:sf.Order] {
+			writeSigned(bw, v, sf.bps)
+		}
+		// <4 bits> coefficient precision - 1, <5 bits> shift
+		bw.TryWriteBits(uint64(sf.Precision)-1, 4)
+		writeSigned(bw, int64(sf.Shift), 5)
+		for _, c := range sf.Coefficients {
+			writeSigned(bw, int64(c), sf.Precision)
+		}
+		encodeResidual(bw, sf.residual, sf.Order, &sf.rice)
+	}
+}
+
+// encodeResidual writes residual[order:] with the partitioned Rice coding rc.
+func encodeResidual(bw *bitio.Writer, residual []int32, order int, rc *riceCoding) {
+	// <2 bits> residual coding method
+	paramBits := uint8(4)
+	for _, k := range rc.params {
+		if k >= 15 {
+			paramBits = 5
+		}
+	}
+	bw.TryWriteBits(uint64(paramBits-4), 2)
+
+	// <4 bits> partition order
+	bw.TryWriteBits(uint64(rc.partitionOrder), 4)
+
+	i := order
+	for p, k := range rc.params {
+		end := (p + 1) * len(residual) >> rc.partitionOrder
+		bw.TryWriteBits(uint64(k), paramBits)
+		for ; i < end; i++ {
+			v := residual[i]
+			u := uint64(uint32(v<<1 ^ v>>31))
+			writeUnary(bw, u>>k)
+			bw.TryWriteBits(u, k)
+		}
+	}
+}
+
+// writeUnary writes n as n 0 bits followed by a 1 bit.
+func writeUnary(bw *bitio.Writer, n uint64) {
+	for ; n >= 32; n -= 32 {
+		bw.TryWriteBits(0, 32)
+	}
+	bw.TryWriteBits(1, uint8(n)+1)
+}
+
+// writeSigned writes v as a two's complement signed number of n bits.
+func writeSigned(bw *bitio.Writer, v int64, n uint8) {
+	if n == 0 {
+		return
+	}
+	bw.TryWriteBits(uint64(v), n)
+}
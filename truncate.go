@@ -0,0 +1,133 @@
+package flac
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTruncated matches every *TruncatedError with errors.Is.
+var ErrTruncated = errors.New("truncated stream")
+
+// TruncatedError is returned by ReadFrame when the stream ends in the middle
+// of a frame, or, with ErrorPolicyAbort, before the number of samples given
+// in STREAMINFO. Every complete frame before it has been returned. It matches
+// both ErrTruncated and io.ErrUnexpectedEOF with errors.Is.
+type TruncatedError struct {
+	// Offset is the byte offset from the beginning of the stream of the end of
+	// the last complete frame.
+	Offset int64
+	// Samples is the number of samples in the complete frames, which is the
+	// number of the sample following the last good one.
+	Samples uint64
+	// Missing is the number of samples short of the total number of samples
+	// in STREAMINFO, or 0 if the total is unknown.
+	Missing uint64
+}
+
+func (e *TruncatedError) Error() string {
+	if e.Missing == 0 {
+		return fmt.Sprintf("%v after %d samples at offset %d", ErrTruncated, e.Samples, e.Offset)
+	}
+	return fmt.Sprintf("%v after %d samples at offset %d, %d samples missing", ErrTruncated, e.Samples, e.Offset, e.Missing)
+}
+
+func (e *TruncatedError) Is(target error) bool {
+	return target == ErrTruncated || target == io.ErrUnexpectedEOF
+}
+
+// truncated returns the error for a stream that ends at offset, after the
+// last complete frame.
+func (r *Reader) truncated(offset int64) *TruncatedError {
+	e := &TruncatedError{Offset: offset, Samples: r.nextSample}
+	if total := r.totalSamples(); total > r.nextSample {
+		e.Missing = total - r.nextSample
+	}
+	return e
+}
+
+// TruncatableFile is a file that can be cut short, such as *os.File.
+type TruncatableFile interface {
+	io.ReadWriteSeeker
+	Truncate(size int64) error
+}
+
+// TrimTruncated salvages a truncated FLAC stream in f, starting at its current
+// position. It cuts the file after the last complete frame, turns the seek
+// points past the end into placeholders and rewrites STREAMINFO for the
+// remaining frames with RepairStreamInfo, recomputing the MD5 signature. It
+// returns the *TruncatedError describing the truncation, or nil, leaving the
+// file unchanged, if the stream is complete.
+func TrimTruncated(f TruncatableFile) (*TruncatedError, error) {
+	start, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewReader(f)
+	var table *SeekTable
+	var tableOffset int64
+	var tableLast bool
+	for !r.readLastBlock {
+		offset := r.cr.n
+		b, err := r.ReadBlock()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := b.Data.(*SeekTable); ok {
+			table, tableOffset, tableLast = t, offset, b.Last
+		}
+	}
+	if r.StreamInfo() == nil {
+		return nil, errors.New("missing STREAMINFO block")
+	}
+
+	var terr *TruncatedError
+	for {
+		_, err := r.ReadFrame()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if errors.As(err, &terr) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := f.Truncate(start + terr.Offset); err != nil {
+		return nil, err
+	}
+
+	if table != nil {
+		n := len(table.SeekPoints)
+		for _, p := range table.SeekPoints {
+			if !p.IsPlaceholder() && p.SampleNumber >= terr.Samples {
+				*p = SeekPoint{SampleNumber: PlaceholderSampleNumber}
+			}
+		}
+		table.Sort()
+		table.AppendPlaceholders(n - len(table.SeekPoints))
+
+		if _, err := f.Seek(start+tableOffset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		w := &Writer{w: f, wroteMarker: true}
+		err := w.WriteBlock(&MetadataBlock{
+			MetadataBlockHeader: MetadataBlockHeader{Last: tableLast, Type: MetadataBlockTypeSeekTable},
+			Data:                table,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := RepairStreamInfo(f, true); err != nil {
+		return nil, err
+	}
+	return terr, nil
+}
@@ -0,0 +1,153 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrimTruncated(t *testing.T) {
+	const blockSize, n = 1024, 5000
+
+	audio := testAudio(2, n, 16)
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	table := new(SeekTable)
+	table.AppendSpacedPoints(5, n)
+	config := CompressionLevel(5)
+	config.BlockSize = blockSize
+	testEncode(t, f, &StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 16}, config, audio, &MetadataBlock{
+		MetadataBlockHeader: MetadataBlockHeader{Type: MetadataBlockTypeSeekTable},
+		Data:                table,
+	})
+
+	f.Seek(0, io.SeekStart)
+	var offsets []int64
+	r := NewReader(f)
+	for {
+		frame, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, frame.Offset)
+	}
+
+	// cut the file in the middle of the third frame
+	f.Truncate(offsets[2] + 10)
+	f.Seek(0, io.SeekStart)
+	r = NewReader(f)
+	frames := 0
+	for {
+		_, err = r.ReadFrame()
+		if err != nil {
+			break
+		}
+		frames++
+	}
+	var terr *TruncatedError
+	if !errors.As(err, &terr) {
+		t.Fatalf("err = %v, want a *TruncatedError", err)
+	}
+	want := TruncatedError{Offset: offsets[2], Samples: 2 * blockSize, Missing: n - 2*blockSize}
+	if frames != 2 || *terr != want {
+		t.Errorf("read %d frames, then %+v, want 2 frames, then %+v", frames, *terr, want)
+	}
+
+	f.Seek(0, io.SeekStart)
+	if terr, err = TrimTruncated(f); err != nil {
+		t.Fatal(err)
+	}
+	if terr == nil || *terr != want {
+		t.Errorf("TrimTruncated = %+v, want %+v", terr, want)
+	}
+	if fi, _ := f.Stat(); fi.Size() != offsets[2] {
+		t.Errorf("trimmed size = %d, want %d", fi.Size(), offsets[2])
+	}
+
+	f.Seek(0, io.SeekStart)
+	r = NewReader(f)
+	var blocks []*MetadataBlock
+	for !r.readLastBlock {
+		b, err := r.ReadBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, b)
+	}
+	si := r.StreamInfo()
+	md5 := NewAudioMD5(16)
+	md5.Write([][]int32{audio[0][:2*blockSize], audio[1][:2*blockSize]})
+	if si.TotalSamples != 2*blockSize || !bytes.Equal(si.MD5, md5.Sum()) {
+		t.Errorf("STREAMINFO has %d samples, MD5 %x, want %d samples, MD5 %x", si.TotalSamples, si.MD5, 2*blockSize, md5.Sum())
+	}
+	points := blocks[1].Data.(*SeekTable).SeekPoints
+	if len(points) != 5 || points[1].SampleNumber != 1024 || !points[2].IsPlaceholder() || !points[4].IsPlaceholder() {
+		t.Errorf("seek points after trimming = %v", points)
+	}
+	for {
+		if _, err = r.ReadFrame(); err != nil {
+			break
+		}
+	}
+	if err != io.EOF {
+		t.Errorf("reading the trimmed file: err = %v, want io.EOF", err)
+	}
+
+	// a complete file is left alone
+	f.Seek(0, io.SeekStart)
+	if terr, err = TrimTruncated(f); terr != nil || err != nil {
+		t.Errorf("TrimTruncated of a complete file = %v, %v", terr, err)
+	}
+}
+
+func TestReaderIgnoreTotalSamples(t *testing.T) {
+	const blockSize, n = 1024, 4000
+
+	var stream bytes.Buffer
+	config := CompressionLevel(5)
+	config.BlockSize = blockSize
+	testEncode(t, &stream, &StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 16, TotalSamples: n}, config, testAudio(2, n, 16))
+
+	// cut the stream at the start of the third frame
+	r := NewReader(bytes.NewReader(stream.Bytes()))
+	var offsets []int64
+	for len(offsets) < 3 {
+		f, err := r.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, f.Offset)
+	}
+	cut := stream.Bytes()[:offsets[2]]
+
+	for _, ignore := range []bool{false, true} {
+		r := NewReader(bytes.NewReader(cut))
+		r.IgnoreTotalSamples = ignore
+		frames := 0
+		var err error
+		for {
+			if _, err = r.ReadFrame(); err != nil {
+				break
+			}
+			frames++
+		}
+		var terr *TruncatedError
+		switch {
+		case frames != 2:
+			t.Errorf("IgnoreTotalSamples = %t: read %d frames, want 2", ignore, frames)
+		case ignore && err != io.EOF:
+			t.Errorf("IgnoreTotalSamples = %t: err = %v, want io.EOF", ignore, err)
+		case !ignore && (!errors.As(err, &terr) || terr.Missing != n-2*blockSize):
+			t.Errorf("IgnoreTotalSamples = %t: err = %v, want %d samples missing", ignore, err, n-2*blockSize)
+		}
+	}
+}
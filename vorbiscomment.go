@@ -2,13 +2,49 @@ package flac
 
 import (
 	"encoding/binary"
+	"strings"
 )
 
+// VorbisComment represents a Vorbis comment metadata block. User comments are
+// of the form FIELD=value, where field names are case-insensitive.
+//
+// https://xiph.org/flac/format.html#metadata_block_vorbis_comment
 type VorbisComment struct {
 	Vendor       string
 	UserComments []string
 }
 
+// Values returns the values of all comments with the given field name.
+func (vc *VorbisComment) Values(field string) []string {
+	var values []string
+	for _, c := range vc.UserComments {
+		if name, value, ok := strings.Cut(c, "="); ok && strings.EqualFold(name, field) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Add appends a comment with the given field name and value.
+func (vc *VorbisComment) Add(field, value string) {
+	vc.UserComments = append(vc.UserComments, field+"="+value)
+}
+
+// Remove removes all comments with the given field name and returns the
+// number of comments removed.
+func (vc *VorbisComment) Remove(field string) int {
+	comments := vc.UserComments[:0]
+	for _, c := range vc.UserComments {
+		if name, _, ok := strings.Cut(c, "="); ok && strings.EqualFold(name, field) {
+			continue
+		}
+		comments = append(comments, c)
+	}
+	n := len(vc.UserComments) - len(comments)
+	vc.UserComments = comments
+	return n
+}
+
 func (r *Reader) decodeVorbisComment() (*VorbisComment, error) {
 	vc := new(VorbisComment)
 
@@ -41,3 +77,14 @@ func (r *Reader) decodeVorbisComment() (*VorbisComment, error) {
 
 	return vc, nil
 }
+
+func (w *Writer) encodeVorbisComment(vc *VorbisComment) {
+	binary.Write(&w.buf, binary.LittleEndian, uint32(len(vc.Vendor)))
+	w.buf.WriteString(vc.Vendor)
+
+	binary.Write(&w.buf, binary.LittleEndian, uint32(len(vc.UserComments)))
+	for _, c := range vc.UserComments {
+		binary.Write(&w.buf, binary.LittleEndian, uint32(len(c)))
+		w.buf.WriteString(c)
+	}
+}
@@ -0,0 +1,151 @@
+package flac
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// defaultWaveformColor is the default foreground of a Waveform.
+var defaultWaveformColor = color.RGBA{0x33, 0x66, 0xcc, 0xff}
+
+// WaveformConfig holds the settings of a Waveform. Zero fields select the
+// defaults.
+type WaveformConfig struct {
+	// Width is the width of the image in pixels and the number of peaks of
+	// each channel. Each column shows an equal span of the stream. The
+	// default is 800.
+	Width int
+	// Height is the height in pixels of the waveform of each channel. The
+	// default is 256.
+	Height int
+	// Background and Foreground are the colors of the image. The default
+	// background is transparent and the default foreground is blue.
+	Background, Foreground color.Color
+}
+
+// WaveformPeak is the range of the sample values of a column of a Waveform,
+// relative to full scale, with 1 being full scale.
+type WaveformPeak struct {
+	Min, Max float64
+}
+
+// Waveform renders a waveform overview of decoded audio: the range of the
+// sample values of each column of the image, with the channels stacked from
+// top to bottom. The samples of a stream are passed to Write or WriteFrame
+// in order, and Peaks and Image return the results.
+type Waveform struct {
+	config WaveformConfig
+	total  uint64 // samples of each channel of the stream
+	scale  float64
+	n      uint64 // samples written
+
+	lo, hi [][]int32 // range of each column of each channel
+	filled []bool    // columns with samples
+}
+
+// NewWaveform returns a Waveform of audio of the sample rate, channels, bits
+// per sample and total samples of info.
+func NewWaveform(info *StreamInfo, config WaveformConfig) (*Waveform, error) {
+	if err := checkImageStreamInfo(info); err != nil {
+		return nil, err
+	}
+	if config.Width == 0 {
+		config.Width = defaultImageWidth
+	}
+	if config.Height == 0 {
+		config.Height = defaultImageHeight
+	}
+	if config.Background == nil {
+		config.Background = color.Transparent
+	}
+	if config.Foreground == nil {
+		config.Foreground = defaultWaveformColor
+	}
+	if err := checkImageSize(config.Width, config.Height, int(info.Channels)); err != nil {
+		return nil, err
+	}
+
+	w := &Waveform{
+		config: config,
+		total:  info.TotalSamples,
+		scale:  math.Ldexp(1, 1-int(info.BitsPerSample)),
+		lo:     make([][]int32, info.Channels),
+		hi:     make([][]int32, info.Channels),
+		filled: make([]bool, config.Width),
+	}
+	for c := range w.lo {
+		w.lo[c] = make([]int32, config.Width)
+		w.hi[c] = make([]int32, config.Width)
+	}
+	return w, nil
+}
+
+// WriteFrame adds the samples of a frame to the waveform.
+func (w *Waveform) WriteFrame(f *Frame) {
+	w.Write(f.Samples)
+}
+
+// Write adds channels of samples of the bits per sample of the stream to the
+// waveform.
+func (w *Waveform) Write(samples [][]int32) {
+	for i := range samples[0] {
+		x := column(w.n, w.total, w.config.Width)
+		first := !w.filled[x]
+		for c, ch := range samples {
+			v := ch[i]
+			if first {
+				w.lo[c][x], w.hi[c][x] = v, v
+			} else {
+				w.lo[c][x], w.hi[c][x] = min(w.lo[c][x], v), max(w.hi[c][x], v)
+			}
+		}
+		w.filled[x] = true
+		w.n++
+	}
+}
+
+// Peaks returns the peaks of each column of each channel of the samples
+// written so far. Columns without samples of their own, where the image is
+// wider than the stream is long, repeat the previous column.
+func (w *Waveform) Peaks() [][]WaveformPeak {
+	peaks := make([][]WaveformPeak, len(w.lo))
+	for c := range peaks {
+		peaks[c] = make([]WaveformPeak, w.config.Width)
+		src := -1
+		for x := range peaks[c] {
+			if w.filled[x] {
+				src = x
+			}
+			if src >= 0 {
+				peaks[c][x] = WaveformPeak{
+					Min: float64(w.lo[c][src]) * w.scale,
+					Max: float64(w.hi[c][src]) * w.scale,
+				}
+			}
+		}
+	}
+	return peaks
+}
+
+// Image returns the waveform of the samples written so far.
+func (w *Waveform) Image() *image.RGBA {
+	h := w.config.Height
+	img := image.NewRGBA(image.Rect(0, 0, w.config.Width, h*len(w.lo)))
+	draw.Draw(img, img.Bounds(), image.NewUniform(w.config.Background), image.Point{}, draw.Src)
+	fg := image.NewUniform(w.config.Foreground)
+	y := func(v float64) int {
+		return int(math.Round((1 - min(max(v, -1), 1)) * float64(h-1) / 2))
+	}
+	if w.n == 0 {
+		return img
+	}
+	for c, peaks := range w.Peaks() {
+		for x, p := range peaks {
+			r := image.Rect(x, c*h+y(p.Max), x+1, c*h+y(p.Min)+1)
+			draw.Draw(img, r, fg, image.Point{}, draw.Over)
+		}
+	}
+	return img
+}
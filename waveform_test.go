@@ -0,0 +1,62 @@
+package flac
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestWaveform(t *testing.T) {
+	// a ramp on the left channel, silence on the right
+	ramp := testSignal(1000, func(i int) int32 { return int32(i-500) * 64 })
+	info := &StreamInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 16, TotalSamples: 1000}
+	w, err := NewWaveform(info, WaveformConfig{Width: 10, Height: 11, Background: color.White})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([][]int32{ramp[:333], make([]int32, 333)})
+	w.Write([][]int32{ramp[333:], make([]int32, 667)})
+
+	peaks := w.Peaks()
+	if len(peaks) != 2 || len(peaks[0]) != 10 {
+		t.Fatalf("got %d channels of %d peaks", len(peaks), len(peaks[0]))
+	}
+	for x, p := range peaks[0] {
+		want := WaveformPeak{float64(x*100-500) / 512, float64(x*100+99-500) / 512}
+		if p != want || peaks[1][x] != (WaveformPeak{}) {
+			t.Errorf("column %d: peaks %v and %v, want %v and zero", x, p, peaks[1][x], want)
+		}
+	}
+
+	img := w.Image()
+	if b := img.Bounds(); b.Dx() != 10 || b.Dy() != 22 {
+		t.Fatalf("image is %v", b)
+	}
+	for _, p := range []struct {
+		x, y int
+		fg   bool
+	}{
+		{0, 9, true},   // -1 to -0.8 of the left channel
+		{0, 8, false},  // above it
+		{9, 1, true},   // 0.8 to 1
+		{9, 2, false},  // below it
+		{5, 16, true},  // silence on the right channel
+		{5, 15, false}, // above it
+	} {
+		if fg := img.RGBAAt(p.x, p.y) == defaultWaveformColor; fg != p.fg {
+			t.Errorf("pixel %d,%d is %v, want foreground %v", p.x, p.y, img.RGBAAt(p.x, p.y), p.fg)
+		}
+	}
+
+	// an image wider than the stream is long repeats columns
+	w, err = NewWaveform(&StreamInfo{SampleRate: 44100, Channels: 1, BitsPerSample: 8, TotalSamples: 4}, WaveformConfig{Width: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([][]int32{{-64, 64, 32, -32}})
+	want := []WaveformPeak{{-0.5, -0.5}, {-0.5, -0.5}, {0.5, 0.5}, {0.5, 0.5}, {0.25, 0.25}, {0.25, 0.25}, {-0.25, -0.25}, {-0.25, -0.25}}
+	for x, p := range w.Peaks()[0] {
+		if p != want[x] {
+			t.Errorf("wide image: column %d is %v, want %v", x, p, want[x])
+		}
+	}
+}